@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// AdvisoryKind is the type of a JetStream advisory or metric event
+type AdvisoryKind string
+
+const (
+	// AdvisoryAPIError is a JetStream API request that was answered with an error
+	AdvisoryAPIError AdvisoryKind = "api-error"
+	// AdvisoryMaxDeliver is a message that reached the max deliveries of a consumer
+	AdvisoryMaxDeliver AdvisoryKind = "max-deliver"
+	// AdvisoryLeaderElected is a new leader of a stream, a consumer or the meta group
+	AdvisoryLeaderElected AdvisoryKind = "leader-elected"
+	// AdvisoryStreamCreated is a stream being created
+	AdvisoryStreamCreated AdvisoryKind = "stream-created"
+	// AdvisoryStreamDeleted is a stream being deleted
+	AdvisoryStreamDeleted AdvisoryKind = "stream-deleted"
+	// AdvisoryAck is a sampled acknowledgement with its latency
+	AdvisoryAck AdvisoryKind = "ack"
+)
+
+// advisoryKinds are the kinds in the order they are shown, with their labels
+var advisoryKinds = []struct {
+	Kind  AdvisoryKind
+	Label string
+}{
+	{AdvisoryAPIError, "API errors"},
+	{AdvisoryMaxDeliver, "Max deliveries exceeded"},
+	{AdvisoryLeaderElected, "Leader elections"},
+	{AdvisoryStreamCreated, "Streams created"},
+	{AdvisoryStreamDeleted, "Streams deleted"},
+	{AdvisoryAck, "Ack samples"},
+}
+
+// Advisory and metric types read, see the JetStream advisory schemas
+const (
+	apiAuditType              = "io.nats.jetstream.advisory.v1.api_audit"
+	maxDeliverType            = "io.nats.jetstream.advisory.v1.max_deliver"
+	streamActionType          = "io.nats.jetstream.advisory.v1.stream_action"
+	streamLeaderElectedType   = "io.nats.jetstream.advisory.v1.stream_leader_elected"
+	consumerLeaderElectedType = "io.nats.jetstream.advisory.v1.consumer_leader_elected"
+	domainLeaderElectedType   = "io.nats.jetstream.advisory.v1.domain_leader_elected"
+	consumerAckMetricType     = "io.nats.jetstream.metric.v1.consumer_ack"
+)
+
+// maxAdvisoryTopKeys is the most errors and consumers listed as the most frequent
+const maxAdvisoryTopKeys = 10
+
+// ackLatencyBins are the upper bounds of the ack latency histogram, the last bin is open
+var ackLatencyBins = []struct {
+	Upper time.Duration
+	Label string
+}{
+	{time.Millisecond, "< 1ms"},
+	{10 * time.Millisecond, "1ms - 10ms"},
+	{100 * time.Millisecond, "10ms - 100ms"},
+	{time.Second, "100ms - 1s"},
+	{10 * time.Second, "1s - 10s"},
+	{time.Minute, "10s - 1m"},
+	{0, ">= 1m"},
+}
+
+// AdvisoryEvent is one advisory or metric of interest read from an advisory stream
+type AdvisoryEvent struct {
+	Time     time.Time
+	Kind     AdvisoryKind
+	Stream   string // stream the event is about, empty if none
+	Consumer string
+	// Detail is the error of an API error or the new leader of an election
+	Detail  string
+	AckTime time.Duration // latency of a sampled ack
+}
+
+// advisory holds the fields of all advisory types read, each type fills its own
+type advisory struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Stream    string    `json:"stream"`
+	Consumer  string    `json:"consumer"`
+	Action    string    `json:"action"`
+	Leader    string    `json:"leader"`
+	Subject   string    `json:"subject"`
+	Response  string    `json:"response"`
+	AckTime   int64     `json:"ack_time"`
+}
+
+// ParseAdvisory decodes an advisory or metric, false for the types and actions not analysed
+// and for API requests that succeeded. Events without a timestamp take the stored time.
+func ParseAdvisory(data []byte, stored time.Time) (AdvisoryEvent, bool) {
+	var a advisory
+	if err := json.Unmarshal(data, &a); err != nil {
+		return AdvisoryEvent{}, false
+	}
+
+	event := AdvisoryEvent{Time: a.Timestamp, Stream: a.Stream, Consumer: a.Consumer}
+	if event.Time.IsZero() {
+		event.Time = stored
+	}
+
+	switch a.Type {
+	case apiAuditType:
+		var response struct {
+			Error *struct {
+				Code        int    `json:"code"`
+				ErrCode     int    `json:"err_code"`
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		if json.Unmarshal([]byte(a.Response), &response) != nil || response.Error == nil {
+			return event, false
+		}
+		event.Kind = AdvisoryAPIError
+		event.Stream = apiSubjectStream(a.Subject)
+		event.Detail = fmt.Sprintf("%d %s", response.Error.ErrCode, response.Error.Description)
+	case maxDeliverType:
+		event.Kind = AdvisoryMaxDeliver
+	case streamActionType:
+		switch a.Action {
+		case "create":
+			event.Kind = AdvisoryStreamCreated
+		case "delete":
+			event.Kind = AdvisoryStreamDeleted
+		default:
+			return event, false
+		}
+	case streamLeaderElectedType, consumerLeaderElectedType, domainLeaderElectedType:
+		event.Kind = AdvisoryLeaderElected
+		event.Detail = a.Leader
+	case consumerAckMetricType:
+		event.Kind = AdvisoryAck
+		event.AckTime = time.Duration(a.AckTime)
+	default:
+		return event, false
+	}
+	return event, true
+}
+
+// apiSubjectStream returns the stream a JetStream API subject is about, empty for requests
+// not about one stream such as listing streams
+func apiSubjectStream(subject string) string {
+	tokens := strings.Split(subject, ".")
+	if len(tokens) < 5 || tokens[0] != "$JS" || tokens[1] != "API" {
+		return ""
+	}
+
+	// The stream follows the operation, which takes two tokens for some requests such as
+	// $JS.API.STREAM.MSG.GET.<stream> or $JS.API.CONSUMER.DURABLE.CREATE.<stream>.<consumer>
+	idx := 4
+	switch tokens[2] {
+	case "STREAM":
+		switch tokens[3] {
+		case "LIST", "NAMES":
+			return ""
+		case "MSG", "PEER", "LEADER":
+			idx = 5
+		}
+	case "CONSUMER":
+		switch tokens[3] {
+		case "DURABLE", "MSG", "LEADER":
+			idx = 5
+		}
+	case "DIRECT":
+	default:
+		return ""
+	}
+	if idx >= len(tokens) {
+		return ""
+	}
+	return tokens[idx]
+}
+
+// FetchAdvisories reads the advisories of interest stored in an advisory stream, sorted by
+// time, and the number of advisories read
+func FetchAdvisories(ctx context.Context, js jetstream.JetStream, streamInfo StreamInfo, opts FetchOptions) ([]AdvisoryEvent, int, error) {
+	var mu sync.Mutex
+	var events []AdvisoryEvent
+	opts.Limit = 0
+	opts.Selections = nil
+	opts.Progress = nil
+	opts.Payload = func(msg MessageData, data []byte) {
+		event, ok := ParseAdvisory(data, msg.Timestamp)
+		if !ok {
+			return
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+
+	messages, _, err := FetchStreamMessages(ctx, js, streamInfo, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read advisory stream %s: %w", streamInfo.Name, err)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events, len(messages), nil
+}
+
+// filterAdvisories returns the events about one stream
+func filterAdvisories(events []AdvisoryEvent, stream string) []AdvisoryEvent {
+	var filtered []AdvisoryEvent
+	for _, e := range events {
+		if e.Stream == stream {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// LatencyStats summarizes the ack latencies of sampled acks
+type LatencyStats struct {
+	Count int
+	Avg   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// AdvisoryCount is the number of events with the same key, such as an error or a consumer
+type AdvisoryCount struct {
+	Key   string
+	Count int
+}
+
+// AdvisoryBucket holds the events in one bucket of the publish rate histogram
+type AdvisoryBucket struct {
+	Start  time.Time
+	End    time.Time
+	Rate   float64 // stored publish rate of the bucket
+	Counts map[AdvisoryKind]int
+	AckP99 time.Duration // 0 without sampled acks
+}
+
+// AdvisoryAnalysis holds the histograms of advisories along the publish rate timeline
+type AdvisoryAnalysis struct {
+	Totals     map[AdvisoryKind]int
+	Outside    int // events outside the histogram's time range
+	AckLatency LatencyStats
+	AckBins    []int            // sampled acks per ackLatencyBins bin
+	Buckets    []AdvisoryBucket // histogram buckets with events, in time order
+	TopErrors  []AdvisoryCount  // API errors by error, most frequent first
+	// TopMaxDeliver holds the consumers with messages reaching max deliveries, as STREAM > CONSUMER
+	TopMaxDeliver []AdvisoryCount
+}
+
+// BuildAdvisoryAnalysis counts the events per kind in each bucket of a publish rate
+// histogram, with the ack latency percentiles of the bucket, and overall. Events must be
+// sorted by time.
+func BuildAdvisoryAnalysis(events []AdvisoryEvent, hist *RateHistogram) *AdvisoryAnalysis {
+	analysis := &AdvisoryAnalysis{
+		Totals:  make(map[AdvisoryKind]int),
+		AckBins: make([]int, len(ackLatencyBins)),
+	}
+
+	var allAcks []float64
+	apiErrors := make(map[string]int)
+	maxDeliver := make(map[string]int)
+	var bucketAcks []float64
+	var current *AdvisoryBucket
+
+	// flush finishes the ack latency of the current bucket
+	flush := func() {
+		if current != nil && len(bucketAcks) > 0 {
+			sort.Float64s(bucketAcks)
+			current.AckP99 = time.Duration(percentileFloat64(bucketAcks, 0.99))
+		}
+		bucketAcks = bucketAcks[:0]
+	}
+
+	for _, e := range events {
+		analysis.Totals[e.Kind]++
+		switch e.Kind {
+		case AdvisoryAPIError:
+			apiErrors[e.Detail]++
+		case AdvisoryMaxDeliver:
+			maxDeliver[e.Stream+" > "+e.Consumer]++
+		case AdvisoryAck:
+			allAcks = append(allAcks, float64(e.AckTime))
+			for i, bin := range ackLatencyBins {
+				if bin.Upper == 0 || e.AckTime < bin.Upper {
+					analysis.AckBins[i]++
+					break
+				}
+			}
+		}
+
+		idx := findBucket(hist, e.Time)
+		if idx < 0 {
+			analysis.Outside++
+			continue
+		}
+		b := hist.Buckets[idx]
+		if current == nil || !current.Start.Equal(b.Start) {
+			flush()
+			analysis.Buckets = append(analysis.Buckets, AdvisoryBucket{
+				Start:  b.Start,
+				End:    b.End,
+				Rate:   b.Rate,
+				Counts: make(map[AdvisoryKind]int),
+			})
+			current = &analysis.Buckets[len(analysis.Buckets)-1]
+		}
+		current.Counts[e.Kind]++
+		if e.Kind == AdvisoryAck {
+			bucketAcks = append(bucketAcks, float64(e.AckTime))
+		}
+	}
+	flush()
+
+	if len(allAcks) > 0 {
+		sort.Float64s(allAcks)
+		var sum float64
+		for _, v := range allAcks {
+			sum += v
+		}
+		analysis.AckLatency = LatencyStats{
+			Count: len(allAcks),
+			Avg:   time.Duration(sum / float64(len(allAcks))),
+			P50:   time.Duration(percentileFloat64(allAcks, 0.50)),
+			P90:   time.Duration(percentileFloat64(allAcks, 0.90)),
+			P99:   time.Duration(percentileFloat64(allAcks, 0.99)),
+			Max:   time.Duration(allAcks[len(allAcks)-1]),
+		}
+	}
+
+	analysis.TopErrors = topAdvisoryCounts(apiErrors)
+	analysis.TopMaxDeliver = topAdvisoryCounts(maxDeliver)
+	return analysis
+}
+
+// findBucket returns the index of the histogram bucket holding t, -1 if outside all buckets
+func findBucket(hist *RateHistogram, t time.Time) int {
+	if hist == nil {
+		return -1
+	}
+	idx := sort.Search(len(hist.Buckets), func(i int) bool {
+		return hist.Buckets[i].End.After(t)
+	})
+	if idx == len(hist.Buckets) || hist.Buckets[idx].Start.After(t) {
+		return -1
+	}
+	return idx
+}
+
+// topAdvisoryCounts returns the most frequent keys, at most maxAdvisoryTopKeys
+func topAdvisoryCounts(counts map[string]int) []AdvisoryCount {
+	result := make([]AdvisoryCount, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, AdvisoryCount{Key: key, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result[:min(len(result), maxAdvisoryTopKeys)]
+}
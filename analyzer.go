@@ -1,7 +1,14 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
@@ -11,6 +18,7 @@ import (
 // MessageData holds the relevant data extracted from a message
 type MessageData struct {
 	StreamName string
+	Subject    string
 	Sequence   uint64
 	Timestamp  time.Time
 	Size       int // message payload size in bytes
@@ -19,65 +27,493 @@ type MessageData struct {
 // ProgressFunc is called to report fetch progress (current, total)
 type ProgressFunc func(current, total int)
 
+// RequestLimiter bounds the number of GetBatch requests in flight at the same time,
+// shared across all chunks and streams being fetched. A nil limiter does not limit.
+type RequestLimiter chan struct{}
+
+// NewRequestLimiter creates a limiter allowing up to n concurrent requests (nil if n <= 0)
+func NewRequestLimiter(n int) RequestLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(RequestLimiter, n)
+}
+
+// acquire blocks until a request slot is available or the context is done
+func (l RequestLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a request slot
+func (l RequestLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// FetchOptions controls how messages are fetched from a stream
+type FetchOptions struct {
+	BatchSize int
+	Limit     int // max messages per stream (0 = all)
+	StartTime *time.Time
+	EndTime   *time.Time
+	Parallel  int            // number of sequence range chunks fetched concurrently (<= 1 = sequential)
+	InFlight  RequestLimiter // global limit on concurrent batch requests (nil = unlimited)
+	Throttle  *FetchThrottle // rate limits and adaptive batch sizing (nil = none)
+	Retry     RetryOptions
+	Progress  ProgressFunc
+	// Selections narrows the fetch per stream name, the entry with an empty name applies
+	// to streams without their own
+	Selections map[string]StreamSelection
+	// Payload is called with the data of every fetched message, concurrently from the chunk
+	// fetchers when Parallel > 1 (nil = payloads are dropped)
+	Payload func(msg MessageData, data []byte)
+}
+
+// StreamSelection selects a sequence range of a stream and/or its last messages, within
+// the time range of the fetch
+type StreamSelection struct {
+	StartSeq uint64 // first sequence to fetch (0 = the stream's first)
+	EndSeq   uint64 // last sequence to fetch (0 = the stream's last)
+	Last     int    // only fetch the last messages of the range (0 = all)
+}
+
+// ParseStreamSelections parses the --start-seq, --end-seq and --last values, each a value for
+// all streams or STREAM:value for one stream. Per stream values are combined with those
+// for all streams.
+func ParseStreamSelections(startSeqs, endSeqs, last []string) (map[string]StreamSelection, error) {
+	selections := make(map[string]StreamSelection)
+	parse := func(flag string, values []string, set func(sel *StreamSelection, v string) error) error {
+		for _, value := range values {
+			stream, v := "", value
+			if i := strings.LastIndex(value, ":"); i >= 0 {
+				stream, v = value[:i], value[i+1:]
+			}
+			sel := selections[stream]
+			if err := set(&sel, v); err != nil {
+				return fmt.Errorf("invalid --%s %q: %w", flag, value, err)
+			}
+			selections[stream] = sel
+		}
+		return nil
+	}
+	parseSeq := func(s string) (uint64, error) {
+		seq, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || seq == 0 {
+			return 0, fmt.Errorf("expected a positive sequence number")
+		}
+		return seq, nil
+	}
+
+	err := parse("start-seq", startSeqs, func(sel *StreamSelection, v string) (err error) {
+		first, last, isRange := strings.Cut(v, "-")
+		if sel.StartSeq, err = parseSeq(first); err != nil || !isRange {
+			return err
+		}
+		sel.EndSeq, err = parseSeq(last)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = parse("end-seq", endSeqs, func(sel *StreamSelection, v string) (err error) {
+		sel.EndSeq, err = parseSeq(v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = parse("last", last, func(sel *StreamSelection, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("expected a positive number of messages")
+		}
+		sel.Last = n
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	all := selections[""]
+	for stream, sel := range selections {
+		if stream != "" {
+			sel.StartSeq = cmp.Or(sel.StartSeq, all.StartSeq)
+			sel.EndSeq = cmp.Or(sel.EndSeq, all.EndSeq)
+			sel.Last = cmp.Or(sel.Last, all.Last)
+			selections[stream] = sel
+		}
+		if sel.EndSeq > 0 && sel.StartSeq > sel.EndSeq {
+			return nil, fmt.Errorf("the sequence range of %s ends before it starts", cmp.Or(stream, "all streams"))
+		}
+	}
+	if len(selections) == 0 {
+		return nil, nil
+	}
+	return selections, nil
+}
+
+// selection returns the selection of a stream, the default selection if it has none
+func (o FetchOptions) selection(stream string) StreamSelection {
+	if sel, ok := o.Selections[stream]; ok {
+		return sel
+	}
+	return o.Selections[""]
+}
+
+// bounds returns the sequence range of the stream to fetch
+func (s StreamSelection) bounds(streamInfo StreamInfo) seqRange {
+	r := seqRange{First: streamInfo.FirstSeq, Last: streamInfo.LastSeq}
+	if s.StartSeq > 0 {
+		r.First = max(r.First, s.StartSeq)
+	}
+	if s.EndSeq > 0 {
+		r.Last = min(r.Last, s.EndSeq)
+	}
+	return r
+}
+
+// seqRange is an inclusive range of stream sequence numbers
+type seqRange struct {
+	First uint64
+	Last  uint64
+}
+
+// splitSeqRange splits [first, last] into at most n contiguous chunks of at least minSize sequences
+func splitSeqRange(first, last uint64, n, minSize int) []seqRange {
+	if last < first {
+		return nil
+	}
+	span := last - first + 1
+	if n < 1 {
+		n = 1
+	}
+	if minSize < 1 {
+		minSize = 1
+	}
+	if maxChunks := span / uint64(minSize); maxChunks < uint64(n) {
+		n = int(max(maxChunks, 1))
+	}
+
+	chunkSize := span / uint64(n)
+	remainder := span % uint64(n)
+
+	chunks := make([]seqRange, 0, n)
+	start := first
+	for i := 0; i < n; i++ {
+		size := chunkSize
+		// Spread the remainder over the first chunks
+		if uint64(i) < remainder {
+			size++
+		}
+		chunks = append(chunks, seqRange{First: start, Last: start + size - 1})
+		start += size
+	}
+	return chunks
+}
+
+// MessageSource returns the messages of a stream within the time range and limit of the fetch
+// options, from a server or from a backup
+type MessageSource func(ctx context.Context, streamInfo StreamInfo, opts FetchOptions) ([]MessageData, FetchCompleteness, error)
+
 // FetchStreamMessages retrieves messages from a stream using jetstreamext.GetBatch
-// If startTime is specified, fetching starts from that time. If endTime is specified,
+// If a start time is specified, fetching starts from that time. If an end time is specified,
 // fetching stops when messages exceed that time.
-// Uses the pre-recorded sequence bounds from StreamInfo for efficient fetching.
-func FetchStreamMessages(ctx context.Context, js jetstream.JetStream, streamInfo StreamInfo, batchSize, limit int, startTime, endTime *time.Time, progress ProgressFunc) ([]MessageData, error) {
-	streamName := streamInfo.Name
-	firstSeq := streamInfo.FirstSeq
-	lastSeq := streamInfo.LastSeq
-	if streamInfo.MsgCount == 0 {
-		return nil, nil
+// Uses the pre-recorded sequence bounds from StreamInfo for efficient fetching, narrowed to the
+// stream's selection in opts.Selections, which may also ask for only its last messages.
+// When opts.Parallel > 1 (and no limit is set) the sequence range is split into chunks
+// that are fetched concurrently and merged back in sequence order.
+// Transient errors are retried with backoff, resuming after the last fetched sequence. Ranges
+// that still cannot be fetched are recorded in the returned completeness, and the messages
+// that could be fetched are returned along with the error that stopped the fetch.
+func FetchStreamMessages(ctx context.Context, js jetstream.JetStream, streamInfo StreamInfo, opts FetchOptions) ([]MessageData, FetchCompleteness, error) {
+	sel := opts.selection(streamInfo.Name)
+	full := sel.bounds(streamInfo)
+	tracker := newFetchTracker(js, streamInfo.Name, opts.Retry)
+
+	if streamInfo.MsgCount == 0 || full.First > full.Last {
+		return nil, tracker.completeness(full, nil), nil
 	}
 
 	// Determine how many messages to fetch (this is an upper bound estimate)
-	totalToFetch := int(streamInfo.MsgCount)
-	if limit > 0 && limit < totalToFetch {
-		totalToFetch = limit
+	totalToFetch := int(min(streamInfo.MsgCount, full.Last-full.First+1))
+	if opts.Limit > 0 && opts.Limit < totalToFetch {
+		totalToFetch = opts.Limit
+	}
+	if sel.Last > 0 && sel.Last < totalToFetch {
+		totalToFetch = sel.Last
+	}
+
+	// Progress is reported from concurrent chunk fetchers, so serialize the callbacks
+	var fetched atomic.Int64
+	var progressMu sync.Mutex
+	onMessage := func() {
+		n := fetched.Add(1)
+		if opts.Progress != nil {
+			progressMu.Lock()
+			opts.Progress(int(n), totalToFetch)
+			progressMu.Unlock()
+		}
+	}
+
+	finish := func(messages []MessageData) ([]MessageData, FetchCompleteness, error) {
+		return messages, tracker.completeness(full, messages), tracker.fatal
+	}
+
+	// Resolve the time range to sequence numbers so the range can be split or walked back from
+	// its end, and so ranges that cannot be fetched are recorded from the resolved start
+	r, found, err := timeSeqRange(ctx, js, streamInfo.Name, full, opts, tracker)
+	if err != nil {
+		tracker.giveUp(full, err)
+		return finish(nil)
+	}
+	if !found {
+		return finish(nil)
+	}
+
+	if sel.Last > 0 {
+		return finish(fetchLastMessages(ctx, js, streamInfo.Name, r, sel.Last, opts, tracker, onMessage))
+	}
+
+	// A limit applies to the first messages in sequence order, which only a sequential fetch can honour cheaply
+	chunks := splitSeqRange(r.First, r.Last, opts.Parallel, opts.BatchSize)
+	if opts.Parallel <= 1 || opts.Limit > 0 || len(chunks) <= 1 {
+		return finish(fetchSeqRange(ctx, js, streamInfo.Name, r, opts, tracker, totalToFetch, onMessage))
+	}
+
+	// Each chunk retries on its own and records what it could not fetch, so a failing
+	// chunk does not prevent the others from completing
+	results := make([][]MessageData, len(chunks))
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = fetchSeqRange(ctx, js, streamInfo.Name, chunk, opts, tracker, 0, onMessage)
+		}()
+	}
+	wg.Wait()
+
+	// Merge in sequence order: chunks are contiguous and each chunk is sorted
+	total := 0
+	for _, r := range results {
+		total += len(r)
+	}
+	messages := make([]MessageData, 0, total)
+	for _, r := range results {
+		messages = append(messages, r...)
 	}
 
-	messages := make([]MessageData, 0, totalToFetch)
-	currentSeq := firstSeq
-	useStartTime := startTime != nil // Use start time for the first batch only
+	return finish(messages)
+}
+
+// timeSeqRange trims the sequence range r to the messages stored within the time range of
+// the fetch options, found is false when none are
+func timeSeqRange(ctx context.Context, js jetstream.JetStream, streamName string, r seqRange, opts FetchOptions, tracker *fetchTracker) (seqRange, bool, error) {
+	if opts.StartTime != nil {
+		startSeq, found, err := findStartSeq(ctx, js, streamName, *opts.StartTime, opts, tracker)
+		if err != nil {
+			return r, false, err
+		}
+		if !found || startSeq > r.Last {
+			return r, false, nil
+		}
+		r.First = max(r.First, startSeq)
+	}
+
+	// Likewise trim the range to the end time so nothing is fetched past it
+	if opts.EndTime != nil {
+		afterEndSeq, found, err := findStartSeq(ctx, js, streamName, opts.EndTime.Add(time.Nanosecond), opts, tracker)
+		if err != nil {
+			return r, false, err
+		}
+		if found {
+			if afterEndSeq <= r.First {
+				return r, false, nil
+			}
+			r.Last = min(r.Last, afterEndSeq-1)
+		}
+	}
+	return r, true, nil
+}
+
+// fetchLastMessages fetches the last n messages stored in the sequence range r. Deleted
+// messages leave gaps in the sequences, so it walks back from the end of the range in steps
+// sized by the share of sequences found stored so far, until it has n messages.
+func fetchLastMessages(ctx context.Context, js jetstream.JetStream, streamName string, r seqRange, n int, opts FetchOptions, tracker *fetchTracker, onMessage func()) []MessageData {
+	opts.Limit = 0
+
+	var messages []MessageData
+	var scanned uint64
+	last := r.Last
+	for len(messages) < n {
+		missing := uint64(n - len(messages))
+		span := missing
+		if len(messages) > 0 {
+			span = missing * scanned / uint64(len(messages))
+		} else if scanned > 0 {
+			span = scanned * 2
+		}
+
+		first := r.First
+		if last-r.First+1 > span {
+			first = last - span + 1
+		}
+		step := fetchSeqRange(ctx, js, streamName, seqRange{First: first, Last: last}, opts, tracker, int(min(missing, span)), onMessage)
+		messages = append(step, messages...)
+		scanned += last - first + 1
+
+		if first == r.First || tracker.fatal != nil || ctx.Err() != nil {
+			break
+		}
+		last = first - 1
+	}
+
+	if len(messages) > n {
+		messages = messages[len(messages)-n:]
+	}
+	return messages
+}
+
+// findStartSeq returns the sequence of the first message stored at or after startTime
+func findStartSeq(ctx context.Context, js jetstream.JetStream, streamName string, startTime time.Time, opts FetchOptions, tracker *fetchTracker) (uint64, bool, error) {
+	for attempt := 0; ; attempt++ {
+		seq, found, err := findStartSeqOnce(ctx, js, streamName, startTime, opts)
+		if err == nil {
+			return seq, found, nil
+		}
+		if !tracker.shouldRetry(ctx, err, attempt) {
+			return 0, false, err
+		}
+	}
+}
+
+// findStartSeqOnce makes a single attempt at finding the first sequence at or after startTime
+func findStartSeqOnce(ctx context.Context, js jetstream.JetStream, streamName string, startTime time.Time, opts FetchOptions) (uint64, bool, error) {
+	if err := opts.Throttle.wait(ctx); err != nil {
+		return 0, false, err
+	}
+	if err := opts.InFlight.acquire(ctx); err != nil {
+		return 0, false, err
+	}
+	defer opts.InFlight.release()
+
+	reqStart := time.Now()
+	msgIter, err := jetstreamext.GetBatch(ctx, js, streamName, 1, jetstreamext.GetBatchStartTime(startTime))
+	if err != nil {
+		opts.Throttle.probe(reqStart, 0, 0, true)
+		return 0, false, err
+	}
+	for msg, err := range msgIter {
+		if err != nil {
+			if errors.Is(err, jetstreamext.ErrNoMessages) {
+				// No message at or after the start time
+				opts.Throttle.probe(reqStart, 0, 0, false)
+				return 0, false, nil
+			}
+			opts.Throttle.probe(reqStart, 0, 0, true)
+			return 0, false, err
+		}
+		opts.Throttle.probe(reqStart, 1, int64(len(msg.Data)), false)
+		return msg.Sequence, true, nil
+	}
+	opts.Throttle.probe(reqStart, 0, 0, true)
+	return 0, false, errBatchTimeout
+}
+
+// fetchSeqRange sequentially fetches the messages stored in the sequence range r
+// sizeHint is used to preallocate the result (0 = size of the range, capped at one batch).
+// Errors are retried according to opts.Retry, resuming after the last fetched message;
+// once retries are exhausted the rest of the range is recorded as an error gap in the tracker.
+func fetchSeqRange(ctx context.Context, js jetstream.JetStream, streamName string, r seqRange, opts FetchOptions, tracker *fetchTracker, sizeHint int, onMessage func()) []MessageData {
+	limit := opts.Limit
+	batchSize := opts.BatchSize
+	endTime := opts.EndTime
+
+	if sizeHint <= 0 {
+		sizeHint = int(min(r.Last-r.First+1, uint64(batchSize)))
+	}
+	messages := make([]MessageData, 0, sizeHint)
+	currentSeq := r.First
+	attempt := 0
+	subjects := make(map[string]string) // Interned subjects, streams usually have few distinct ones
+
+	// fail decides whether to retry after an error, recording the unfetched rest of the range if not
+	fail := func(err error) bool {
+		if tracker.shouldRetry(ctx, err, attempt) {
+			attempt++
+			return true
+		}
+		tracker.giveUp(seqRange{First: currentSeq, Last: r.Last}, err)
+		return false
+	}
 
 	for limit == 0 || len(messages) < limit {
-		// Stop if we've passed the recorded last sequence
-		if currentSeq > lastSeq {
+		// Stop if we've passed the end of the range
+		if currentSeq > r.Last {
 			break
 		}
 
 		// Calculate fetch size
-		fetchSize := batchSize
+		fetchSize := opts.Throttle.BatchSize(batchSize)
 		if limit > 0 {
 			remaining := limit - len(messages)
-			if remaining < batchSize {
+			if remaining < fetchSize {
 				fetchSize = remaining
 			}
 		}
 
 		// Build options for GetBatch
-		var opts []jetstreamext.GetBatchOpt
-		if useStartTime {
-			opts = append(opts, jetstreamext.GetBatchStartTime(*startTime))
-			useStartTime = false // Only use start time for the first batch
-		} else {
-			opts = append(opts, jetstreamext.GetBatchSeq(currentSeq))
+		batchOpts := []jetstreamext.GetBatchOpt{jetstreamext.GetBatchSeq(currentSeq)}
+		if maxBytes := opts.Throttle.MaxBytes(); maxBytes > 0 {
+			batchOpts = append(batchOpts, jetstreamext.GetBatchMaxBytes(maxBytes))
+		}
+
+		if err := opts.Throttle.wait(ctx); err != nil {
+			tracker.giveUp(seqRange{First: currentSeq, Last: r.Last}, err)
+			break
+		}
+		if err := opts.InFlight.acquire(ctx); err != nil {
+			tracker.giveUp(seqRange{First: currentSeq, Last: r.Last}, err)
+			break
 		}
 
 		// Fetch batch using GetBatch
-		msgIter, err := jetstreamext.GetBatch(ctx, js, streamName, fetchSize, opts...)
+		reqStart := time.Now()
+		msgIter, err := jetstreamext.GetBatch(ctx, js, streamName, fetchSize, batchOpts...)
 		if err != nil {
-			return messages, err
+			opts.Throttle.record(reqStart, fetchSize, 0, 0, true)
+			opts.InFlight.release()
+			if fail(err) {
+				continue
+			}
+			break
 		}
 
 		batchCount := 0
+		var batchBytes int64
+		var batchErr error
+		noMessages := false
 		var fetchedSeq uint64
 		hitEnd := false
 		for msg, err := range msgIter {
 			if err != nil {
-				// Skip errors (message might have been deleted)
-				continue
+				// No messages at or after the requested sequence (the rest of the range was deleted)
+				if errors.Is(err, jetstreamext.ErrNoMessages) {
+					noMessages = true
+				} else {
+					batchErr = err
+				}
+				// The iterator stops after an error
+				break
 			}
 
 			// Check if message is past end time
@@ -86,24 +522,33 @@ func FetchStreamMessages(ctx context.Context, js jetstream.JetStream, streamInfo
 				break
 			}
 
-			// Stop if we've passed the recorded last sequence
-			if msg.Sequence > lastSeq {
+			// Stop if we've passed the end of the range
+			if msg.Sequence > r.Last {
 				hitEnd = true
 				break
 			}
 
+			subject, ok := subjects[msg.Subject]
+			if !ok {
+				subject = msg.Subject
+				subjects[subject] = subject
+			}
+
 			messages = append(messages, MessageData{
 				StreamName: streamName,
+				Subject:    subject,
 				Sequence:   msg.Sequence,
 				Timestamp:  msg.Time,
 				Size:       len(msg.Data),
 			})
+			if opts.Payload != nil {
+				opts.Payload(messages[len(messages)-1], msg.Data)
+			}
 			fetchedSeq = msg.Sequence
 			batchCount++
+			batchBytes += int64(len(msg.Data))
 
-			if progress != nil {
-				progress(len(messages), totalToFetch)
-			}
+			onMessage()
 
 			// Check if we've hit the limit
 			if limit > 0 && len(messages) >= limit {
@@ -111,13 +556,32 @@ func FetchStreamMessages(ctx context.Context, js jetstream.JetStream, streamInfo
 			}
 		}
 
+		// The iterator ends silently when the request times out, an empty batch
+		// without a "no messages" reply is therefore a timeout
+		if batchErr == nil && batchCount == 0 && !hitEnd && !noMessages {
+			batchErr = errBatchTimeout
+		}
+
+		opts.Throttle.record(reqStart, fetchSize, batchCount, batchBytes, batchErr != nil)
+		opts.InFlight.release()
+
+		// Resume after the last fetched message, whether or not the batch failed part way
+		if batchCount > 0 {
+			currentSeq = fetchedSeq + 1
+		}
+
+		if batchErr != nil {
+			if fail(batchErr) {
+				continue
+			}
+			break
+		}
+		attempt = 0
+
 		// Stop if we hit end time or no messages were fetched
 		if hitEnd || batchCount == 0 {
 			break
 		}
-
-		// Move to next sequence after the last fetched message
-		currentSeq = fetchedSeq + 1
 	}
 
 	// Trim to limit if needed
@@ -125,5 +589,5 @@ func FetchStreamMessages(ctx context.Context, js jetstream.JetStream, streamInfo
 		messages = messages[:limit]
 	}
 
-	return messages, nil
+	return messages
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// AnomalyKind is the type of deviation from a stream's rolling baseline
+type AnomalyKind string
+
+const (
+	// AnomalySpike is a run of buckets well above the rolling baseline
+	AnomalySpike AnomalyKind = "spike"
+	// AnomalyDrop is a run of empty buckets where the baseline expects traffic
+	AnomalyDrop AnomalyKind = "drop"
+	// AnomalyLevelShift is a lasting change of the baseline itself
+	AnomalyLevelShift AnomalyKind = "level-shift"
+)
+
+// madScale turns a median absolute deviation into a standard deviation estimate for normal data
+const madScale = 1.4826
+
+// minLevelShiftChange is the relative change of the median needed for a level shift
+const minLevelShiftChange = 0.5
+
+// AnomalyOptions controls anomaly detection
+type AnomalyOptions struct {
+	Window    int     // buckets in the rolling baseline
+	Threshold float64 // deviation from the baseline median, in scaled MADs, to flag a bucket
+}
+
+// Anomaly is a deviation of the stored rate from the rolling baseline
+type Anomaly struct {
+	Kind     AnomalyKind
+	Start    time.Time
+	End      time.Time // equals Start for level shifts
+	Buckets  int       // anomalous buckets, or the buckets compared on either side of a level shift
+	Rate     float64   // peak rate of a spike, 0 for a drop, median after a level shift
+	Baseline float64   // baseline median rate before the anomaly
+	Score    float64   // largest deviation from the baseline, in scaled MADs
+}
+
+// DetectAnomalies flags spikes, drops to zero and level shifts in the stored rate of a
+// histogram. The baseline of each bucket is the median and median absolute deviation (MAD)
+// of the buckets before it, which unlike a mean is not dragged along by the anomalies
+// themselves. Anomalies are sorted by start time.
+func DetectAnomalies(hist *RateHistogram, opts AnomalyOptions) []Anomaly {
+	if hist == nil || opts.Window < 2 || len(hist.Buckets) <= opts.Window/2 {
+		return nil
+	}
+
+	buckets := hist.Buckets
+	rates := make([]float64, len(buckets))
+	for i, b := range buckets {
+		rates[i] = b.Rate
+	}
+
+	// One message per bucket more or less is never an anomaly, this also keeps a flat
+	// baseline (zero MAD) from flagging every small wobble
+	minScale := 1 / hist.Layout.Nominal().Seconds()
+	scratch := make([]float64, 0, opts.Window)
+
+	var anomalies []Anomaly
+	var open *Anomaly
+
+	// Start once half a window of history is available
+	for i := opts.Window / 2; i < len(rates); i++ {
+		rate := rates[i]
+		median, mad := medianMAD(rates[max(0, i-opts.Window):i], scratch)
+		scale := max(madScale*mad, minScale)
+
+		var kind AnomalyKind
+		switch {
+		case rate > median+opts.Threshold*scale:
+			kind = AnomalySpike
+		case rate == 0 && median > opts.Threshold*scale:
+			kind = AnomalyDrop
+		default:
+			open = nil
+			continue
+		}
+		score := math.Abs(rate-median) / scale
+
+		// Consecutive anomalous buckets of the same kind are one anomaly
+		if open != nil && open.Kind == kind {
+			open.End = buckets[i].End
+			open.Buckets++
+			open.Rate = max(open.Rate, rate)
+			open.Score = max(open.Score, score)
+			continue
+		}
+
+		anomalies = append(anomalies, Anomaly{
+			Kind:     kind,
+			Start:    buckets[i].Start,
+			End:      buckets[i].End,
+			Buckets:  1,
+			Rate:     rate,
+			Baseline: median,
+			Score:    score,
+		})
+		open = &anomalies[len(anomalies)-1]
+	}
+
+	// The rolling baseline needs half a window to catch up with a level shift, the
+	// buckets flagged in the meantime are part of the shift rather than anomalies of their own
+	shifts := detectLevelShifts(rates, opts.Window, opts.Threshold, minScale, scratch)
+	anomalies = slices.DeleteFunc(anomalies, func(a Anomaly) bool {
+		for _, i := range shifts {
+			settled := buckets[min(i+opts.Window/2, len(buckets)-1)].End
+			if !a.Start.Before(buckets[i].Start) && a.Start.Before(settled) {
+				return true
+			}
+		}
+		return false
+	})
+
+	for _, i := range shifts {
+		before, mad := medianMAD(rates[i-opts.Window:i], scratch)
+		after, _ := medianMAD(rates[i:i+opts.Window], scratch)
+		anomalies = append(anomalies, Anomaly{
+			Kind:     AnomalyLevelShift,
+			Start:    buckets[i].Start,
+			End:      buckets[i].Start,
+			Buckets:  opts.Window,
+			Rate:     after,
+			Baseline: before,
+			Score:    math.Abs(after-before) / max(madScale*mad, minScale),
+		})
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Start.Before(anomalies[j].Start)
+	})
+
+	return anomalies
+}
+
+// detectLevelShifts returns the bucket indices where the level of the rates shifts. A shift
+// is flagged where the median of the window starting at a bucket differs from the median of
+// the window before it by more than the threshold and by at least half of the old level.
+// Each run of flagged buckets is one shift, located where the difference of the window
+// means peaks, which unlike the medians is sharpest at the actual change.
+func detectLevelShifts(rates []float64, window int, threshold float64, minScale float64, scratch []float64) []int {
+	var shifts []int
+	inRun := false
+	bestDiff := 0.0
+
+	// Running sums for the window means
+	sumBefore, sumAfter := 0.0, 0.0
+	for i := 0; i < window && i < len(rates); i++ {
+		sumBefore += rates[i]
+	}
+	for i := window; i < 2*window && i < len(rates); i++ {
+		sumAfter += rates[i]
+	}
+
+	for i := window; i+window <= len(rates); i++ {
+		if i > window {
+			sumBefore += rates[i-1] - rates[i-window-1]
+			sumAfter += rates[i+window-1] - rates[i-1]
+		}
+
+		before, mad := medianMAD(rates[i-window:i], scratch)
+		after, _ := medianMAD(rates[i:i+window], scratch)
+		change := math.Abs(after - before)
+		if change <= threshold*max(madScale*mad, minScale) || change < minLevelShiftChange*before {
+			inRun = false
+			continue
+		}
+
+		diff := math.Abs(sumAfter-sumBefore) / float64(window)
+		switch {
+		case !inRun && len(shifts) > 0 && i < shifts[len(shifts)-1]+window:
+			// Still within the window of the previous shift
+		case !inRun:
+			shifts = append(shifts, i)
+			bestDiff = diff
+			inRun = true
+		case diff > bestDiff:
+			shifts[len(shifts)-1] = i
+			bestDiff = diff
+		}
+	}
+
+	return shifts
+}
+
+// medianMAD returns the median and median absolute deviation of values, using scratch as
+// working space so the values are left untouched
+func medianMAD(values []float64, scratch []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	scratch = append(scratch[:0], values...)
+	sort.Float64s(scratch)
+	median := percentileFloat64(scratch, 0.5)
+
+	for i, v := range values {
+		scratch[i] = math.Abs(v - median)
+	}
+	sort.Float64s(scratch)
+
+	return median, percentileFloat64(scratch, 0.5)
+}
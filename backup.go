@@ -0,0 +1,654 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// Files of a `nats stream backup` directory and of a JetStream file store
+const (
+	backupMetaFile  = "backup.json"
+	backupDataFile  = "stream.tar.s2"
+	storeMetaFile   = "meta.inf"
+	storeMetaKey    = "meta.key"
+	storeStateFile  = "index.db"
+	storeMsgDir     = "msgs"
+	storeErrorsFile = "errors.txt"
+)
+
+// archiveMagic starts a snapshot in the archive format of nats-server 2.14 and later, older
+// snapshots are a tar of the file store
+const archiveMagic = "NATSARC1"
+
+// Message block records, see the nats-server file store
+const (
+	blockRecordHeader = 22      // length, sequence, timestamp and subject length
+	blockRecordHash   = 8       // checksum at the end of every record
+	blockHeaderBit    = 1 << 31 // record length flag for messages with headers
+	blockEraseBit     = 1 << 63 // sequence flag for erased records
+	blockTombstoneBit = 1 << 62 // sequence flag for delete markers
+)
+
+// index.db and its delete maps, see the nats-server file store and avl sequence sets
+const (
+	storeStateMagic      = 11
+	storeStateMaxVersion = 4
+	seqSetMagic          = 22
+	seqSetBucketBits     = 64
+)
+
+// Backup is a stream read from a `nats stream backup` archive or a file store directory
+type Backup struct {
+	Path     string
+	Format   string
+	Info     StreamInfo
+	Messages []MessageData // sorted by sequence
+}
+
+// backupMeta is the part of backup.json, the snapshot response saved next to the archive,
+// and of the file store meta.inf that is used
+type backupMeta struct {
+	Config *backupStreamConfig `json:"config"`
+	State  *backupStreamState  `json:"state"`
+}
+
+type backupStreamConfig struct {
+	Name                 string `json:"name"`
+	MaxMsgsPerSubject    int64  `json:"max_msgs_per_subject"`
+	Discard              string `json:"discard"`
+	DiscardNewPerSubject bool   `json:"discard_new_per_subject"`
+}
+
+type backupStreamState struct {
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+}
+
+// ReadBackup reads the messages of a stream from a `nats stream backup` directory, its
+// stream.tar.s2 archive or a file store directory of a stopped server.
+// Only the sequence, timestamp, subject and payload size of each message are kept.
+func ReadBackup(p string) (*Backup, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backup{Path: p}
+	var meta backupMeta
+	var records []MessageData
+	switch {
+	case !fi.IsDir():
+		meta, _ = readBackupMeta(filepath.Join(filepath.Dir(p), backupMetaFile))
+		records, err = readSnapshot(p, b, &meta)
+	case fileExists(filepath.Join(p, backupDataFile)):
+		meta, err = readBackupMeta(filepath.Join(p, backupMetaFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		records, err = readSnapshot(filepath.Join(p, backupDataFile), b, &meta)
+	case fileExists(filepath.Join(p, storeMsgDir)):
+		records, err = readFileStore(p, b, &meta)
+	default:
+		return nil, fmt.Errorf("%s is neither a stream backup nor a file store directory", p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %w", p, err)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Sequence < records[j].Sequence })
+	b.Messages = records
+	b.Info = backupStreamInfo(p, meta, records)
+	for i := range b.Messages {
+		b.Messages[i].StreamName = b.Info.Name
+	}
+	return b, nil
+}
+
+// Fetch returns the messages within the time range, selection and limit of the fetch
+// options, like FetchStreamMessages does for a live stream
+func (b *Backup) Fetch(opts FetchOptions) ([]MessageData, FetchCompleteness) {
+	sel := opts.selection(b.Info.Name)
+	full := sel.bounds(b.Info)
+
+	var messages []MessageData
+	for _, msg := range b.Messages {
+		if msg.Sequence < full.First || msg.Sequence > full.Last {
+			continue
+		}
+		if opts.StartTime != nil && msg.Timestamp.Before(*opts.StartTime) {
+			continue
+		}
+		if opts.EndTime != nil && msg.Timestamp.After(*opts.EndTime) {
+			continue
+		}
+		messages = append(messages, msg)
+		if opts.Limit > 0 && len(messages) >= opts.Limit {
+			break
+		}
+	}
+	if sel.Last > 0 && len(messages) > sel.Last {
+		messages = messages[len(messages)-sel.Last:]
+	}
+
+	return messages, newFetchTracker(nil, b.Info.Name, opts.Retry).completeness(full, messages)
+}
+
+// BackupSource is a message source that reads the streams from backups instead of a server
+func BackupSource(backups []*Backup) MessageSource {
+	return func(_ context.Context, si StreamInfo, opts FetchOptions) ([]MessageData, FetchCompleteness, error) {
+		for _, b := range backups {
+			if b.Info.Name == si.Name {
+				messages, fc := b.Fetch(opts)
+				return messages, fc, nil
+			}
+		}
+		return nil, FetchCompleteness{StreamName: si.Name}, fmt.Errorf("no backup of stream %s", si.Name)
+	}
+}
+
+// backupStreamInfo derives the stream metadata from the messages read. The stream is named
+// after its configuration when the backup has one, otherwise after the backup.
+func backupStreamInfo(p string, meta backupMeta, messages []MessageData) StreamInfo {
+	si := StreamInfo{Name: strings.TrimSuffix(filepath.Base(filepath.Clean(p)), ".tar.s2")}
+	if filepath.Base(p) == backupDataFile {
+		si.Name = filepath.Base(filepath.Dir(filepath.Clean(p)))
+	}
+	if meta.Config != nil && meta.Config.Name != "" {
+		si.Name = meta.Config.Name
+	}
+	if len(messages) == 0 {
+		return si
+	}
+
+	first, last := messages[0], messages[len(messages)-1]
+	si.FirstSeq, si.LastSeq = first.Sequence, last.Sequence
+	si.MsgCount = uint64(len(messages))
+	si.NumDeleted = int(last.Sequence - first.Sequence + 1 - uint64(len(messages)))
+	for _, msg := range messages {
+		if si.FirstTimestamp.IsZero() || msg.Timestamp.Before(si.FirstTimestamp) {
+			si.FirstTimestamp = msg.Timestamp
+		}
+		if msg.Timestamp.After(si.LastTimestamp) {
+			si.LastTimestamp = msg.Timestamp
+		}
+	}
+
+	// The per-subject counts are known exactly, all messages are at hand
+	if cfg := meta.Config; cfg != nil && cfg.MaxMsgsPerSubject > 0 && !(cfg.Discard == "new" && cfg.DiscardNewPerSubject) {
+		si.MaxMsgsPerSubject = cfg.MaxMsgsPerSubject
+		si.SubjectCounts = make(map[string]uint64)
+		for _, msg := range messages {
+			si.SubjectCounts[msg.Subject]++
+		}
+	}
+	return si
+}
+
+// readBackupMeta reads the stream configuration and state saved with a backup
+func readBackupMeta(filename string) (backupMeta, error) {
+	var meta backupMeta
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("invalid %s: %w", filename, err)
+	}
+	return meta, nil
+}
+
+// readSnapshot reads an s2 compressed snapshot in either archive format
+func readSnapshot(filename string, b *Backup, meta *backupMeta) ([]MessageData, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(s2.NewReader(bufio.NewReader(f)))
+	magic, err := r.Peek(len(archiveMagic))
+	if err != nil {
+		return nil, fmt.Errorf("not an s2 compressed snapshot: %w", err)
+	}
+	if string(magic) == archiveMagic {
+		b.Format = "snapshot archive"
+		return readSnapshotArchive(r)
+	}
+	b.Format = "snapshot tar"
+	return readSnapshotTar(r, meta)
+}
+
+// readSnapshotArchive reads a snapshot in the archive format: a state record, one record per
+// consumer, then one record per message with its subject as name, closed by an empty record
+func readSnapshotArchive(r *bufio.Reader) ([]MessageData, error) {
+	if _, err := r.Discard(len(archiveMagic)); err != nil {
+		return nil, err
+	}
+
+	var messages []MessageData
+	for {
+		nameLen, err := binary.ReadUvarint(r)
+		if errors.Is(err, io.EOF) {
+			fmt.Printf("Warning: snapshot ends without its end marker, it may be truncated (%d messages read)\n", len(messages))
+			return messages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		var fields [3]uint64 // sequence, header size and payload size
+		for i := range fields {
+			if fields[i], err = binary.ReadUvarint(r); err != nil {
+				return nil, noEOF(err)
+			}
+		}
+		seq, hdrSize, payloadSize := fields[0], fields[1], fields[2]
+		if nameLen > 1<<20 || hdrSize > 1<<40 || payloadSize > 1<<40 {
+			return nil, fmt.Errorf("invalid archive record after %d messages", len(messages))
+		}
+
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, noEOF(err)
+		}
+		if nameLen == 0 && seq == 0 && hdrSize+payloadSize == 0 {
+			return messages, nil
+		}
+		if _, err := r.Discard(int(hdrSize + payloadSize)); err != nil {
+			return nil, noEOF(err)
+		}
+
+		// State and consumer records have no sequence
+		if seq == 0 {
+			continue
+		}
+		messages = append(messages, MessageData{
+			Subject:   string(name),
+			Sequence:  seq,
+			Timestamp: time.Unix(0, ts),
+			Size:      int(payloadSize),
+		})
+	}
+}
+
+// noEOF turns an end of file in the middle of a record into an error
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readSnapshotTar reads a snapshot that is a tar of the file store with decrypted and
+// decompressed message blocks
+func readSnapshotTar(r io.Reader, meta *backupMeta) ([]MessageData, error) {
+	store := newStoreReader()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch name := hdr.Name; {
+		case name == storeErrorsFile:
+			msg, _ := io.ReadAll(tr)
+			return nil, fmt.Errorf("the snapshot failed on the server: %s", strings.TrimSpace(string(msg)))
+		case name == storeMetaFile && meta.Config == nil:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			meta.Config = parseStoreMeta(data)
+		case name == path.Join(storeMsgDir, storeStateFile):
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			store.readState(data)
+		case path.Dir(name) == storeMsgDir && path.Ext(name) == ".blk":
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			store.readBlock(name, data)
+		}
+	}
+	return store.messages(meta.State), nil
+}
+
+// readFileStore reads the stream directory of a file store. Encrypted stores cannot be read,
+// a snapshot of them is decrypted by the server.
+func readFileStore(dir string, b *Backup, meta *backupMeta) ([]MessageData, error) {
+	b.Format = "file store"
+	msgDir := filepath.Join(dir, storeMsgDir)
+	keys, _ := filepath.Glob(filepath.Join(msgDir, "*.key"))
+	if fileExists(filepath.Join(dir, storeMetaKey)) || len(keys) > 0 {
+		return nil, fmt.Errorf("the file store is encrypted, use a stream backup instead")
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, storeMetaFile)); err == nil {
+		meta.Config = parseStoreMeta(data)
+	}
+
+	store := newStoreReader()
+	if data, err := os.ReadFile(filepath.Join(msgDir, storeStateFile)); err == nil {
+		store.readState(data)
+	}
+
+	blocks, err := filepath.Glob(filepath.Join(msgDir, "*.blk"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range blocks {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		store.readBlock(name, data)
+	}
+	return store.messages(nil), nil
+}
+
+// parseStoreMeta parses the stream configuration of meta.inf, nil if it is not readable
+func parseStoreMeta(data []byte) *backupStreamConfig {
+	var cfg backupStreamConfig
+	if json.Unmarshal(data, &cfg) != nil {
+		return nil
+	}
+	return &cfg
+}
+
+// storeReader collects the records of message blocks and decides which of them are still
+// stored: a record can remain in its block after the message was removed
+type storeReader struct {
+	records    []MessageData
+	tombstones map[uint64]bool
+	state      *storeState
+}
+
+// storeState is the part of index.db that tells which sequences each block still stores
+type storeState struct {
+	blocks  []seqRange
+	deleted map[uint64]bool
+	last    uint64
+}
+
+func newStoreReader() *storeReader {
+	return &storeReader{tombstones: make(map[uint64]bool)}
+}
+
+// readBlock reads the records of a message block, a corrupt record ends the block with a warning
+func (s *storeReader) readBlock(name string, data []byte) {
+	buf, err := decompressBlock(data)
+	if err != nil {
+		fmt.Printf("Warning: skipping message block %s: %v\n", name, err)
+		return
+	}
+
+	le := binary.LittleEndian
+	for offset := 0; offset < len(buf); {
+		rec := buf[offset:]
+		if len(rec) < blockRecordHeader+blockRecordHash {
+			fmt.Printf("Warning: message block %s ends with a partial record\n", name)
+			return
+		}
+		rl := le.Uint32(rec)
+		hasHeaders := rl&blockHeaderBit != 0
+		rl &^= blockHeaderBit
+		slen := int(le.Uint16(rec[20:]))
+		dlen := int(rl) - blockRecordHeader - blockRecordHash
+		if int(rl) > len(rec) || dlen < slen {
+			fmt.Printf("Warning: message block %s has a corrupt record at offset %d\n", name, offset)
+			return
+		}
+		offset += int(rl)
+
+		seq := le.Uint64(rec[4:])
+		switch {
+		case seq&blockEraseBit != 0:
+			continue
+		case seq&blockTombstoneBit != 0:
+			s.tombstones[seq&^blockTombstoneBit] = true
+			continue
+		}
+
+		size := dlen - slen
+		if hasHeaders && dlen >= slen+4 {
+			size -= 4 + int(le.Uint32(rec[blockRecordHeader+slen:]))
+		}
+		s.records = append(s.records, MessageData{
+			Subject:   string(rec[blockRecordHeader : blockRecordHeader+slen]),
+			Sequence:  seq,
+			Timestamp: time.Unix(0, int64(le.Uint64(rec[12:]))),
+			Size:      max(size, 0),
+		})
+	}
+}
+
+// decompressBlock undoes the compression of a block compressed at rest. The checksum of the
+// last record follows the compressed body uncompressed.
+func decompressBlock(data []byte) ([]byte, error) {
+	const s2Algorithm = 1
+	if len(data) < 5 || string(data[:3]) != "cmp" || data[3] != s2Algorithm {
+		return data, nil
+	}
+	_, n := binary.Uvarint(data[4:])
+	if n <= 0 || len(data) < 4+n+blockRecordHash {
+		return nil, fmt.Errorf("invalid compression header")
+	}
+	body := data[4+n : len(data)-blockRecordHash]
+	out, err := io.ReadAll(s2.NewReader(bytes.NewReader(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return append(out, data[len(data)-blockRecordHash:]...), nil
+}
+
+// readState reads the first and last sequence and the deleted sequences of every block from
+// index.db. Without it only removals that left a delete marker are known.
+func (s *storeReader) readState(data []byte) {
+	state, err := parseStoreState(data)
+	if err != nil {
+		fmt.Printf("Warning: ignoring %s: %v\n", storeStateFile, err)
+		return
+	}
+	s.state = state
+}
+
+// messages returns the records still stored. Sequences past the blocks in index.db were
+// written after it and are taken as stored, as are all records without an index.db, only
+// limited by the first sequence of the stream state when known.
+func (s *storeReader) messages(state *backupStreamState) []MessageData {
+	var messages []MessageData
+	for _, rec := range s.records {
+		if s.tombstones[rec.Sequence] {
+			continue
+		}
+		if state != nil && rec.Sequence < state.FirstSeq {
+			continue
+		}
+		if s.state != nil && !s.state.stored(rec.Sequence) {
+			continue
+		}
+		messages = append(messages, rec)
+	}
+	return messages
+}
+
+// stored reports whether index.db has the sequence as stored
+func (st *storeState) stored(seq uint64) bool {
+	if seq > st.last {
+		return true
+	}
+	if st.deleted[seq] {
+		return false
+	}
+	for _, r := range st.blocks {
+		if seq >= r.First && seq <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStoreState parses index.db: a magic and version byte, varint encoded stream state and
+// per-subject totals, then every block with its sequence range and delete map, and a checksum
+func parseStoreState(data []byte) (*storeState, error) {
+	if len(data) < 2+blockRecordHash || data[0] != storeStateMagic {
+		return nil, fmt.Errorf("unknown format, the store may be encrypted")
+	}
+	version := data[1]
+	if version < 1 || version > storeStateMaxVersion {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+	buf := data[2 : len(data)-blockRecordHash]
+
+	bi := 0
+	bad := false
+	readU64 := func() uint64 {
+		if bad {
+			return 0
+		}
+		v, n := binary.Uvarint(buf[bi:])
+		if n <= 0 {
+			bad = true
+			return 0
+		}
+		bi += n
+		return v
+	}
+	readI64 := func() int64 {
+		if bad {
+			return 0
+		}
+		v, n := binary.Varint(buf[bi:])
+		if n <= 0 {
+			bad = true
+			return 0
+		}
+		bi += n
+		return v
+	}
+
+	// Messages, bytes, first sequence and time, last sequence and time
+	readU64()
+	readU64()
+	readU64()
+	readI64()
+	readU64()
+	readI64()
+
+	for numSubjects := readU64(); numSubjects > 0 && !bad; numSubjects-- {
+		lsubj := readU64()
+		if lsubj > uint64(len(buf)-bi) {
+			return nil, fmt.Errorf("invalid subject length")
+		}
+		bi += int(lsubj)
+		total := readU64()
+		readU64() // first block
+		if total > 1 || version >= 4 {
+			readU64() // last block
+		}
+	}
+
+	st := &storeState{deleted: make(map[uint64]bool)}
+	for numBlocks := readU64(); numBlocks > 0 && !bad; numBlocks-- {
+		readU64() // index
+		readU64() // bytes
+		first := readU64()
+		readI64()
+		last := readU64()
+		readI64()
+		numDeleted := readU64()
+		if version >= 2 {
+			readU64() // messages with a TTL
+		}
+		if version >= 3 {
+			readU64() // scheduled messages
+		}
+		if bad {
+			break
+		}
+		if numDeleted > 0 {
+			n, err := decodeSeqSet(buf[bi:], st.deleted)
+			if err != nil {
+				return nil, err
+			}
+			bi += n
+		}
+		st.blocks = append(st.blocks, seqRange{First: first, Last: last})
+		st.last = max(st.last, last)
+	}
+	if bad {
+		return nil, fmt.Errorf("truncated state")
+	}
+	return st, nil
+}
+
+// decodeSeqSet adds the sequences of an encoded sequence set to set and returns the encoded
+// length: a magic and version byte, the node count and size, then per node its base sequence,
+// the bitmap buckets and the node height
+func decodeSeqSet(buf []byte, set map[uint64]bool) (int, error) {
+	if len(buf) < 10 || buf[0] != seqSetMagic {
+		return 0, fmt.Errorf("invalid delete map")
+	}
+	buckets := 0
+	switch buf[1] {
+	case 1:
+		buckets = 64
+	case 2:
+		buckets = 32
+	default:
+		return 0, fmt.Errorf("unsupported delete map version %d", buf[1])
+	}
+
+	le := binary.LittleEndian
+	nodes := int(le.Uint32(buf[2:]))
+	nodeLen := 8 + buckets*8 + 2
+	if nodes < 0 || nodes > (len(buf)-10)/nodeLen {
+		return 0, fmt.Errorf("invalid delete map")
+	}
+	index := 10
+	for range nodes {
+		base := le.Uint64(buf[index:])
+		for b := range buckets {
+			bits := le.Uint64(buf[index+8+b*8:])
+			for bit := 0; bits != 0; bit++ {
+				if bits&1 != 0 {
+					set[base+uint64(b*seqSetBucketBits+bit)] = true
+				}
+				bits >>= 1
+			}
+		}
+		index += nodeLen
+	}
+	return index, nil
+}
+
+// fileExists reports whether a file or directory exists
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
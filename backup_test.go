@@ -0,0 +1,411 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// The fixtures in testdata were written by nats-server 2.15. PLAIN has one uncompressed block
+// with headers, erased and plain deletes. PACKED has s2 compressed blocks, 20 messages removed
+// by its max_msgs limit and deletes in sealed blocks. backup holds their `nats stream backup`
+// directories, filestore their stream directories after a clean shutdown, and <stream>.txt the
+// messages the server returned for them: sequence, subject, payload size and timestamp.
+var backupFixtures = []string{"PLAIN", "PACKED"}
+
+func fixtureMessages(t *testing.T, stream string) []MessageData {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", stream+".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []MessageData
+	for line := range strings.Lines(string(data)) {
+		var fields [3]int64
+		parts := strings.Fields(line)
+		if len(parts) != 4 {
+			t.Fatalf("invalid fixture line %q", line)
+		}
+		for i, p := range []string{parts[0], parts[2], parts[3]} {
+			if fields[i], err = strconv.ParseInt(p, 10, 64); err != nil {
+				t.Fatalf("invalid fixture line %q: %v", line, err)
+			}
+		}
+		messages = append(messages, MessageData{
+			StreamName: stream,
+			Subject:    parts[1],
+			Sequence:   uint64(fields[0]),
+			Size:       int(fields[1]),
+			Timestamp:  time.Unix(0, fields[2]),
+		})
+	}
+	return messages
+}
+
+func checkMessages(t *testing.T, source string, got, want []MessageData) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: read %d messages, want %d", source, len(got), len(want))
+		return
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.StreamName != w.StreamName || g.Subject != w.Subject || g.Sequence != w.Sequence || g.Size != w.Size || !g.Timestamp.Equal(w.Timestamp) {
+			t.Errorf("%s: message %d = %+v, want %+v", source, i, g, w)
+			return
+		}
+	}
+}
+
+// fileStoreTar writes the file store of a fixture as a snapshot of nats-server 2.13 and
+// earlier: an s2 compressed tar of meta.inf and the msgs directory
+func fileStoreTar(t *testing.T, stream string) string {
+	t.Helper()
+	dir := filepath.Join("testdata", "filestore", stream)
+	files, err := filepath.Glob(filepath.Join(dir, storeMsgDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	enc := s2.NewWriter(&buf)
+	tw := tar.NewWriter(enc)
+	for _, name := range append([]string{filepath.Join(dir, storeMetaFile)}, files...) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(dir, name)
+		if err := tw.WriteHeader(&tar.Header{Name: filepath.ToSlash(rel), Mode: 0600, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), stream+".tar.s2")
+	if err := os.WriteFile(name, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// copyFileStore copies the file store of a fixture without the given files of its msgs directory
+func copyFileStore(t *testing.T, stream string, skip ...string) string {
+	t.Helper()
+	src := filepath.Join("testdata", "filestore", stream)
+	dst := filepath.Join(t.TempDir(), stream)
+	if err := os.MkdirAll(filepath.Join(dst, storeMsgDir), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(src, storeMsgDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range append(files, filepath.Join(src, storeMetaFile)) {
+		if slices.Contains(skip, filepath.Base(name)) {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(src, name)
+		if err := os.WriteFile(filepath.Join(dst, rel), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dst
+}
+
+func TestReadBackup(t *testing.T) {
+	for _, stream := range backupFixtures {
+		want := fixtureMessages(t, stream)
+
+		tests := []struct {
+			path   string
+			format string
+		}{
+			{filepath.Join("testdata", "backup", stream), "snapshot archive"},
+			{filepath.Join("testdata", "backup", stream, backupDataFile), "snapshot archive"},
+			{filepath.Join("testdata", "filestore", stream), "file store"},
+			{fileStoreTar(t, stream), "snapshot tar"},
+		}
+
+		for _, tt := range tests {
+			b, err := ReadBackup(tt.path)
+			if err != nil {
+				t.Errorf("ReadBackup(%s): %v", tt.path, err)
+				continue
+			}
+			if b.Format != tt.format {
+				t.Errorf("ReadBackup(%s) format = %q, want %q", tt.path, b.Format, tt.format)
+			}
+			if b.Info.Name != stream {
+				t.Errorf("ReadBackup(%s) stream = %q, want %q", tt.path, b.Info.Name, stream)
+			}
+			checkMessages(t, tt.path, b.Messages, want)
+		}
+	}
+}
+
+func TestReadFileStoreWithoutState(t *testing.T) {
+	// Deletes leave a tombstone, removals by the limits do not and come back without index.db
+	removed := map[string]uint64{"PLAIN": 0, "PACKED": 20}
+
+	for _, stream := range backupFixtures {
+		dir := copyFileStore(t, stream, storeStateFile)
+		b, err := ReadBackup(dir)
+		if err != nil {
+			t.Errorf("ReadBackup(%s): %v", dir, err)
+			continue
+		}
+
+		want := fixtureMessages(t, stream)
+		if len(b.Messages) != len(want)+int(removed[stream]) {
+			t.Errorf("%s without %s: read %d messages, want %d", stream, storeStateFile, len(b.Messages), len(want)+int(removed[stream]))
+			continue
+		}
+		for i, msg := range b.Messages[:removed[stream]] {
+			if msg.Sequence != uint64(i+1) {
+				t.Errorf("%s without %s: message %d has sequence %d, want %d", stream, storeStateFile, i, msg.Sequence, i+1)
+			}
+		}
+		checkMessages(t, stream, b.Messages[removed[stream]:], want)
+	}
+}
+
+func TestReadBlock(t *testing.T) {
+	tests := []struct {
+		stream     string
+		blocks     []string
+		tombstones []uint64
+		erased     []uint64
+		records    int
+	}{
+		// 40 messages, 1 and 11 deleted, 10 and 20 erased
+		{"PLAIN", []string{"1.blk"}, []uint64{1, 10, 11, 20}, []uint64{10, 20}, 38},
+		// 300 messages in three compressed blocks and the last, 121 erased
+		{"PACKED", []string{"1.blk", "2.blk", "3.blk", "4.blk"}, []uint64{30, 31, 32, 120, 121, 250}, []uint64{121}, 299},
+	}
+
+	for _, tt := range tests {
+		s := newStoreReader()
+		for _, name := range tt.blocks {
+			data, err := os.ReadFile(filepath.Join("testdata", "filestore", tt.stream, storeMsgDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.readBlock(name, data)
+		}
+
+		if len(s.records) != tt.records {
+			t.Errorf("%s: read %d records, want %d", tt.stream, len(s.records), tt.records)
+		}
+		var tombstones []uint64
+		for seq := range s.tombstones {
+			tombstones = append(tombstones, seq)
+		}
+		slices.Sort(tombstones)
+		if !slices.Equal(tombstones, tt.tombstones) {
+			t.Errorf("%s: tombstones %v, want %v", tt.stream, tombstones, tt.tombstones)
+		}
+		for _, rec := range s.records {
+			if slices.Contains(tt.erased, rec.Sequence) {
+				t.Errorf("%s: erased record %d was read", tt.stream, rec.Sequence)
+			}
+		}
+	}
+}
+
+func TestReadBlockTruncated(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "filestore", "PLAIN", storeMsgDir, "1.blk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The records before the cut are kept
+	s := newStoreReader()
+	s.readBlock("1.blk", data[:len(data)/2])
+	if len(s.records) == 0 || len(s.records) >= 38 {
+		t.Errorf("read %d records of a truncated block, want some of 38", len(s.records))
+	}
+	for i, rec := range s.records {
+		if rec.Subject == "" || rec.Sequence == 0 || (i > 0 && rec.Sequence <= s.records[i-1].Sequence) {
+			t.Errorf("invalid record %+v in a truncated block", rec)
+		}
+	}
+
+	s = newStoreReader()
+	s.readBlock("1.blk", []byte("cmp\x01\xff"))
+	if len(s.records) != 0 {
+		t.Errorf("read %d records of a block with an invalid compression header", len(s.records))
+	}
+}
+
+func TestParseStoreState(t *testing.T) {
+	tests := []struct {
+		stream  string
+		blocks  []seqRange
+		deleted []uint64
+	}{
+		{"PLAIN", []seqRange{{2, 40}}, []uint64{10, 11, 20}},
+		{"PACKED", []seqRange{{21, 95}, {96, 187}, {188, 276}, {277, 300}}, []uint64{30, 31, 32, 120, 121, 250}},
+	}
+
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", "filestore", tt.stream, storeMsgDir, storeStateFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, err := parseStoreState(data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.stream, err)
+			continue
+		}
+		if !slices.Equal(st.blocks, tt.blocks) {
+			t.Errorf("%s: blocks %v, want %v", tt.stream, st.blocks, tt.blocks)
+		}
+		var deleted []uint64
+		for seq := range st.deleted {
+			deleted = append(deleted, seq)
+		}
+		slices.Sort(deleted)
+		if !slices.Equal(deleted, tt.deleted) {
+			t.Errorf("%s: deleted %v, want %v", tt.stream, deleted, tt.deleted)
+		}
+		if st.last != tt.blocks[len(tt.blocks)-1].Last {
+			t.Errorf("%s: last sequence %d, want %d", tt.stream, st.last, tt.blocks[len(tt.blocks)-1].Last)
+		}
+	}
+}
+
+func TestParseStoreStateErrors(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "filestore", "PACKED", storeMsgDir, storeStateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := slices.Clone(data)
+	version[1] = storeStateMaxVersion + 1
+	tests := map[string][]byte{
+		"empty":      nil,
+		"encrypted":  append([]byte{0xa7}, data[1:]...),
+		"version":    version,
+		"truncated":  data[:40],
+		"delete map": append(slices.Clone(data[:len(data)/2]), make([]byte, blockRecordHash)...),
+		"short":      data[:2+blockRecordHash-1],
+	}
+	for name, data := range tests {
+		if st, err := parseStoreState(data); err == nil {
+			t.Errorf("parseStoreState(%s) = %+v, want an error", name, st)
+		}
+	}
+}
+
+func TestDecodeSeqSet(t *testing.T) {
+	// One node of version 2 with 32 buckets at base 128: bits 0 and 63 of the first bucket
+	// and bit 1 of the last
+	node := make([]byte, 10+8+32*8+2)
+	node[0], node[1] = seqSetMagic, 2
+	node[2] = 1
+	node[10] = 128
+	node[18] = 1
+	node[25] = 0x80
+	node[18+31*8] = 2
+	set := make(map[uint64]bool)
+	n, err := decodeSeqSet(append(node, 0xff), set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(node) {
+		t.Errorf("decodeSeqSet read %d bytes, want %d", n, len(node))
+	}
+	var got []uint64
+	for seq := range set {
+		got = append(got, seq)
+	}
+	slices.Sort(got)
+	if want := []uint64{128, 191, 128 + 31*64 + 1}; !slices.Equal(got, want) {
+		t.Errorf("decodeSeqSet = %v, want %v", got, want)
+	}
+
+	version := slices.Clone(node)
+	version[1] = 3
+	nodes := slices.Clone(node)
+	nodes[2] = 2
+	for name, buf := range map[string][]byte{
+		"short":   node[:9],
+		"magic":   append([]byte{seqSetMagic + 1}, node[1:]...),
+		"version": version,
+		"nodes":   nodes,
+	} {
+		if _, err := decodeSeqSet(buf, make(map[uint64]bool)); err == nil {
+			t.Errorf("decodeSeqSet(%s) succeeded, want an error", name)
+		}
+	}
+}
+
+// archiveFixture returns the uncompressed snapshot archive of a fixture
+func archiveFixture(t *testing.T, stream string) []byte {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "backup", stream, backupDataFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(s2.NewReader(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(archiveMagic)) {
+		t.Fatalf("%s is not in the archive format", stream)
+	}
+	return data
+}
+
+func TestReadSnapshotArchive(t *testing.T) {
+	data := archiveFixture(t, "PLAIN")
+	want := fixtureMessages(t, "PLAIN")
+	for i := range want {
+		want[i].StreamName = ""
+	}
+
+	messages, err := readSnapshotArchive(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMessages(t, "archive", messages, want)
+
+	// Without the end marker, an empty record of five zero varints, all messages are read
+	messages, err = readSnapshotArchive(bufio.NewReader(bytes.NewReader(data[:len(data)-5])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMessages(t, "archive without end marker", messages, want)
+
+	// Cut within a record
+	_, err = readSnapshotArchive(bufio.NewReader(bytes.NewReader(data[:len(data)-20])))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("readSnapshotArchive of a cut record: %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
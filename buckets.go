@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CalendarUnit is a calendar-aligned bucket size whose length varies with the calendar
+type CalendarUnit string
+
+const (
+	CalendarDay   CalendarUnit = "day"
+	CalendarWeek  CalendarUnit = "week" // weeks start on Monday
+	CalendarMonth CalendarUnit = "month"
+)
+
+// BucketLayout decides where time buckets start and end
+type BucketLayout struct {
+	Duration time.Duration // fixed bucket length, used when Unit is empty
+	Unit     CalendarUnit
+	Location *time.Location
+}
+
+// ParseBucketLayout parses a granularity (a duration, or day, week or month) and a
+// timezone name (IANA name, Local or UTC)
+func ParseBucketLayout(granularity string, timezone string) (BucketLayout, error) {
+	layout := BucketLayout{Location: time.UTC}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return layout, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		layout.Location = loc
+	}
+
+	switch unit := CalendarUnit(strings.ToLower(granularity)); unit {
+	case CalendarDay, CalendarWeek, CalendarMonth:
+		layout.Unit = unit
+		return layout, nil
+	}
+
+	d, err := time.ParseDuration(granularity)
+	if err != nil {
+		return layout, fmt.Errorf("invalid granularity %q (use a duration such as 1m, or day, week or month)", granularity)
+	}
+	if d <= 0 {
+		return layout, fmt.Errorf("granularity must be positive")
+	}
+	layout.Duration = d
+
+	return layout, nil
+}
+
+// Calendar returns true for calendar-aligned, variable-length buckets
+func (l BucketLayout) Calendar() bool {
+	return l.Unit != ""
+}
+
+// wallClock returns true for fixed buckets of whole hours outside UTC, which follow the
+// local wall clock and so get shorter or longer when daylight saving time starts or ends
+func (l BucketLayout) wallClock() bool {
+	return !l.Calendar() && l.Duration%time.Hour == 0 && l.location() != time.UTC
+}
+
+// location returns the layout's location, UTC if not set
+func (l BucketLayout) location() *time.Location {
+	if l.Location == nil {
+		return time.UTC
+	}
+	return l.Location
+}
+
+// Nominal returns the typical bucket length, the exact length of fixed buckets
+func (l BucketLayout) Nominal() time.Duration {
+	switch l.Unit {
+	case CalendarDay:
+		return 24 * time.Hour
+	case CalendarWeek:
+		return 7 * 24 * time.Hour
+	case CalendarMonth:
+		return 30 * 24 * time.Hour
+	}
+	return l.Duration
+}
+
+// String describes the layout for display, e.g. "1 day (Europe/Amsterdam)"
+func (l BucketLayout) String() string {
+	s := formatDuration(l.Duration)
+	if l.Calendar() {
+		s = "1 " + string(l.Unit)
+	}
+	if loc := l.location(); loc != time.UTC {
+		s += " (" + loc.String() + ")"
+	}
+	return s
+}
+
+// Floor returns the start of the bucket containing t, in the layout's location
+// Fixed-length buckets are aligned to the wall clock of the location, so hourly and
+// daily buckets start on the hour and at local midnight, also across DST changes.
+func (l BucketLayout) Floor(t time.Time) time.Time {
+	loc := l.location()
+	t = t.In(loc)
+
+	switch l.Unit {
+	case CalendarDay:
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case CalendarWeek:
+		y, m, d := t.Date()
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-sinceMonday, 0, 0, 0, 0, loc)
+	case CalendarMonth:
+		y, m, _ := t.Date()
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	}
+
+	if l.wallClock() {
+		return l.localTime(wallTime(t).Truncate(l.Duration))
+	}
+
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	// wall holds the local wall clock time of the bucket start in UTC
+	wall := t.UTC().Add(shift).Truncate(l.Duration)
+	floor := wall.Add(-shift).In(loc)
+	if _, o := floor.Zone(); o != offset {
+		// DST changed within the bucket, it starts at the same wall time with the other offset
+		floor = time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), loc)
+	}
+	return floor
+}
+
+// Next returns the start of the bucket following the one starting at start
+func (l BucketLayout) Next(start time.Time) time.Time {
+	switch l.Unit {
+	case CalendarDay:
+		return start.AddDate(0, 0, 1)
+	case CalendarWeek:
+		return start.AddDate(0, 0, 7)
+	case CalendarMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	if !l.wallClock() {
+		return start.Add(l.Duration)
+	}
+
+	// Step the wall clock: the bucket in which the clock is set back also covers the
+	// repeated time, bucket starts skipped when the clock moves forward are left out
+	wall := wallTime(start).Truncate(l.Duration)
+	for {
+		wall = wall.Add(l.Duration)
+		if next := l.localTime(wall); next.After(start) {
+			return next
+		}
+	}
+}
+
+// wallTime returns the local wall clock time of t as a UTC time
+func wallTime(t time.Time) time.Time {
+	_, offset := t.Zone()
+	return t.UTC().Add(time.Duration(offset) * time.Second)
+}
+
+// localTime returns the time at which the wall clock of the layout's location shows wall,
+// given as a UTC time. A wall time repeated when the clock is set back is taken at its first
+// occurrence, one skipped when the clock moves forward at the end of the skipped time.
+func (l BucketLayout) localTime(wall time.Time) time.Time {
+	loc := l.location()
+	var first, last time.Time
+	// The offsets a day before and after cover both sides of a DST change
+	for _, probe := range []time.Time{wall.Add(-24 * time.Hour), wall.Add(24 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		t := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if _, o := t.Zone(); o == offset && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+		if last.IsZero() || t.After(last) {
+			last = t
+		}
+	}
+	if !first.IsZero() {
+		return first
+	}
+	return last
+}
+
+// makeBuckets creates the empty buckets covering minTime to maxTime
+func (l BucketLayout) makeBuckets(minTime, maxTime time.Time) []RateBucket {
+	var buckets []RateBucket
+	for start := l.Floor(minTime); len(buckets) == 0 || !start.After(maxTime); {
+		end := l.Next(start)
+		buckets = append(buckets, RateBucket{Start: start, End: end})
+		start = end
+	}
+	return buckets
+}
+
+// bucketIndexer returns a function mapping a timestamp to the index of the bucket
+// containing it, clamped to the valid range
+func (l BucketLayout) bucketIndexer(buckets []RateBucket) func(time.Time) int {
+	if len(buckets) == 0 {
+		return func(time.Time) int { return 0 }
+	}
+
+	if !l.Calendar() && !l.wallClock() {
+		startTime := buckets[0].Start
+		return func(t time.Time) int {
+			idx := int(t.Sub(startTime) / l.Duration)
+			return max(0, min(idx, len(buckets)-1))
+		}
+	}
+
+	// Variable length buckets, search for the first bucket ending after t
+	return func(t time.Time) int {
+		idx := sort.Search(len(buckets), func(i int) bool {
+			return buckets[i].End.After(t)
+		})
+		return min(idx, len(buckets)-1)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketLayoutDST(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The clock moves from 02:00 to 03:00 on 29 March and from 03:00 back to 02:00 on 25 October
+	spring := time.Date(2026, 3, 29, 0, 0, 0, 0, amsterdam)
+	autumn := time.Date(2026, 10, 25, 0, 0, 0, 0, amsterdam)
+
+	type bucket struct {
+		start  string
+		length time.Duration
+	}
+	tests := []struct {
+		granularity string
+		from        time.Time
+		want        []bucket
+	}{
+		{"1h", spring, []bucket{{"00:00+01", time.Hour}, {"01:00+01", time.Hour}, {"03:00+02", time.Hour}, {"04:00+02", time.Hour}}},
+		{"2h", spring, []bucket{{"00:00+01", 2 * time.Hour}, {"03:00+02", time.Hour}, {"04:00+02", 2 * time.Hour}}},
+		{"3h", spring, []bucket{{"00:00+01", 2 * time.Hour}, {"03:00+02", 3 * time.Hour}, {"06:00+02", 3 * time.Hour}}},
+		{"24h", spring, []bucket{{"00:00+01", 23 * time.Hour}, {"00:00+02", 24 * time.Hour}}},
+		{"day", spring, []bucket{{"00:00+01", 23 * time.Hour}, {"00:00+02", 24 * time.Hour}}},
+		{"1h", autumn, []bucket{{"00:00+02", time.Hour}, {"01:00+02", time.Hour}, {"02:00+02", 2 * time.Hour}, {"03:00+01", time.Hour}}},
+		{"2h", autumn, []bucket{{"00:00+02", 2 * time.Hour}, {"02:00+02", 3 * time.Hour}, {"04:00+01", 2 * time.Hour}}},
+		{"3h", autumn, []bucket{{"00:00+02", 4 * time.Hour}, {"03:00+01", 3 * time.Hour}, {"06:00+01", 3 * time.Hour}}},
+		{"24h", autumn, []bucket{{"00:00+02", 25 * time.Hour}, {"00:00+01", 24 * time.Hour}}},
+		{"day", autumn, []bucket{{"00:00+02", 25 * time.Hour}, {"00:00+01", 24 * time.Hour}}},
+	}
+
+	for _, tt := range tests {
+		layout, err := ParseBucketLayout(tt.granularity, "Europe/Amsterdam")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Up to the start of the last bucket wanted
+		var length time.Duration
+		for _, b := range tt.want[:len(tt.want)-1] {
+			length += b.length
+		}
+		buckets := layout.makeBuckets(tt.from, tt.from.Add(length))
+
+		if len(buckets) != len(tt.want) {
+			t.Errorf("%s from %v: %d buckets, want %d", tt.granularity, tt.from, len(buckets), len(tt.want))
+			continue
+		}
+		index := layout.bucketIndexer(buckets)
+		for i, b := range buckets {
+			start := b.Start.Format("15:04-07")
+			if start != tt.want[i].start || b.End.Sub(b.Start) != tt.want[i].length {
+				t.Errorf("%s from %v: bucket %d is %s [%v], want %s [%v]", tt.granularity, tt.from, i, start, b.End.Sub(b.Start), tt.want[i].start, tt.want[i].length)
+			}
+
+			// Every time in the bucket floors to its start and is indexed to it
+			for ts := b.Start; ts.Before(b.End); ts = ts.Add(10 * time.Minute) {
+				if floor := layout.Floor(ts); !floor.Equal(b.Start) {
+					t.Errorf("%s: Floor(%v) = %v, want %v", tt.granularity, ts, floor, b.Start)
+				}
+				if idx := index(ts); idx != i {
+					t.Errorf("%s: bucket index of %v = %d, want %d", tt.granularity, ts, idx, i)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BurstThreshold is the rate above which a bucket is part of a burst, either an absolute
+// rate or a percentile of the rates of the non-empty buckets
+type BurstThreshold struct {
+	Rate       float64 // absolute messages per second, used when Percentile is 0
+	Percentile float64 // e.g. 99 for p99
+}
+
+// ParseBurstThreshold parses a threshold such as "500" (msgs/s) or "p99"
+func ParseBurstThreshold(s string) (BurstThreshold, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if p, ok := strings.CutPrefix(s, "p"); ok {
+		pct, err := strconv.ParseFloat(p, 64)
+		if err != nil || pct <= 0 || pct >= 100 {
+			return BurstThreshold{}, fmt.Errorf("invalid burst threshold %q (use a percentile above p0 and below p100, e.g. p99)", s)
+		}
+		return BurstThreshold{Percentile: pct}, nil
+	}
+
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || rate < 0 {
+		return BurstThreshold{}, fmt.Errorf("invalid burst threshold %q (use a rate in msgs/s, or a percentile such as p99)", s)
+	}
+	return BurstThreshold{Rate: rate}, nil
+}
+
+// String describes the threshold for display
+func (t BurstThreshold) String() string {
+	if t.Percentile > 0 {
+		return "p" + strconv.FormatFloat(t.Percentile, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%.2f/s", t.Rate)
+}
+
+// ParseSustainedWindows parses a comma separated list of window durations, e.g. "10s,1m,5m"
+func ParseSustainedWindows(s string) ([]time.Duration, error) {
+	var windows []time.Duration
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid sustained window %q", part)
+		}
+		windows = append(windows, d)
+	}
+	return windows, nil
+}
+
+// BurstOptions controls burst and sustained rate detection
+type BurstOptions struct {
+	Threshold BurstThreshold
+	Windows   []time.Duration // windows for the max sustained rate
+	TopN      int             // bursts and busiest windows to list
+}
+
+// Burst is a contiguous run of buckets above the burst threshold
+type Burst struct {
+	Start    time.Time
+	End      time.Time
+	Buckets  int
+	PeakRate float64 // highest bucket rate in the burst
+	Messages int
+	Bytes    int64
+}
+
+// Duration returns how long the burst lasted
+func (b Burst) Duration() time.Duration {
+	return b.End.Sub(b.Start)
+}
+
+// AvgRate returns the average rate over the whole burst
+func (b Burst) AvgRate() float64 {
+	if secs := b.Duration().Seconds(); secs > 0 {
+		return float64(b.Messages) / secs
+	}
+	return 0
+}
+
+// SustainedWindow is a window of consecutive buckets and its average rate
+type SustainedWindow struct {
+	Start    time.Time
+	End      time.Time
+	Messages int
+	Rate     float64
+}
+
+// SustainedRate holds the busiest non-overlapping windows of one length, busiest first
+// The first window's rate is the max sustained rate over that length.
+type SustainedRate struct {
+	Window  time.Duration
+	Buckets int  // buckets per window
+	Rounded bool // the window is not a whole number of buckets and was rounded
+	Top     []SustainedWindow
+}
+
+// BurstAnalysis holds the bursts and sustained rates of a histogram
+type BurstAnalysis struct {
+	Threshold     BurstThreshold
+	ThresholdRate float64 // resolved threshold in msgs/s
+	TotalBursts   int
+	BurstBuckets  int
+	BurstMessages int
+	BurstTime     time.Duration
+	Longest       Burst
+	Bursts        []Burst // top N by message volume
+	Sustained     []SustainedRate
+}
+
+// DetectBursts finds the bursts of a histogram and its max sustained rates
+// Rates are the stored message rates of the buckets.
+func DetectBursts(hist *RateHistogram, opts BurstOptions) *BurstAnalysis {
+	if hist == nil || len(hist.Buckets) == 0 {
+		return nil
+	}
+
+	analysis := &BurstAnalysis{
+		Threshold:     opts.Threshold,
+		ThresholdRate: opts.Threshold.Rate,
+	}
+	if opts.Threshold.Percentile > 0 {
+		// Percentile of the non-empty buckets, so idle time does not drag the threshold to zero
+		var rates []float64
+		for _, b := range hist.Buckets {
+			if b.Count > 0 {
+				rates = append(rates, b.Rate)
+			}
+		}
+		sort.Float64s(rates)
+		analysis.ThresholdRate = percentileFloat64(rates, opts.Threshold.Percentile/100)
+	}
+
+	var bursts []Burst
+	var current *Burst
+	for _, b := range hist.Buckets {
+		if b.Count == 0 || b.Rate <= analysis.ThresholdRate {
+			current = nil
+			continue
+		}
+		if current == nil {
+			bursts = append(bursts, Burst{Start: b.Start})
+			current = &bursts[len(bursts)-1]
+		}
+		current.End = b.End
+		current.Buckets++
+		current.Messages += b.Count
+		current.Bytes += b.Bytes
+		current.PeakRate = max(current.PeakRate, b.Rate)
+	}
+
+	analysis.TotalBursts = len(bursts)
+	for _, burst := range bursts {
+		analysis.BurstBuckets += burst.Buckets
+		analysis.BurstMessages += burst.Messages
+		analysis.BurstTime += burst.Duration()
+		if burst.Duration() > analysis.Longest.Duration() {
+			analysis.Longest = burst
+		}
+	}
+
+	sort.SliceStable(bursts, func(i, j int) bool {
+		return bursts[i].Messages > bursts[j].Messages
+	})
+	if opts.TopN > 0 && len(bursts) > opts.TopN {
+		bursts = bursts[:opts.TopN]
+	}
+	analysis.Bursts = bursts
+
+	for _, window := range opts.Windows {
+		analysis.Sustained = append(analysis.Sustained, sustainedRate(hist, window, opts.TopN))
+	}
+
+	return analysis
+}
+
+// sustainedRate finds the busiest non-overlapping windows of consecutive buckets covering
+// the given length. Windows shorter than a bucket use a single bucket.
+func sustainedRate(hist *RateHistogram, window time.Duration, topN int) SustainedRate {
+	buckets := hist.Buckets
+	bucketLen := hist.Layout.Nominal()
+	size := max(int((window+bucketLen/2)/bucketLen), 1)
+	result := SustainedRate{
+		Window:  window,
+		Buckets: size,
+		Rounded: time.Duration(size)*bucketLen != window,
+	}
+	if size > len(buckets) {
+		return result
+	}
+
+	// Message sums of all windows through a running sum
+	sums := make([]int, len(buckets)-size+1)
+	running := 0
+	for i, b := range buckets {
+		running += b.Count
+		if i >= size {
+			running -= buckets[i-size].Count
+		}
+		if i >= size-1 {
+			sums[i-size+1] = running
+		}
+	}
+
+	order := make([]int, len(sums))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return sums[order[a]] > sums[order[b]]
+	})
+
+	// Greedily pick the busiest windows that do not overlap an already picked one
+	var picked []int
+	for _, start := range order {
+		if topN > 0 && len(picked) >= topN || sums[start] == 0 {
+			break
+		}
+		overlaps := false
+		for _, p := range picked {
+			if start < p+size && p < start+size {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		picked = append(picked, start)
+
+		w := SustainedWindow{
+			Start:    buckets[start].Start,
+			End:      buckets[start+size-1].End,
+			Messages: sums[start],
+		}
+		if secs := w.End.Sub(w.Start).Seconds(); secs > 0 {
+			w.Rate = float64(w.Messages) / secs
+		}
+		result.Top = append(result.Top, w)
+	}
+
+	return result
+}
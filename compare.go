@@ -0,0 +1,271 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// StatUnit tells how a statistic is formatted
+type StatUnit string
+
+const (
+	UnitCount      StatUnit = "count"
+	UnitRate       StatUnit = "rate"       // msgs/s
+	UnitBytes      StatUnit = "bytes"      // bytes
+	UnitThroughput StatUnit = "throughput" // bytes/s
+	UnitDuration   StatUnit = "duration"   // nanoseconds
+	UnitTime       StatUnit = "time"       // unix nanoseconds
+)
+
+// rateStatField reads one field of RateStatistics for comparison
+type rateStatField struct {
+	Name  string
+	Unit  StatUnit
+	Value func(s RateStatistics) float64
+}
+
+// rateStatFields lists every field of RateStatistics in report order
+var rateStatFields = []rateStatField{
+	{"Total Messages", UnitCount, func(s RateStatistics) float64 { return float64(s.TotalMessages) }},
+	{"Total Bytes", UnitBytes, func(s RateStatistics) float64 { return float64(s.TotalBytes) }},
+	{"Start Time", UnitTime, func(s RateStatistics) float64 { return float64(s.StartTime.UnixNano()) }},
+	{"End Time", UnitTime, func(s RateStatistics) float64 { return float64(s.EndTime.UnixNano()) }},
+	{"Duration", UnitDuration, func(s RateStatistics) float64 { return float64(s.TotalDuration) }},
+	{"Rate Average", UnitRate, func(s RateStatistics) float64 { return s.AvgRate }},
+	{"Rate P50", UnitRate, func(s RateStatistics) float64 { return s.P50Rate }},
+	{"Rate P90", UnitRate, func(s RateStatistics) float64 { return s.P90Rate }},
+	{"Rate P99", UnitRate, func(s RateStatistics) float64 { return s.P99Rate }},
+	{"Rate P99.9", UnitRate, func(s RateStatistics) float64 { return s.P999Rate }},
+	{"Rate Min", UnitRate, func(s RateStatistics) float64 { return s.MinRate }},
+	{"Rate Max", UnitRate, func(s RateStatistics) float64 { return s.MaxRate }},
+	{"Rate Std Dev", UnitRate, func(s RateStatistics) float64 { return s.StdDevRate }},
+	{"Seq Rate Average", UnitRate, func(s RateStatistics) float64 { return s.AvgSeqRate }},
+	{"Seq Rate P50", UnitRate, func(s RateStatistics) float64 { return s.P50SeqRate }},
+	{"Seq Rate P90", UnitRate, func(s RateStatistics) float64 { return s.P90SeqRate }},
+	{"Seq Rate P99", UnitRate, func(s RateStatistics) float64 { return s.P99SeqRate }},
+	{"Seq Rate P99.9", UnitRate, func(s RateStatistics) float64 { return s.P999SeqRate }},
+	{"Seq Rate Min", UnitRate, func(s RateStatistics) float64 { return s.MinSeqRate }},
+	{"Seq Rate Max", UnitRate, func(s RateStatistics) float64 { return s.MaxSeqRate }},
+	{"Seq Rate Std Dev", UnitRate, func(s RateStatistics) float64 { return s.StdDevSeqRate }},
+	{"Throughput Average", UnitThroughput, func(s RateStatistics) float64 { return s.AvgThroughput }},
+	{"Throughput P50", UnitThroughput, func(s RateStatistics) float64 { return s.P50Throughput }},
+	{"Throughput P90", UnitThroughput, func(s RateStatistics) float64 { return s.P90Throughput }},
+	{"Throughput P99", UnitThroughput, func(s RateStatistics) float64 { return s.P99Throughput }},
+	{"Throughput P99.9", UnitThroughput, func(s RateStatistics) float64 { return s.P999Throughput }},
+	{"Throughput Min", UnitThroughput, func(s RateStatistics) float64 { return s.MinThroughput }},
+	{"Throughput Max", UnitThroughput, func(s RateStatistics) float64 { return s.MaxThroughput }},
+	{"Throughput Std Dev", UnitThroughput, func(s RateStatistics) float64 { return s.StdDevTput }},
+	{"Msg Size Average", UnitBytes, func(s RateStatistics) float64 { return s.AvgMsgSize }},
+	{"Msg Size P50", UnitBytes, func(s RateStatistics) float64 { return s.P50MsgSize }},
+	{"Msg Size P90", UnitBytes, func(s RateStatistics) float64 { return s.P90MsgSize }},
+	{"Msg Size P99", UnitBytes, func(s RateStatistics) float64 { return s.P99MsgSize }},
+	{"Msg Size P99.9", UnitBytes, func(s RateStatistics) float64 { return s.P999MsgSize }},
+	{"Msg Size Min", UnitBytes, func(s RateStatistics) float64 { return float64(s.MinMsgSize) }},
+	{"Msg Size Max", UnitBytes, func(s RateStatistics) float64 { return float64(s.MaxMsgSize) }},
+	{"Msg Size Std Dev", UnitBytes, func(s RateStatistics) float64 { return s.StdDevMsgSize }},
+	{"First Sequence", UnitCount, func(s RateStatistics) float64 { return float64(s.FirstSeq) }},
+	{"Last Sequence", UnitCount, func(s RateStatistics) float64 { return float64(s.LastSeq) }},
+	{"Overall Seq Rate", UnitRate, func(s RateStatistics) float64 { return s.SeqRate }},
+	{"Active Buckets", UnitCount, func(s RateStatistics) float64 { return float64(s.ActiveBuckets) }},
+	{"Total Buckets", UnitCount, func(s RateStatistics) float64 { return float64(s.TotalBuckets) }},
+}
+
+// StatDelta is the change of one statistic from the baseline to the current window
+type StatDelta struct {
+	Name     string
+	Unit     StatUnit
+	Baseline float64
+	Current  float64
+	// Offset moves a baseline point in time onto the current window, so the delta of a
+	// time is the change of its offset into the window
+	Offset float64
+}
+
+// Delta returns the absolute change
+func (d StatDelta) Delta() float64 {
+	return d.Current - d.Baseline - d.Offset
+}
+
+// Change returns the relative change, false if the baseline is zero or the statistic is a
+// point in time
+func (d StatDelta) Change() (float64, bool) {
+	if d.Baseline == 0 || d.Unit == UnitTime {
+		return 0, false
+	}
+	return d.Delta() / math.Abs(d.Baseline), true
+}
+
+// CompareStats returns the change of every field of RateStatistics, with the baseline
+// window shifted by shift to align it with the current one
+func CompareStats(baseline, current RateStatistics, shift time.Duration) []StatDelta {
+	deltas := make([]StatDelta, len(rateStatFields))
+	for i, field := range rateStatFields {
+		deltas[i] = StatDelta{
+			Name:     field.Name,
+			Unit:     field.Unit,
+			Baseline: field.Value(baseline),
+			Current:  field.Value(current),
+		}
+		if field.Unit == UnitTime {
+			deltas[i].Offset = float64(shift)
+		}
+	}
+	return deltas
+}
+
+// StreamDelta is the change of a stream's share of the traffic
+type StreamDelta struct {
+	Name         string
+	BaseMessages int
+	CurMessages  int
+	BaseBytes    int64
+	CurBytes     int64
+	BaseShare    float64 // percentage of the baseline messages
+	CurShare     float64 // percentage of the current messages
+}
+
+// CompareStreams returns the change of the per-stream distribution, streams missing from
+// either side count as zero. Streams are sorted by current messages, then baseline messages.
+func CompareStreams(baseline, current ReportSummary) []StreamDelta {
+	byName := make(map[string]*StreamDelta)
+	var names []string
+	get := func(name string) *StreamDelta {
+		d, ok := byName[name]
+		if !ok {
+			d = &StreamDelta{Name: name}
+			byName[name] = d
+			names = append(names, name)
+		}
+		return d
+	}
+
+	for _, s := range baseline.Streams {
+		d := get(s.Name)
+		d.BaseMessages = s.Messages
+		d.BaseBytes = s.Bytes
+		d.BaseShare = shareOf(int64(s.Messages), int64(baseline.TotalMsgs))
+	}
+	for _, s := range current.Streams {
+		d := get(s.Name)
+		d.CurMessages = s.Messages
+		d.CurBytes = s.Bytes
+		d.CurShare = shareOf(int64(s.Messages), int64(current.TotalMsgs))
+	}
+
+	deltas := make([]StreamDelta, 0, len(names))
+	for _, name := range names {
+		deltas = append(deltas, *byName[name])
+	}
+	sort.SliceStable(deltas, func(i, j int) bool {
+		if deltas[i].CurMessages != deltas[j].CurMessages {
+			return deltas[i].CurMessages > deltas[j].CurMessages
+		}
+		return deltas[i].BaseMessages > deltas[j].BaseMessages
+	})
+	return deltas
+}
+
+// ComparisonSide is one of the two analyses of a comparison
+type ComparisonSide struct {
+	Label       string // time window or snapshot file
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Summary     ReportSummary
+	Histogram   *RateHistogram // combined, with the per-stream breakdown
+}
+
+// alignedStart returns the start of the bucket holding the window start, so shifting by the
+// difference of aligned starts lines up whole buckets
+func (s ComparisonSide) alignedStart() time.Time {
+	if s.Histogram == nil {
+		return s.WindowStart
+	}
+	return s.Histogram.Layout.Floor(s.WindowStart)
+}
+
+// Comparison aligns a baseline analysis with a current one, e.g. last week and this week
+type Comparison struct {
+	Baseline ComparisonSide
+	Current  ComparisonSide
+	// Shift moves baseline times onto the current window, aligning the window starts
+	Shift   time.Duration
+	Stats   []StatDelta
+	Streams []StreamDelta
+}
+
+// NewComparison compares two analyses. Their window starts are aligned, so the buckets at
+// the same offset into each window line up.
+func NewComparison(baseline, current ComparisonSide) *Comparison {
+	c := &Comparison{
+		Baseline: baseline,
+		Current:  current,
+		Shift:    current.alignedStart().Sub(baseline.alignedStart()),
+		Streams:  CompareStreams(baseline.Summary, current.Summary),
+	}
+	var baseStats, curStats RateStatistics
+	if baseline.Histogram != nil {
+		baseStats = baseline.Histogram.Stats
+	}
+	if current.Histogram != nil {
+		curStats = current.Histogram.Stats
+	}
+	c.Stats = CompareStats(baseStats, curStats, c.Shift)
+	return c
+}
+
+// StreamStats returns the statistic changes of one stream, from the per-stream breakdown
+// of both histograms
+func (c *Comparison) StreamStats(streamName string) []StatDelta {
+	var baseStats, curStats RateStatistics
+	if hist := extractStreamHistogram(c.Baseline.Histogram, streamName); hist != nil {
+		baseStats = hist.Stats
+	}
+	if hist := extractStreamHistogram(c.Current.Histogram, streamName); hist != nil {
+		curStats = hist.Stats
+	}
+	return CompareStats(baseStats, curStats, c.Shift)
+}
+
+// BaselineSeries returns the baseline stored rate and throughput over each of the given
+// buckets of the current window, averaging the shifted baseline buckets starting within it.
+// An empty stream name uses all streams.
+func (c *Comparison) BaselineSeries(streamName string, buckets []RateBucket) ([]float64, []float64) {
+	rates := make([]float64, len(buckets))
+	throughputs := make([]float64, len(buckets))
+
+	baseline := c.Baseline.Histogram
+	if streamName != "" {
+		baseline = extractStreamHistogram(baseline, streamName)
+	}
+	if baseline == nil {
+		return rates, throughputs
+	}
+
+	j := 0
+	for i, b := range buckets {
+		var count int
+		var bytes int64
+		for ; j < len(baseline.Buckets); j++ {
+			start := baseline.Buckets[j].Start.Add(c.Shift)
+			if !start.Before(b.End) {
+				break
+			}
+			if start.Before(b.Start) {
+				continue
+			}
+			count += baseline.Buckets[j].Count
+			bytes += baseline.Buckets[j].Bytes
+		}
+		if seconds := b.End.Sub(b.Start).Seconds(); seconds > 0 {
+			rates[i] = float64(count) / seconds
+			throughputs[i] = float64(bytes) / seconds
+		}
+	}
+	return rates, throughputs
+}
+
+// sameLayout reports whether two bucket layouts produce the same buckets
+func sameLayout(a, b BucketLayout) bool {
+	return a.Duration == b.Duration && a.Unit == b.Unit && a.location().String() == b.location().String()
+}
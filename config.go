@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile holds flag values used by every run and named profiles of them, keyed by the
+// flag names, e.g. granularity: 1h or stream: [ORDERS, EVENTS]
+type ConfigFile struct {
+	Defaults map[string]any            `yaml:"defaults"`
+	Profiles map[string]map[string]any `yaml:"profiles"`
+}
+
+// LoadConfigFile reads a YAML (or JSON) config file
+func LoadConfigFile(filename string) (*ConfigFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file ConfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", filename, err)
+	}
+	return &file, nil
+}
+
+// Settings returns the flag values of the defaults with the profile, if any, applied on top
+func (f *ConfigFile) Settings(profile string) (map[string][]string, error) {
+	settings := make(map[string][]string)
+	add := func(values map[string]any, source string) error {
+		for name, v := range values {
+			vals, err := settingValues(v)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", source, name, err)
+			}
+			settings[name] = vals
+		}
+		return nil
+	}
+
+	if err := add(f.Defaults, "defaults"); err != nil {
+		return nil, err
+	}
+	if profile == "" {
+		return settings, nil
+	}
+
+	values, ok := f.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(f.Profiles))
+		for name := range f.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(names, ", "))
+	}
+	if err := add(values, "profile "+profile); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// settingValues turns a value of the config file into the values of a flag, a list for
+// flags that can be repeated
+func settingValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("no value")
+	case []any:
+		vals := make([]string, 0, len(v))
+		for _, item := range v {
+			item, err := settingValues(item)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, item...)
+		}
+		return vals, nil
+	case map[string]any:
+		return nil, fmt.Errorf("expected a value or a list")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+// findConfigArgs finds the config file and profile in the arguments and environment ahead
+// of parsing, as they decide the defaults of all other flags
+func findConfigArgs(args []string) (config, profile string) {
+	config, profile = os.Getenv(configEnvar), os.Getenv(profileEnvar)
+	for i := 0; i < len(args); i++ {
+		for _, name := range []string{"config", "profile"} {
+			var value string
+			switch {
+			case strings.HasPrefix(args[i], "--"+name+"="):
+				value = strings.TrimPrefix(args[i], "--"+name+"=")
+			case args[i] == "--"+name && i+1 < len(args):
+				i++
+				value = args[i]
+			default:
+				continue
+			}
+			if name == "config" {
+				config = value
+			} else {
+				profile = value
+			}
+		}
+	}
+	return config, profile
+}
+
+// applySettings makes the settings the defaults of the flags with the same name, on the
+// application and all commands, so flags given on the command line still override them
+func applySettings(app *fisk.Application, cmds []*fisk.CmdClause, settings map[string][]string) error {
+	var unknown []string
+	for name, values := range settings {
+		found := false
+		if flag := app.GetFlag(name); flag != nil && name != "config" && name != "profile" {
+			flag.Default(values...)
+			found = true
+		}
+		for _, cmd := range cmds {
+			if flag := cmd.GetFlag(name); flag != nil {
+				flag.Default(values...)
+				found = true
+			}
+		}
+		if !found {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown settings in the config file: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// PrintEffectiveConfig prints the flag values a command runs with, from the config file,
+// profile and command line, in the format of a profile
+func PrintEffectiveConfig(app *fisk.Application, cmd *fisk.CmdClause, command, config, profile string) error {
+	var flags []*fisk.FlagModel
+	flags = append(flags, app.Model().Flags...)
+	flags = append(flags, cmd.Model().Flags...)
+
+	values := &yaml.Node{Kind: yaml.MappingNode}
+	for _, flag := range flags {
+		switch {
+		case flag.Hidden, flag.Name == "help", flag.Name == "version", flag.Name == "config", flag.Name == "profile":
+			continue
+		}
+		var value yaml.Node
+		if err := value.Encode(flagValue(flag)); err != nil {
+			return err
+		}
+		values.Content = append(values.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: flag.Name}, &value)
+	}
+
+	source := "built-in defaults"
+	if config != "" {
+		source = config
+		if profile != "" {
+			source += ", profile " + profile
+		}
+	}
+	fmt.Printf("# Effective configuration of %s (%s and command line)\n", command, source)
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(values); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// flagValue returns the parsed value of a flag in a form that reads back as a setting
+func flagValue(flag *fisk.FlagModel) any {
+	getter, ok := flag.Value.(fisk.Getter)
+	if !ok {
+		return flag.String()
+	}
+	switch v := getter.Get().(type) {
+	case time.Duration:
+		return v.String()
+	case []string:
+		if v == nil {
+			return []string{}
+		}
+		return v
+	default:
+		return v
+	}
+}
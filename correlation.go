@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// maxCorrelationStreams is the most streams correlated, the busiest ones are kept
+	maxCorrelationStreams = 50
+	// maxCorrelationBuckets is the most steps correlated, longer histories are resampled
+	// into coarser steps
+	maxCorrelationBuckets = 5000
+)
+
+// CorrelationOptions controls the cross-correlation of streams
+type CorrelationOptions struct {
+	MaxLag    int     // buckets one stream is shifted against the other, 0 for same-bucket only
+	Threshold float64 // mean correlation needed to group streams into a cluster
+}
+
+// StreamPairCorrelation is the correlation of the stored rates of two streams
+type StreamPairCorrelation struct {
+	A           string
+	B           string
+	Correlation float64 // in the same buckets
+	// Lag is how far B trails A at the strongest correlation, negative when B leads
+	Lag            time.Duration
+	LagCorrelation float64
+}
+
+// StreamCluster is a group of streams whose rates move together
+type StreamCluster struct {
+	Streams         []string
+	MeanCorrelation float64 // mean correlation of all pairs in the cluster, at their best lag
+}
+
+// CorrelationAnalysis holds the pairwise correlations of the stored rates of all streams
+type CorrelationAnalysis struct {
+	Step    time.Duration // length of a correlated step, nominal for calendar layouts
+	MaxLag  time.Duration // largest shift tried between two streams
+	Streams []string      // by stored messages, descending
+	Omitted int           // quieter streams left out beyond maxCorrelationStreams
+	// Matrix holds the same-bucket correlation of every pair of Streams, NaN when a stream
+	// has a constant rate
+	Matrix   [][]float64
+	Pairs    []StreamPairCorrelation // by strength of the lagged correlation, strongest first
+	Clusters []StreamCluster         // clusters of two or more streams, strongest first
+}
+
+// BuildCorrelation correlates the stored rates of the streams of a combined histogram, from
+// its per-stream breakdown. Each pair is also correlated with one stream shifted against the
+// other by up to MaxLag buckets, so a stream fed by another shows up with the delay between
+// them. Streams are clustered by average linkage on their lagged correlation. Returns nil
+// with fewer than two streams or three buckets.
+func BuildCorrelation(hist *RateHistogram, opts CorrelationOptions) *CorrelationAnalysis {
+	if hist == nil || len(hist.Buckets) < 3 {
+		return nil
+	}
+
+	// Rank the streams by stored messages
+	totals := make(map[string]int)
+	for _, b := range hist.Buckets {
+		for name, data := range b.PerStream {
+			totals[name] += data.Count
+		}
+	}
+	var names []string
+	for name, total := range totals {
+		if total > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if totals[names[i]] != totals[names[j]] {
+			return totals[names[i]] > totals[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	analysis := &CorrelationAnalysis{Streams: names}
+	if len(names) > maxCorrelationStreams {
+		analysis.Streams = names[:maxCorrelationStreams]
+		analysis.Omitted = len(names) - maxCorrelationStreams
+	}
+
+	k := ceilDiv(len(hist.Buckets), maxCorrelationBuckets)
+	analysis.Step = time.Duration(k) * hist.Layout.Nominal()
+	maxLag := ceilDiv(opts.MaxLag, k)
+	analysis.MaxLag = time.Duration(maxLag) * analysis.Step
+
+	series := make([][]float64, len(analysis.Streams))
+	for i, name := range analysis.Streams {
+		series[i] = streamRateSeries(hist.Buckets, name, k)
+	}
+
+	n := len(analysis.Streams)
+	analysis.Matrix = make([][]float64, n)
+	similarity := make([][]float64, n)
+	for i := range n {
+		analysis.Matrix[i] = make([]float64, n)
+		similarity[i] = make([]float64, n)
+		analysis.Matrix[i][i] = 1
+		similarity[i][i] = 1
+	}
+
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			pair := StreamPairCorrelation{
+				A:           analysis.Streams[i],
+				B:           analysis.Streams[j],
+				Correlation: laggedCorrelation(series[i], series[j], 0),
+			}
+			pair.LagCorrelation = pair.Correlation
+			for lag := -maxLag; lag <= maxLag; lag++ {
+				c := laggedCorrelation(series[i], series[j], lag)
+				if math.Abs(c) > math.Abs(pair.LagCorrelation) || math.IsNaN(pair.LagCorrelation) {
+					pair.LagCorrelation = c
+					pair.Lag = time.Duration(lag) * analysis.Step
+				}
+			}
+
+			analysis.Matrix[i][j], analysis.Matrix[j][i] = pair.Correlation, pair.Correlation
+			if !math.IsNaN(pair.LagCorrelation) {
+				similarity[i][j], similarity[j][i] = pair.LagCorrelation, pair.LagCorrelation
+				analysis.Pairs = append(analysis.Pairs, pair)
+			}
+		}
+	}
+
+	sort.SliceStable(analysis.Pairs, func(i, j int) bool {
+		return math.Abs(analysis.Pairs[i].LagCorrelation) > math.Abs(analysis.Pairs[j].LagCorrelation)
+	})
+
+	analysis.Clusters = clusterStreams(analysis.Streams, similarity, opts.Threshold)
+	return analysis
+}
+
+// streamRateSeries returns the stored rate of one stream over every k buckets
+func streamRateSeries(buckets []RateBucket, streamName string, k int) []float64 {
+	rates := make([]float64, 0, ceilDiv(len(buckets), k))
+	for i := 0; i < len(buckets); i += k {
+		group := buckets[i:min(i+k, len(buckets))]
+		count := 0
+		for _, b := range group {
+			if data := b.PerStream[streamName]; data != nil {
+				count += data.Count
+			}
+		}
+		seconds := group[len(group)-1].End.Sub(group[0].Start).Seconds()
+		rates = append(rates, float64(count)/seconds)
+	}
+	return rates
+}
+
+// laggedCorrelation returns the Pearson correlation of a[t] and b[t+lag] over the steps
+// where both exist, NaN if either is constant there or fewer than three steps overlap
+func laggedCorrelation(a, b []float64, lag int) float64 {
+	start, end := max(0, -lag), min(len(a), len(b)-lag)
+	if end-start < 3 {
+		return math.NaN()
+	}
+
+	var sumA, sumB float64
+	for t := start; t < end; t++ {
+		sumA += a[t]
+		sumB += b[t+lag]
+	}
+	meanA := sumA / float64(end-start)
+	meanB := sumB / float64(end-start)
+
+	var cov, varA, varB float64
+	for t := start; t < end; t++ {
+		da, db := a[t]-meanA, b[t+lag]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// clusterStreams merges the two clusters with the highest mean pairwise similarity until no
+// two clusters reach the threshold, and returns the clusters of two or more streams
+func clusterStreams(names []string, similarity [][]float64, threshold float64) []StreamCluster {
+	clusters := make([][]int, len(names))
+	for i := range names {
+		clusters[i] = []int{i}
+	}
+
+	linkage := func(a, b []int) float64 {
+		sum := 0.0
+		for _, i := range a {
+			for _, j := range b {
+				sum += similarity[i][j]
+			}
+		}
+		return sum / float64(len(a)*len(b))
+	}
+
+	for len(clusters) > 1 {
+		bestI, bestJ, best := -1, -1, math.Inf(-1)
+		for i := range clusters {
+			for j := i + 1; j < len(clusters); j++ {
+				if l := linkage(clusters[i], clusters[j]); l > best {
+					bestI, bestJ, best = i, j, l
+				}
+			}
+		}
+		if best < threshold {
+			break
+		}
+		clusters[bestI] = append(clusters[bestI], clusters[bestJ]...)
+		clusters = append(clusters[:bestJ], clusters[bestJ+1:]...)
+	}
+
+	var result []StreamCluster
+	for _, members := range clusters {
+		if len(members) < 2 {
+			continue
+		}
+		sort.Ints(members)
+		cluster := StreamCluster{}
+		pairs := 0
+		for x, i := range members {
+			cluster.Streams = append(cluster.Streams, names[i])
+			for _, j := range members[x+1:] {
+				cluster.MeanCorrelation += similarity[i][j]
+				pairs++
+			}
+		}
+		cluster.MeanCorrelation /= float64(pairs)
+		result = append(result, cluster)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].MeanCorrelation > result[j].MeanCorrelation
+	})
+	return result
+}
@@ -4,8 +4,10 @@ import (
 	"cmp"
 	"encoding/csv"
 	"fmt"
+	"math"
 	"os"
 	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -286,6 +288,8 @@ func PrintReportSummary(summary ReportSummary, stats *RateStatistics, distributi
 	fmt.Println(strings.Repeat("=", headerWidth))
 	fmt.Println()
 
+	printFetchCompleteness(summary.Fetch)
+
 	if summary.TotalMsgs == 0 {
 		fmt.Println("  No messages found")
 		fmt.Println()
@@ -300,7 +304,7 @@ func PrintReportSummary(summary ReportSummary, stats *RateStatistics, distributi
 	fmt.Printf("  Streams:                       %d\n", summary.StreamCount)
 	fmt.Printf("  Total Messages:                %d\n", summary.TotalMsgs)
 
-	if stats != nil {
+	if stats != nil && stats.HasSeqRange() {
 		fmt.Printf("  Total Messages (per seq nums):  %s\n", humanize.Comma(int64(stats.LastSeq-stats.FirstSeq+1)))
 	}
 
@@ -323,16 +327,18 @@ func PrintReportSummary(summary ReportSummary, stats *RateStatistics, distributi
 		fmt.Printf("    Std Dev:                     %.2f msg/s\n", stats.StdDevRate)
 		fmt.Println()
 
-		fmt.Println("  Message Rate (per sequence numbers with deletes interpolated):")
-		fmt.Printf("    Average:                     %.2f msg/s\n", stats.AvgSeqRate)
-		fmt.Printf("    P50:                         %.2f msg/s\n", stats.P50SeqRate)
-		fmt.Printf("    P90:                         %.2f msg/s\n", stats.P90SeqRate)
-		fmt.Printf("    P99:                         %.2f msg/s\n", stats.P99SeqRate)
-		fmt.Printf("    P99.9:                       %.2f msg/s\n", stats.P999SeqRate)
-		fmt.Printf("    Min:                         %.2f msg/s\n", stats.MinSeqRate)
-		fmt.Printf("    Max:                         %.2f msg/s\n", stats.MaxSeqRate)
-		fmt.Printf("    Std Dev:                     %.2f msg/s\n", stats.StdDevSeqRate)
-		fmt.Println()
+		if stats.HasSeqRange() {
+			fmt.Printf("  Message Rate (per sequence numbers with deletes interpolated, %s):\n", summary.Interpolation)
+			fmt.Printf("    Average:                     %.2f msg/s\n", stats.AvgSeqRate)
+			fmt.Printf("    P50:                         %.2f msg/s\n", stats.P50SeqRate)
+			fmt.Printf("    P90:                         %.2f msg/s\n", stats.P90SeqRate)
+			fmt.Printf("    P99:                         %.2f msg/s\n", stats.P99SeqRate)
+			fmt.Printf("    P99.9:                       %.2f msg/s\n", stats.P999SeqRate)
+			fmt.Printf("    Min:                         %.2f msg/s\n", stats.MinSeqRate)
+			fmt.Printf("    Max:                         %.2f msg/s\n", stats.MaxSeqRate)
+			fmt.Printf("    Std Dev:                     %.2f msg/s\n", stats.StdDevSeqRate)
+			fmt.Println()
+		}
 
 		fmt.Println("  Throughput:")
 		fmt.Printf("    Average:                     %s/s\n", formatBytes(int64(stats.AvgThroughput)))
@@ -357,6 +363,8 @@ func PrintReportSummary(summary ReportSummary, stats *RateStatistics, distributi
 		fmt.Println()
 	}
 
+	printDeleteBreakdown(summary.Deletes, summary.PurgeGaps)
+
 	// Print stream breakdown as aligned table
 	if len(summary.Streams) > 0 && distribution {
 		// Find max stream name length for alignment
@@ -427,6 +435,102 @@ func PrintReportSummary(summary ReportSummary, stats *RateStatistics, distributi
 	}
 }
 
+// printDeleteBreakdown prints the deleted message volume per stream and likely cause
+func printDeleteBreakdown(deletes []GapBreakdown, purgeMode PurgeGapMode) {
+	if len(deletes) == 0 {
+		return
+	}
+
+	fmt.Println("Deleted Messages by Cause (messages in gaps between stored messages):")
+	if purgeMode == PurgeGapsExclude {
+		fmt.Println("  Purge gaps are excluded from the per sequence number rate")
+	}
+
+	maxNameLen := 6 // minimum "Stream" header width
+	for _, b := range deletes {
+		maxNameLen = max(maxNameLen, len(b.StreamName))
+	}
+
+	const colWidth = 18
+	fmt.Printf("  %-*s | %*s | %*s | %*s | %*s\n", maxNameLen, "Stream",
+		colWidth, "Purge", colWidth, "Subject Rollover", colWidth, "Sparse Deletes", colWidth, "Stream State")
+	fmt.Printf("  %s", strings.Repeat("-", maxNameLen))
+	for range len(gapCauses) + 1 {
+		fmt.Printf("-+-%s", strings.Repeat("-", colWidth))
+	}
+	fmt.Println()
+
+	for _, b := range deletes {
+		fmt.Printf("  %-*s", maxNameLen, b.StreamName)
+		for _, cause := range gapCauses {
+			v := b.ByCause[cause]
+			cell := "-"
+			if v.Messages > 0 {
+				cell = fmt.Sprintf("%s (%s gaps)", humanize.Comma(int64(v.Messages)), humanize.Comma(int64(v.Gaps)))
+			}
+			fmt.Printf(" | %*s", colWidth, cell)
+		}
+		fmt.Printf(" | %*s\n", colWidth, humanize.Comma(int64(b.StateDeleted)))
+	}
+	fmt.Println()
+}
+
+// printFetchCompleteness reports streams whose requested range could not be fetched completely
+func printFetchCompleteness(fetch []FetchCompleteness) {
+	if len(fetch) == 0 {
+		return
+	}
+
+	var partial []FetchCompleteness
+	retries := 0
+	for _, fc := range fetch {
+		retries += fc.Retries
+		if !fc.Complete() {
+			partial = append(partial, fc)
+		}
+	}
+
+	if len(partial) == 0 {
+		if retries > 0 {
+			fmt.Printf("Fetch Completeness: all %d stream(s) fetched completely (after %d retries)\n\n", len(fetch), retries)
+		}
+		return
+	}
+
+	fmt.Printf("Fetch Completeness: %d of %d stream(s) are PARTIAL, results for them are incomplete\n", len(partial), len(fetch))
+
+	maxNameLen := 6 // minimum "Stream" header width
+	for _, fc := range partial {
+		maxNameLen = max(maxNameLen, len(fc.StreamName))
+	}
+
+	fmt.Printf("  %-*s | %10s | %10s | %10s | %7s | %s\n", maxNameLen, "Stream", "Fetched", "Deleted", "Missing", "Retries", "Errors")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", maxNameLen),
+		strings.Repeat("-", 10),
+		strings.Repeat("-", 10),
+		strings.Repeat("-", 10),
+		strings.Repeat("-", 7),
+		strings.Repeat("-", 20))
+	for _, fc := range partial {
+		classes := make([]string, 0, len(fc.Errors))
+		for class, n := range fc.Errors {
+			classes = append(classes, fmt.Sprintf("%s: %d", class, n))
+		}
+		slices.Sort(classes)
+		fmt.Printf("  %-*s | %10d | %10d | %10d | %7d | %s\n", maxNameLen, fc.StreamName, fc.Fetched, fc.Deleted, fc.Missing, fc.Retries, strings.Join(classes, ", "))
+	}
+	for _, fc := range partial {
+		for _, gap := range fc.ErrorGaps {
+			fmt.Printf("  %s: sequences %d-%d not fetched\n", fc.StreamName, gap.First, gap.Last)
+		}
+		if fc.Fatal != "" {
+			fmt.Printf("  %s: %s\n", fc.StreamName, fc.Fatal)
+		}
+	}
+	fmt.Println()
+}
+
 // PrintStreamHeader prints a header for a single stream's analysis
 func PrintStreamHeader(streamName string, msgCount int) {
 	fmt.Println(strings.Repeat("-", headerWidth))
@@ -435,6 +539,36 @@ func PrintStreamHeader(streamName string, msgCount int) {
 	fmt.Println()
 }
 
+// PrintFetchLoad prints the load the tool itself generated on the servers while fetching
+func PrintFetchLoad(load FetchLoad) {
+	if load.Requests == 0 {
+		return
+	}
+
+	fmt.Println(strings.Repeat("-", headerWidth))
+	fmt.Println("Load Generated By This Tool")
+	fmt.Println(strings.Repeat("-", headerWidth))
+	fmt.Println()
+
+	fmt.Printf("  Batch Requests:                %s (%d failed)\n", humanize.Comma(int64(load.Requests)), load.Errors)
+	fmt.Printf("  Messages Fetched:              %s\n", humanize.Comma(int64(load.Messages)))
+	fmt.Printf("  Data Fetched:                  %s\n", formatBytes(load.Bytes))
+	fmt.Printf("  Fetch Duration:                %s\n", formatDuration(load.WallTime))
+	if load.WallTime.Seconds() > 0 {
+		fmt.Printf("  Avg Fetch Rate:                %.2f msg/s, %s\n",
+			float64(load.Messages)/load.WallTime.Seconds(),
+			formatBytesPerSec(float64(load.Bytes)/load.WallTime.Seconds()))
+	}
+	fmt.Printf("  Avg Request Latency:           %s (max %s)\n",
+		formatDuration(load.RequestTime/time.Duration(load.Requests)),
+		formatDuration(load.MaxLatency))
+	fmt.Printf("  Batch Size:                    %d to %d (%d reductions)\n", load.MinBatchSize, load.MaxBatchSize, load.BatchShrinks)
+	if load.ThrottledTime > 0 {
+		fmt.Printf("  Time Throttled (cumulative):   %s\n", formatDuration(load.ThrottledTime))
+	}
+	fmt.Println()
+}
+
 // GraphOptions controls which graphs and stats to display
 type GraphOptions struct {
 	ShowGraph      bool
@@ -445,7 +579,7 @@ type GraphOptions struct {
 
 // PrintRateHistogram displays the rate over time and statistics
 func PrintRateHistogram(hist *RateHistogram, opts GraphOptions) {
-	fmt.Printf("-- Stored Message Rate Over Time (granularity: %s) %s\n", formatDuration(hist.Granularity), strings.Repeat("-", 22))
+	fmt.Printf("-- Stored Message Rate Over Time (granularity: %s) %s\n", hist.Layout, strings.Repeat("-", 22))
 	fmt.Println()
 
 	if len(hist.Buckets) == 0 {
@@ -464,7 +598,969 @@ func PrintRateHistogram(hist *RateHistogram, opts GraphOptions) {
 		}
 	}
 
-	printRateStats(hist.Stats, opts.ShowRate, opts.ShowThroughput)
+	printRateStats(hist.Stats, hist.Interpolation, opts.ShowRate, opts.ShowThroughput)
+}
+
+// PrintSeasonality prints the hour-of-day and day-of-week profiles of a histogram
+func PrintSeasonality(profile *SeasonalityProfile, layout BucketLayout) {
+	if profile == nil {
+		return
+	}
+
+	tz := layout.location().String()
+	if profile.HourOfDay == nil && profile.DayOfWeek == nil {
+		fmt.Printf("-- Seasonality %s\n", strings.Repeat("-", 54))
+		fmt.Println()
+		fmt.Printf("  Buckets of %s are too long for hour-of-day or day-of-week profiles\n", layout)
+		fmt.Println()
+		return
+	}
+
+	if profile.HourOfDay != nil {
+		fmt.Printf("-- Seasonality: Hour of Day (%s) %s\n", tz, strings.Repeat("-", max(4, 37-len(tz))))
+		fmt.Println()
+		printProfileSlots(profile.HourOfDay)
+	} else {
+		fmt.Printf("  Buckets of %s are too long for an hour-of-day profile\n", layout)
+		fmt.Println()
+	}
+
+	if profile.DayOfWeek != nil {
+		fmt.Printf("-- Seasonality: Day of Week (%s) %s\n", tz, strings.Repeat("-", max(4, 37-len(tz))))
+		fmt.Println()
+		printProfileSlots(profile.DayOfWeek)
+	}
+}
+
+// printProfileSlots prints profile slots as a table with a graph of the mean rate
+func printProfileSlots(slots []ProfileSlot) {
+	labelWidth := 5
+	maxMean := 0.0
+	for _, slot := range slots {
+		labelWidth = max(labelWidth, len(slot.Label))
+		maxMean = max(maxMean, slot.MeanRate)
+	}
+
+	// Fixed cols: "  " + label + " | " + buckets(9) + " | " + 3 x (rate(12) + " | ")
+	graphWidth := getGraphWidth(2 + labelWidth + 3 + 9 + 3 + 3*(12+3))
+
+	fmt.Printf("  %-*s | %9s | %12s | %12s | %12s | %s\n", labelWidth, "Slot", "Buckets", "Mean", "P50", "P99", "Mean Rate")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", labelWidth),
+		strings.Repeat("-", 9),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", graphWidth))
+
+	for _, slot := range slots {
+		barLen := 0
+		if maxMean > 0 {
+			barLen = int(slot.MeanRate / maxMean * float64(graphWidth))
+		}
+		if barLen < 1 && slot.MeanRate > 0 {
+			barLen = 1
+		}
+		if slot.Buckets == 0 {
+			// No data in this slot, which is different from a zero rate
+			fmt.Printf("  %-*s | %9d | %12s | %12s | %12s |\n", labelWidth, slot.Label, 0, "-", "-", "-")
+			continue
+		}
+		fmt.Printf("  %-*s | %9s | %10.2f/s | %10.2f/s | %10.2f/s | %s\n",
+			labelWidth, slot.Label, humanize.Comma(int64(slot.Buckets)),
+			slot.MeanRate, slot.P50Rate, slot.P99Rate, strings.Repeat("█", barLen))
+	}
+	fmt.Println()
+}
+
+// PrintBursts prints the bursts and max sustained rates of a histogram
+func PrintBursts(analysis *BurstAnalysis) {
+	if analysis == nil {
+		return
+	}
+
+	title := fmt.Sprintf("Bursts (above %.2f/s)", analysis.ThresholdRate)
+	if analysis.Threshold.Percentile > 0 {
+		title = fmt.Sprintf("Bursts (above %s = %.2f/s)", analysis.Threshold, analysis.ThresholdRate)
+	}
+	fmt.Printf("-- %s %s\n", title, strings.Repeat("-", max(4, 65-len(title))))
+	fmt.Println()
+
+	if analysis.TotalBursts == 0 {
+		fmt.Println("  No bursts found")
+		fmt.Println()
+	} else {
+		fmt.Printf("  %-33s %s\n", "Bursts:", humanize.Comma(int64(analysis.TotalBursts)))
+		fmt.Printf("  %-33s %s (%s buckets)\n", "Time in bursts:", formatDuration(analysis.BurstTime), humanize.Comma(int64(analysis.BurstBuckets)))
+		fmt.Printf("  %-33s %s\n", "Messages in bursts:", humanize.Comma(int64(analysis.BurstMessages)))
+		fmt.Printf("  %-33s %s from %s\n", "Longest burst:", formatDuration(analysis.Longest.Duration()),
+			analysis.Longest.Start.Format("2006-01-02 15:04:05"))
+		fmt.Println()
+
+		fmt.Printf("  %-19s | %12s | %12s | %12s | %12s | %10s\n", "Start", "Duration", "Peak Rate", "Avg Rate", "Messages", "Bytes")
+		fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s\n",
+			strings.Repeat("-", 19),
+			strings.Repeat("-", 12),
+			strings.Repeat("-", 12),
+			strings.Repeat("-", 12),
+			strings.Repeat("-", 12),
+			strings.Repeat("-", 10))
+		for _, burst := range analysis.Bursts {
+			fmt.Printf("  %-19s | %12s | %10.2f/s | %10.2f/s | %12s | %10s\n",
+				burst.Start.Format("2006-01-02 15:04:05"),
+				formatDuration(burst.Duration()),
+				burst.PeakRate,
+				burst.AvgRate(),
+				humanize.Comma(int64(burst.Messages)),
+				formatBytes(burst.Bytes))
+		}
+		if analysis.TotalBursts > len(analysis.Bursts) {
+			fmt.Printf("  ... %s more (showing the largest by message count)\n", humanize.Comma(int64(analysis.TotalBursts-len(analysis.Bursts))))
+		}
+		fmt.Println()
+	}
+
+	if len(analysis.Sustained) == 0 {
+		return
+	}
+
+	fmt.Printf("-- Max Sustained Rate %s\n", strings.Repeat("-", 47))
+	fmt.Println()
+	for _, s := range analysis.Sustained {
+		label := "Best " + formatDuration(s.Window)
+		if s.Rounded {
+			label += fmt.Sprintf(" (%d buckets)", s.Buckets)
+		}
+		if len(s.Top) == 0 {
+			fmt.Printf("  %-33s - (longer than the analyzed time range)\n", label+":")
+			continue
+		}
+		fmt.Printf("  %-33s %.2f/s\n", label+":", s.Top[0].Rate)
+		for i, w := range s.Top {
+			fmt.Printf("    %2d. %s - %s  %10.2f/s  %12s msgs\n", i+1,
+				w.Start.Format("2006-01-02 15:04:05"),
+				w.End.Format("15:04:05"),
+				w.Rate,
+				humanize.Comma(int64(w.Messages)))
+		}
+	}
+	fmt.Println()
+}
+
+// PrintAnomalies prints the anomalies found against the rolling baseline
+func PrintAnomalies(anomalies []Anomaly, opts AnomalyOptions) {
+	title := fmt.Sprintf("Anomalies (%d bucket baseline, %.4g MADs)", opts.Window, opts.Threshold)
+	fmt.Printf("-- %s %s\n", title, strings.Repeat("-", max(4, 65-len(title))))
+	fmt.Println()
+
+	if len(anomalies) == 0 {
+		fmt.Println("  No anomalies found")
+		fmt.Println()
+		return
+	}
+
+	counts := make(map[AnomalyKind]int)
+	for _, a := range anomalies {
+		counts[a.Kind]++
+	}
+	fmt.Printf("  %-33s %s\n", "Spikes:", humanize.Comma(int64(counts[AnomalySpike])))
+	fmt.Printf("  %-33s %s\n", "Drops to zero:", humanize.Comma(int64(counts[AnomalyDrop])))
+	fmt.Printf("  %-33s %s\n", "Level shifts:", humanize.Comma(int64(counts[AnomalyLevelShift])))
+	fmt.Println()
+
+	fmt.Printf("  %-19s | %-11s | %12s | %12s | %12s | %8s\n", "Start", "Kind", "Duration", "Rate", "Baseline", "Score")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", 19),
+		strings.Repeat("-", 11),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 8))
+	for _, a := range anomalies {
+		duration := "-"
+		if a.Kind != AnomalyLevelShift {
+			duration = formatDuration(a.End.Sub(a.Start))
+		}
+		fmt.Printf("  %-19s | %-11s | %12s | %10.2f/s | %10.2f/s | %8.1f\n",
+			a.Start.Format("2006-01-02 15:04:05"),
+			a.Kind,
+			duration,
+			a.Rate,
+			a.Baseline,
+			a.Score)
+	}
+	fmt.Println()
+}
+
+// PrintIdleGaps prints the idle gaps of each stream
+func PrintIdleGaps(reports []*IdleGapReport, loc *time.Location) {
+	fmt.Printf("-- Idle Gaps %s\n", strings.Repeat("-", 56))
+	fmt.Println()
+
+	if len(reports) == 0 {
+		fmt.Println("  No streams with enough messages to find idle gaps")
+		fmt.Println()
+		return
+	}
+
+	for _, report := range reports {
+		fmt.Printf("  %s\n", report.StreamName)
+		fmt.Printf("    %-31s %s (p50 %s, p99 %s)\n", "Threshold:", formatInterval(report.Threshold),
+			formatInterval(report.P50Interval), formatInterval(report.P99Interval))
+		if report.TotalGaps == 0 {
+			fmt.Printf("    %-31s none\n", "Idle gaps:")
+			fmt.Println()
+			continue
+		}
+		edges := ""
+		if report.AtEdges > 0 {
+			edges = fmt.Sprintf(", %s at the window edges", humanize.Comma(int64(report.AtEdges)))
+		}
+		fmt.Printf("    %-31s %s (%s no publishes, %s with deleted messages%s)\n", "Idle gaps:",
+			humanize.Comma(int64(report.TotalGaps)), humanize.Comma(int64(report.NoPublishes)), humanize.Comma(int64(report.WithDeletes)), edges)
+		fmt.Printf("    %-31s %s\n", "Idle time:", formatDuration(report.IdleTime))
+		fmt.Println()
+
+		fmt.Printf("    %-19s | %-19s | %12s | %s\n", "From", "To", "Duration", "Publishes")
+		fmt.Printf("    %s-+-%s-+-%s-+-%s\n",
+			strings.Repeat("-", 19),
+			strings.Repeat("-", 19),
+			strings.Repeat("-", 12),
+			strings.Repeat("-", 26))
+		for _, gap := range report.Gaps {
+			publishes := "none"
+			switch gap.Kind() {
+			case IdleWindowEdge:
+				publishes = "unknown, from window start"
+				if gap.NextSeq == 0 {
+					publishes = "unknown, up to window end"
+				}
+			case IdleDeleted:
+				publishes = humanize.Comma(int64(gap.Deleted)) + " deleted"
+				if gap.Cause != "" {
+					publishes += " (" + string(gap.Cause) + ")"
+				}
+			}
+			fmt.Printf("    %-19s | %-19s | %12s | %s\n",
+				gap.Start.In(loc).Format("2006-01-02 15:04:05"),
+				gap.End.In(loc).Format("2006-01-02 15:04:05"),
+				formatDuration(gap.Duration()),
+				publishes)
+		}
+		if report.TotalGaps > len(report.Gaps) {
+			fmt.Printf("    ... %s more (showing the longest)\n", humanize.Comma(int64(report.TotalGaps-len(report.Gaps))))
+		}
+		fmt.Println()
+	}
+}
+
+// PrintForecast prints the forecast stored rate and throughput with their 95% prediction intervals
+func PrintForecast(f *Forecast, opts ForecastOptions, loc *time.Location) {
+	fmt.Printf("-- Forecast %s\n", strings.Repeat("-", 57))
+	fmt.Println()
+
+	if f == nil {
+		fmt.Println("  Not enough history to forecast")
+		fmt.Println()
+		return
+	}
+
+	season := "none"
+	if f.Season > 0 {
+		season = fmt.Sprintf("%s (%d steps)", shortDuration(time.Duration(f.Season)*f.Step), f.Season)
+	}
+	fmt.Printf("  %-33s%s ahead in %s steps\n", "Horizon:", shortDuration(opts.Horizon), shortDuration(f.Step))
+	fmt.Printf("  %-33s%s, from %s steps of history\n", "Season:", season, humanize.Comma(int64(f.History)))
+	fmt.Printf("  %-33salpha %.2f, beta %.2f, gamma %.2f (rmse %.2f msg/s)\n", "Rate model:",
+		f.RateFit.Alpha, f.RateFit.Beta, f.RateFit.Gamma, f.RateFit.RMSE)
+	fmt.Printf("  %-33salpha %.2f, beta %.2f, gamma %.2f (rmse %s)\n", "Throughput model:",
+		f.ThroughputFit.Alpha, f.ThroughputFit.Beta, f.ThroughputFit.Gamma, formatBytesPerSec(f.ThroughputFit.RMSE))
+	fmt.Println()
+
+	fmt.Printf("  %-19s | %12s | %-25s | %12s | %s\n", "Time", "Rate", "95% Interval", "Throughput", "95% Interval")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", 19),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 25),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 25))
+	for _, p := range f.Points {
+		fmt.Printf("  %-19s | %10.2f/s | %-25s | %12s | %s\n",
+			p.Start.In(loc).Format("2006-01-02 15:04:05"),
+			p.Rate,
+			fmt.Sprintf("%.2f - %.2f/s", p.RateLow, p.RateHigh),
+			formatBytesPerSec(p.Throughput),
+			formatBytesPerSec(p.ThroughputLow)+" - "+formatBytesPerSec(p.ThroughputHigh))
+	}
+	fmt.Println()
+}
+
+// maxMatrixStreams is the most streams printed in the correlation matrix
+const maxMatrixStreams = 12
+
+// PrintCorrelation prints the correlation matrix of the busiest streams, the most correlated
+// pairs with their lag and the clusters of streams moving together
+func PrintCorrelation(c *CorrelationAnalysis, opts CorrelationOptions, topN int) {
+	fmt.Printf("-- Stream Correlation %s\n", strings.Repeat("-", 47))
+	fmt.Println()
+
+	if c == nil {
+		fmt.Println("  Correlation needs at least two streams with stored messages")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("  %-33s%s\n", "Step:", shortDuration(c.Step))
+	fmt.Printf("  %-33s%s\n", "Max lag:", shortDuration(c.MaxLag))
+	if c.Omitted > 0 {
+		fmt.Printf("  %-33s%d quieter streams left out\n", "Streams:", c.Omitted)
+	}
+	fmt.Println()
+
+	// Matrix of the busiest streams, columns numbered after the rows
+	n := min(len(c.Streams), maxMatrixStreams)
+	nameWidth := 6
+	for _, name := range c.Streams[:n] {
+		nameWidth = max(nameWidth, len(name))
+	}
+	fmt.Printf("  %3s %-*s |", "", nameWidth, "Stream")
+	for j := range n {
+		fmt.Printf(" %5d", j+1)
+	}
+	fmt.Println()
+	fmt.Printf("  %s-+%s\n", strings.Repeat("-", 4+nameWidth), strings.Repeat("-", 6*n))
+	for i := range n {
+		fmt.Printf("  %3d %-*s |", i+1, nameWidth, c.Streams[i])
+		for j := range n {
+			fmt.Printf(" %5s", formatCorrelation(c.Matrix[i][j]))
+		}
+		fmt.Println()
+	}
+	if len(c.Streams) > n {
+		fmt.Printf("  ... %d more streams in the pairs below\n", len(c.Streams)-n)
+	}
+	fmt.Println()
+
+	if len(c.Pairs) > 0 {
+		pairWidth := 4
+		for _, p := range c.Pairs[:min(topN, len(c.Pairs))] {
+			pairWidth = max(pairWidth, len(p.A)+len(p.B)+5)
+		}
+		fmt.Println("  Most correlated pairs:")
+		fmt.Printf("    %-*s | %11s | %11s | %s\n", pairWidth, "Pair", "Correlation", "At Best Lag", "Lag")
+		fmt.Printf("    %s-+-%s-+-%s-+-%s\n", strings.Repeat("-", pairWidth), strings.Repeat("-", 11), strings.Repeat("-", 11), strings.Repeat("-", 24))
+		for _, p := range c.Pairs[:min(topN, len(c.Pairs))] {
+			fmt.Printf("    %-*s | %11s | %11s | %s\n", pairWidth, p.A+" <-> "+p.B,
+				formatCorrelation(p.Correlation), formatCorrelation(p.LagCorrelation), describeLag(p))
+		}
+		fmt.Println()
+	}
+
+	if len(c.Clusters) == 0 {
+		fmt.Printf("  No clusters of streams with a mean correlation of %.2f or more\n", opts.Threshold)
+		fmt.Println()
+		return
+	}
+	fmt.Printf("  Clusters (mean correlation %.2f or more):\n", opts.Threshold)
+	for i, cluster := range c.Clusters {
+		fmt.Printf("    %d. %s (%.2f)\n", i+1, strings.Join(cluster.Streams, ", "), cluster.MeanCorrelation)
+	}
+	fmt.Println()
+}
+
+// PrintRuleResults prints the violated rules with the values that broke them, and the
+// checks that had no data
+func PrintRuleResults(results []RuleResult, loc *time.Location) {
+	fmt.Printf("-- Rules %s\n", strings.Repeat("-", 60))
+	fmt.Println()
+
+	var violations, noData []RuleResult
+	for _, r := range results {
+		switch {
+		case r.Violated:
+			violations = append(violations, r)
+		case r.NoData:
+			noData = append(noData, r)
+		}
+	}
+	fmt.Printf("  %-33s%d\n", "Checks:", len(results))
+	fmt.Printf("  %-33s%d\n", "Violations:", len(violations))
+	fmt.Printf("  %-33s%d\n", "Without data:", len(noData))
+	fmt.Println()
+
+	streamName := func(r RuleResult) string {
+		if r.Stream == "" {
+			return "(all streams)"
+		}
+		return r.Stream
+	}
+
+	if len(violations) > 0 {
+		ruleWidth, streamWidth := 4, 6
+		for _, r := range violations {
+			ruleWidth = max(ruleWidth, len(r.Rule.Name))
+			streamWidth = max(streamWidth, len(streamName(r)))
+		}
+		fmt.Printf("  %-*s | %-*s | %14s | %s\n", ruleWidth, "Rule", streamWidth, "Stream", "Value", "Condition")
+		fmt.Printf("  %s-+-%s-+-%s-+-%s\n", strings.Repeat("-", ruleWidth), strings.Repeat("-", streamWidth), strings.Repeat("-", 14), strings.Repeat("-", 24))
+		for _, r := range violations {
+			fmt.Printf("  %-*s | %-*s | %14s | %s %s %s\n", ruleWidth, r.Rule.Name, streamWidth, streamName(r),
+				formatStatValue(r.Rule.unit, r.Value, loc), r.Rule.Metric, r.Rule.Op, formatStatValue(r.Rule.unit, r.Rule.limit, loc))
+		}
+		fmt.Println()
+	}
+
+	for _, r := range noData {
+		fmt.Printf("  No data for %s on %s\n", r.Rule.Name, streamName(r))
+	}
+	if len(noData) > 0 {
+		fmt.Println()
+	}
+}
+
+// PrintJSZReplicas prints the stored messages and bytes per server and per stream replica
+// in the last sampling round, with how far each replica trails its leader
+func PrintJSZReplicas(a *JSZAnalysis) {
+	fmt.Printf("-- Servers and Replicas %s\n", strings.Repeat("-", 45))
+	fmt.Println()
+
+	fmt.Printf("  %-33s%d\n", "Sampling rounds:", a.Rounds)
+	fmt.Printf("  %-33s%d\n", "Servers answering:", a.Servers)
+	fmt.Printf("  %-33s%s\n", "Interval:", shortDuration(a.Histogram.Layout.Nominal()))
+	fmt.Println()
+
+	if len(a.Replicas) == 0 {
+		fmt.Println("  No replicas in the last sampling round")
+		fmt.Println()
+		return
+	}
+
+	type serverTotals struct {
+		Name, Cluster    string
+		Streams, Leaders int
+		Messages, Bytes  uint64
+		FirstBytes       uint64
+	}
+	servers := make(map[string]*serverTotals)
+	leaders := make(map[string]JSZReplica)
+	streamName := func(r JSZReplica) string {
+		return r.Account + "/" + r.Stream
+	}
+	for _, r := range a.Replicas {
+		s := servers[r.Server]
+		if s == nil {
+			s = &serverTotals{Name: r.Server, Cluster: r.Cluster}
+			servers[r.Server] = s
+		}
+		s.Streams++
+		s.Messages += r.Messages
+		s.Bytes += r.Bytes
+		s.FirstBytes += a.First[replicaKey(r)].Bytes
+		if r.Leader {
+			s.Leaders++
+			leaders[streamName(r)] = r
+		}
+	}
+	var totals []*serverTotals
+	serverWidth, clusterWidth := 6, 7
+	for _, s := range servers {
+		totals = append(totals, s)
+		serverWidth = max(serverWidth, len(s.Name))
+		clusterWidth = max(clusterWidth, len(s.Cluster))
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Name < totals[j].Name })
+
+	fmt.Printf("  %-*s | %-*s | %7s | %7s | %12s | %10s | %11s\n", serverWidth, "Server", clusterWidth, "Cluster",
+		"Streams", "Leaders", "Messages", "Bytes", "Bytes Delta")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s\n", strings.Repeat("-", serverWidth), strings.Repeat("-", clusterWidth),
+		strings.Repeat("-", 7), strings.Repeat("-", 7), strings.Repeat("-", 12), strings.Repeat("-", 10), strings.Repeat("-", 11))
+	for _, s := range totals {
+		delta := "+" + formatBytes(int64(s.Bytes-s.FirstBytes))
+		if s.Bytes < s.FirstBytes {
+			delta = "-" + formatBytes(int64(s.FirstBytes-s.Bytes))
+		}
+		fmt.Printf("  %-*s | %-*s | %7d | %7d | %12s | %10s | %11s\n", serverWidth, s.Name, clusterWidth, s.Cluster,
+			s.Streams, s.Leaders, humanize.Comma(int64(s.Messages)), formatBytes(int64(s.Bytes)), delta)
+	}
+	fmt.Println()
+
+	replicas := append([]JSZReplica(nil), a.Replicas...)
+	sort.Slice(replicas, func(i, j int) bool {
+		if streamName(replicas[i]) != streamName(replicas[j]) {
+			return streamName(replicas[i]) < streamName(replicas[j])
+		}
+		if replicas[i].Leader != replicas[j].Leader {
+			return replicas[i].Leader
+		}
+		return replicas[i].Server < replicas[j].Server
+	})
+	streamWidth := 6
+	for _, r := range replicas {
+		streamWidth = max(streamWidth, len(streamName(r)))
+	}
+	fmt.Printf("  %-*s | %-*s | %-7s | %12s | %10s | %12s | %13s | %9s\n", streamWidth, "Stream", serverWidth, "Server",
+		"Role", "Messages", "Bytes", "Last Seq", "Behind Leader", "Lag")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s\n", strings.Repeat("-", streamWidth), strings.Repeat("-", serverWidth),
+		strings.Repeat("-", 7), strings.Repeat("-", 12), strings.Repeat("-", 10), strings.Repeat("-", 12), strings.Repeat("-", 13), strings.Repeat("-", 9))
+	for _, r := range replicas {
+		role, behind := "replica", "-"
+		if r.Leader {
+			role = "leader"
+		} else if leader, ok := leaders[streamName(r)]; ok && leader.LastSeq >= r.LastSeq {
+			behind = humanize.Comma(int64(leader.LastSeq - r.LastSeq))
+		}
+		fmt.Printf("  %-*s | %-*s | %-7s | %12s | %10s | %12s | %13s | %9s\n", streamWidth, streamName(r), serverWidth, r.Server,
+			role, humanize.Comma(int64(r.Messages)), formatBytes(int64(r.Bytes)), humanize.Comma(int64(r.LastSeq)),
+			behind, humanize.Comma(int64(r.Lag)))
+	}
+	fmt.Println()
+}
+
+// maxAdvisoryRows is the most buckets with advisories listed on the timeline
+const maxAdvisoryRows = 50
+
+// PrintAdvisories prints the advisories read from an advisory stream: totals per kind, the
+// ack latency histogram, the buckets with advisories next to their publish rate, and the
+// most frequent API errors and consumers exceeding max deliveries
+func PrintAdvisories(a *AdvisoryAnalysis, stream string, read int, loc *time.Location) {
+	title := fmt.Sprintf("Advisories (%s)", stream)
+	fmt.Printf("-- %s %s\n", title, strings.Repeat("-", max(4, 65-len(title))))
+	fmt.Println()
+
+	fmt.Printf("  %-33s%s\n", "Advisories read:", humanize.Comma(int64(read)))
+	for _, k := range advisoryKinds {
+		fmt.Printf("  %-33s%s\n", k.Label+":", humanize.Comma(int64(a.Totals[k.Kind])))
+	}
+	if a.Outside > 0 {
+		fmt.Printf("  %-33s%s\n", "Outside the analyzed buckets:", humanize.Comma(int64(a.Outside)))
+	}
+	fmt.Println()
+
+	if lat := a.AckLatency; lat.Count > 0 {
+		fmt.Println("  Ack Latency:")
+		fmt.Printf("    %-31s%s\n", "Average:", formatInterval(lat.Avg))
+		fmt.Printf("    %-31s%s\n", "P50:", formatInterval(lat.P50))
+		fmt.Printf("    %-31s%s\n", "P90:", formatInterval(lat.P90))
+		fmt.Printf("    %-31s%s\n", "P99:", formatInterval(lat.P99))
+		fmt.Printf("    %-31s%s\n", "Max:", formatInterval(lat.Max))
+		fmt.Println()
+
+		maxCount := 0
+		for _, count := range a.AckBins {
+			maxCount = max(maxCount, count)
+		}
+		graphWidth := getGraphWidth(2 + 14 + 3 + 12 + 3 + 6 + 3)
+		fmt.Printf("  %-14s | %12s | %6s | %s\n", "Latency", "Acks", "Share", "Acks")
+		fmt.Printf("  %s-+-%s-+-%s-+-%s\n", strings.Repeat("-", 14), strings.Repeat("-", 12), strings.Repeat("-", 6), strings.Repeat("-", graphWidth))
+		for i, count := range a.AckBins {
+			barLen := int(float64(count) / float64(maxCount) * float64(graphWidth))
+			if barLen < 1 && count > 0 {
+				barLen = 1
+			}
+			fmt.Printf("  %-14s | %12s | %5.1f%% | %s\n", ackLatencyBins[i].Label, humanize.Comma(int64(count)),
+				float64(count)/float64(lat.Count)*100, strings.Repeat("█", barLen))
+		}
+		fmt.Println()
+	}
+
+	// Timeline of the buckets with advisories other than acks, next to their publish rate
+	var rows []AdvisoryBucket
+	for _, b := range a.Buckets {
+		if len(b.Counts) > 1 || b.Counts[AdvisoryAck] == 0 {
+			rows = append(rows, b)
+		}
+	}
+	if len(rows) == 0 {
+		fmt.Println("  No advisories other than acks in the analyzed buckets")
+		fmt.Println()
+	} else {
+		fmt.Printf("  %-19s | %12s | %8s | %8s | %8s | %8s | %8s | %10s\n",
+			"Bucket", "Publish Rate", "API Err", "Max Dlv", "Leader", "Created", "Deleted", "Ack P99")
+		fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s\n", strings.Repeat("-", 19), strings.Repeat("-", 12),
+			strings.Repeat("-", 8), strings.Repeat("-", 8), strings.Repeat("-", 8), strings.Repeat("-", 8), strings.Repeat("-", 8), strings.Repeat("-", 10))
+		count := func(n int) string {
+			if n == 0 {
+				return "-"
+			}
+			return humanize.Comma(int64(n))
+		}
+		for _, b := range rows[:min(len(rows), maxAdvisoryRows)] {
+			ackP99 := "-"
+			if b.AckP99 > 0 {
+				ackP99 = formatInterval(b.AckP99)
+			}
+			fmt.Printf("  %-19s | %10.2f/s | %8s | %8s | %8s | %8s | %8s | %10s\n",
+				b.Start.In(loc).Format("2006-01-02 15:04:05"), b.Rate,
+				count(b.Counts[AdvisoryAPIError]), count(b.Counts[AdvisoryMaxDeliver]), count(b.Counts[AdvisoryLeaderElected]),
+				count(b.Counts[AdvisoryStreamCreated]), count(b.Counts[AdvisoryStreamDeleted]), ackP99)
+		}
+		if len(rows) > maxAdvisoryRows {
+			fmt.Printf("  ... %s more buckets with advisories\n", humanize.Comma(int64(len(rows)-maxAdvisoryRows)))
+		}
+		fmt.Println()
+	}
+
+	printAdvisoryCounts := func(title string, counts []AdvisoryCount) {
+		if len(counts) == 0 {
+			return
+		}
+		fmt.Printf("  %s:\n", title)
+		for _, c := range counts {
+			fmt.Printf("    %10s  %s\n", humanize.Comma(int64(c.Count)), c.Key)
+		}
+		fmt.Println()
+	}
+	printAdvisoryCounts("Most frequent API errors", a.TopErrors)
+	printAdvisoryCounts("Consumers exceeding max deliveries", a.TopMaxDeliver)
+}
+
+// formatCorrelation formats a correlation coefficient, "-" when undefined
+func formatCorrelation(c float64) string {
+	if math.IsNaN(c) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", c)
+}
+
+// describeLag tells which stream of a pair leads at its strongest correlation
+func describeLag(p StreamPairCorrelation) string {
+	switch {
+	case p.Lag > 0:
+		return fmt.Sprintf("%s trails by %s", p.B, shortDuration(p.Lag))
+	case p.Lag < 0:
+		return fmt.Sprintf("%s leads by %s", p.B, shortDuration(-p.Lag))
+	default:
+		return "in step"
+	}
+}
+
+// formatInterval formats a duration with sub-second precision, for inter-arrival times
+func formatInterval(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "0s"
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.1fµs", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	}
+	return formatDuration(d)
+}
+
+// burstinessLabel describes a burstiness coefficient
+func burstinessLabel(b float64) string {
+	switch {
+	case b < -0.3:
+		return "regular"
+	case b <= 0.3:
+		return "random"
+	}
+	return "bursty"
+}
+
+// PrintInterArrival prints the inter-arrival time statistics and histogram of each stream
+func PrintInterArrival(stats []*InterArrivalStats) {
+	fmt.Printf("-- Inter-arrival Times %s\n", strings.Repeat("-", 46))
+	fmt.Println()
+
+	if len(stats) == 0 {
+		fmt.Println("  Not enough messages to measure inter-arrival times")
+		fmt.Println()
+		return
+	}
+
+	for _, s := range stats {
+		name := s.StreamName
+		if name == "" {
+			name = "All streams"
+		}
+		fmt.Printf("  %s (%s intervals)\n", name, humanize.Comma(int64(s.Intervals)))
+		fmt.Printf("    %-31s %s / %s\n", "Mean / StdDev:", formatInterval(s.Mean), formatInterval(s.StdDev))
+		fmt.Printf("    %-31s %s / %s / %s / %s\n", "P50 / P90 / P99 / P99.9:",
+			formatInterval(s.P50), formatInterval(s.P90), formatInterval(s.P99), formatInterval(s.P999))
+		fmt.Printf("    %-31s %s / %s\n", "Min / Max:", formatInterval(s.Min), formatInterval(s.Max))
+		fmt.Printf("    %-31s %.2f / %.2f (%s)\n", "CV / Burstiness:", s.CV, s.Burstiness, burstinessLabel(s.Burstiness))
+		if s.Batches > 0 {
+			fmt.Printf("    %-31s %s batches, %s msgs (%.1f%%), largest %s\n", "Same-timestamp batches:",
+				humanize.Comma(int64(s.Batches)), humanize.Comma(int64(s.BatchedMsgs)), s.BatchedShare()*100, humanize.Comma(int64(s.MaxBatch)))
+		} else {
+			fmt.Printf("    %-31s none\n", "Same-timestamp batches:")
+		}
+		fmt.Println()
+
+		// Leave out the empty bins beyond the shortest and longest intervals
+		first, last := len(s.Histogram), 0
+		maxCount := 0
+		for i, bin := range s.Histogram[1:] {
+			if bin.Count > 0 {
+				first = min(first, i+1)
+				last = i + 1
+			}
+			maxCount = max(maxCount, bin.Count)
+		}
+		maxCount = max(maxCount, s.Histogram[0].Count)
+		bins := append([]InterArrivalBin{s.Histogram[0]}, s.Histogram[first:last+1]...)
+
+		// Fixed cols: "    " + label(13) + " | " + count(10) + " | " + share(6) + " | "
+		graphWidth := getGraphWidth(4 + 13 + 3 + 10 + 3 + 6 + 3)
+		fmt.Printf("    %-13s | %10s | %6s | %s\n", "Interval", "Count", "Share", "Graph")
+		fmt.Printf("    %s-+-%s-+-%s-+-%s\n",
+			strings.Repeat("-", 13),
+			strings.Repeat("-", 10),
+			strings.Repeat("-", 6),
+			strings.Repeat("-", graphWidth))
+		for _, bin := range bins {
+			barLen := 0
+			if maxCount > 0 {
+				barLen = int(float64(bin.Count) / float64(maxCount) * float64(graphWidth))
+			}
+			if barLen < 1 && bin.Count > 0 {
+				barLen = 1
+			}
+			fmt.Printf("    %-13s | %10s | %5.1f%% | %s\n",
+				interArrivalBinLabel(bin),
+				humanize.Comma(int64(bin.Count)),
+				float64(bin.Count)/float64(s.Intervals)*100,
+				strings.Repeat("█", barLen))
+		}
+		fmt.Println()
+	}
+}
+
+// PrintSizeDistribution prints the log2 message size histogram and the size classes of a histogram
+func PrintSizeDistribution(hist *RateHistogram) {
+	if hist == nil {
+		return
+	}
+
+	sizes := mergeBucketSketches(hist.Buckets).Log2Histogram()
+	total := sizes.Total()
+	fmt.Printf("-- Message Sizes %s\n", strings.Repeat("-", 52))
+	fmt.Println()
+	if total == 0 {
+		fmt.Println("  No messages")
+		fmt.Println()
+		return
+	}
+
+	var totalBytes int64
+	first := -1
+	maxCount := 0
+	for bin, count := range sizes.Counts {
+		totalBytes += sizes.Bytes[bin]
+		if count > 0 && first < 0 {
+			first = bin
+		}
+		maxCount = max(maxCount, count)
+	}
+
+	// Fixed cols: "  " + size(17) + " | " + msgs(12) + " | " + pct(6) + " | " + bytes(10) + " | " + pct(6) + " | "
+	graphWidth := getGraphWidth(2 + 17 + 3 + 12 + 3 + 6 + 3 + 10 + 3 + 6 + 3)
+	fmt.Printf("  %-17s | %12s | %6s | %10s | %6s | %s\n", "Size", "Messages", "Share", "Bytes", "Share", "Messages")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", 17),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 6),
+		strings.Repeat("-", 10),
+		strings.Repeat("-", 6),
+		strings.Repeat("-", graphWidth))
+	for bin := first; bin < len(sizes.Counts); bin++ {
+		count := sizes.Counts[bin]
+		barLen := int(float64(count) / float64(maxCount) * float64(graphWidth))
+		if barLen < 1 && count > 0 {
+			barLen = 1
+		}
+		fmt.Printf("  %-17s | %12s | %5.1f%% | %10s | %5.1f%% | %s\n",
+			sizeBinLabel(bin),
+			humanize.Comma(int64(count)),
+			float64(count)/float64(total)*100,
+			formatBytes(sizes.Bytes[bin]),
+			shareOf(sizes.Bytes[bin], totalBytes),
+			strings.Repeat("█", barLen))
+	}
+	fmt.Println()
+
+	fmt.Printf("  %-17s | %12s | %6s | %10s | %6s\n", "Size Class", "Messages", "Share", "Bytes", "Share")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", 17),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 6),
+		strings.Repeat("-", 10),
+		strings.Repeat("-", 6))
+	for i, v := range sizes.Classes() {
+		fmt.Printf("  %-17s | %12s | %5.1f%% | %10s | %5.1f%%\n",
+			sizeClasses[i].Label,
+			humanize.Comma(int64(v.Messages)),
+			float64(v.Messages)/float64(total)*100,
+			formatBytes(v.Bytes),
+			shareOf(v.Bytes, totalBytes))
+	}
+	fmt.Println()
+}
+
+// shareOf returns part as a percentage of total, 0 if total is 0
+func shareOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// PrintComparison prints the changes from the baseline to the current analysis: every
+// rate statistic and the per-stream distribution, then the statistics of each stream
+func PrintComparison(c *Comparison, perStream bool, loc *time.Location) {
+	fmt.Println(strings.Repeat("=", headerWidth))
+	fmt.Println("TRAFFIC COMPARISON REPORT")
+	fmt.Println(strings.Repeat("=", headerWidth))
+	fmt.Println()
+
+	printComparisonSide("Baseline:", c.Baseline, loc)
+	printComparisonSide("Current:", c.Current, loc)
+	if c.Shift != 0 {
+		fmt.Printf("  %-33s%s\n", "Baseline shifted by:", formatDuration(c.Shift.Abs()))
+	}
+	fmt.Println()
+
+	printStatDeltas("All Streams", c.Stats, loc)
+	printStreamDeltas(c.Streams)
+
+	if !perStream {
+		return
+	}
+	for _, s := range c.Streams {
+		printStatDeltas("Stream "+s.Name, c.StreamStats(s.Name), loc)
+	}
+}
+
+// printComparisonSide prints the label and time range of one side of a comparison
+func printComparisonSide(title string, side ComparisonSide, loc *time.Location) {
+	fmt.Printf("  %-33s%s\n", title, side.Label)
+	fmt.Printf("    %-31s%s to %s (%s messages)\n", "Window:",
+		side.WindowStart.In(loc).Format("2006-01-02 15:04:05"),
+		side.WindowEnd.In(loc).Format("2006-01-02 15:04:05"),
+		humanize.Comma(int64(side.Summary.TotalMsgs)))
+}
+
+// printStatDeltas prints a table of statistic changes
+func printStatDeltas(title string, deltas []StatDelta, loc *time.Location) {
+	fmt.Printf("-- %s %s\n", title, strings.Repeat("-", max(4, 65-len(title))))
+	fmt.Println()
+	fmt.Printf("  %-18s | %14s | %14s | %14s | %8s\n", "Statistic", "Baseline", "Current", "Delta", "Change")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", 18),
+		strings.Repeat("-", 14),
+		strings.Repeat("-", 14),
+		strings.Repeat("-", 14),
+		strings.Repeat("-", 8))
+	for _, d := range deltas {
+		fmt.Printf("  %-18s | %14s | %14s | %14s | %8s\n",
+			d.Name,
+			formatStatValue(d.Unit, d.Baseline, loc),
+			formatStatValue(d.Unit, d.Current, loc),
+			formatStatDelta(d.Unit, d.Delta()),
+			formatChange(d.Change()))
+	}
+	fmt.Println()
+}
+
+// printStreamDeltas prints the change of each stream's messages, bytes and share of the messages
+func printStreamDeltas(deltas []StreamDelta) {
+	if len(deltas) == 0 {
+		return
+	}
+
+	maxNameLen := 6
+	for _, d := range deltas {
+		maxNameLen = max(maxNameLen, len(d.Name))
+	}
+
+	fmt.Printf("-- Streams Distribution %s\n", strings.Repeat("-", 45))
+	fmt.Println()
+	fmt.Printf("  %-*s | %12s | %12s | %8s | %10s | %10s | %8s | %6s | %6s | %7s\n", maxNameLen,
+		"Stream", "Base Msgs", "Cur Msgs", "Change", "Base Data", "Cur Data", "Change", "Base %", "Cur %", "Delta")
+	fmt.Printf("  %s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s-+-%s\n",
+		strings.Repeat("-", maxNameLen),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 12),
+		strings.Repeat("-", 8),
+		strings.Repeat("-", 10),
+		strings.Repeat("-", 10),
+		strings.Repeat("-", 8),
+		strings.Repeat("-", 6),
+		strings.Repeat("-", 6),
+		strings.Repeat("-", 7))
+	for _, d := range deltas {
+		msgs := StatDelta{Unit: UnitCount, Baseline: float64(d.BaseMessages), Current: float64(d.CurMessages)}
+		bytes := StatDelta{Unit: UnitBytes, Baseline: float64(d.BaseBytes), Current: float64(d.CurBytes)}
+		fmt.Printf("  %-*s | %12s | %12s | %8s | %10s | %10s | %8s | %5.1f%% | %5.1f%% | %+6.1fpp\n", maxNameLen,
+			d.Name,
+			humanize.Comma(int64(d.BaseMessages)),
+			humanize.Comma(int64(d.CurMessages)),
+			formatChange(msgs.Change()),
+			formatBytes(d.BaseBytes),
+			formatBytes(d.CurBytes),
+			formatChange(bytes.Change()),
+			d.BaseShare,
+			d.CurShare,
+			d.CurShare-d.BaseShare)
+	}
+	fmt.Println()
+}
+
+// formatStatValue formats a statistic in its unit
+func formatStatValue(unit StatUnit, v float64, loc *time.Location) string {
+	switch unit {
+	case UnitCount:
+		return humanize.Comma(int64(v))
+	case UnitRate:
+		return fmt.Sprintf("%.2f/s", v)
+	case UnitBytes:
+		return formatBytes(int64(v))
+	case UnitThroughput:
+		return formatBytesPerSec(v)
+	case UnitDuration:
+		return formatDuration(time.Duration(v))
+	case UnitTime:
+		if v == 0 {
+			return "-"
+		}
+		return time.Unix(0, int64(v)).In(loc).Format("01-02 15:04:05")
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// formatStatDelta formats the change of a statistic with its sign
+func formatStatDelta(unit StatUnit, delta float64) string {
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+	}
+	delta = math.Abs(delta)
+	switch unit {
+	case UnitCount:
+		return sign + humanize.Comma(int64(delta))
+	case UnitRate:
+		return fmt.Sprintf("%s%.2f/s", sign, delta)
+	case UnitBytes:
+		return sign + formatBytes(int64(delta))
+	case UnitThroughput:
+		return sign + formatBytesPerSec(delta)
+	case UnitDuration, UnitTime:
+		return sign + formatDuration(time.Duration(delta))
+	}
+	return fmt.Sprintf("%s%.2f", sign, delta)
+}
+
+// formatChange formats a relative change as a percentage, "-" if there is none. Growth of
+// ten times or more is shown as a multiple of the baseline to keep the column narrow.
+func formatChange(change float64, ok bool) string {
+	switch {
+	case !ok:
+		return "-"
+	case change >= 9:
+		return fmt.Sprintf("%.0fx", change+1)
+	}
+	return fmt.Sprintf("%+.1f%%", change*100)
 }
 
 // printRateGraph prints a time-series graph showing rate per bucket over time
@@ -516,7 +1612,7 @@ func printRateGraph(hist *RateHistogram, minRatePct float64) {
 	printSkipped := func() {
 		if skipCount > 0 && skipStart != nil {
 			startStr := skipStart.Format("2006-01-02 15:04:05")
-			duration := skipEnd.Sub(*skipStart) + hist.Granularity
+			duration := skipEnd.Sub(*skipStart)
 			durationStr := "+" + formatDuration(duration)
 			rateMsg := fmt.Sprintf("... %d skipped %s ...", skipCount, durationStr)
 			fmt.Printf("  %-19s | %-*s\n", startStr, graphWidth, rateMsg)
@@ -528,7 +1624,7 @@ func printRateGraph(hist *RateHistogram, minRatePct float64) {
 	printDelOnly := func() {
 		if delOnlyCount > 0 && delOnlyStart != nil {
 			startStr := delOnlyStart.Format("2006-01-02 15:04:05")
-			duration := delOnlyEnd.Sub(*delOnlyStart) + hist.Granularity
+			duration := delOnlyEnd.Sub(*delOnlyStart)
 			durationStr := "+" + formatDuration(duration)
 			rateMsg := fmt.Sprintf("... %d del-only %s ...", delOnlyCount, durationStr)
 			fmt.Printf("  %-19s | %-*s\n", startStr, graphWidth, rateMsg)
@@ -547,7 +1643,7 @@ func printRateGraph(hist *RateHistogram, minRatePct float64) {
 				t := bucket.Start
 				skipStart = &t
 			}
-			skipEnd = bucket.Start
+			skipEnd = bucket.End
 			skipCount++
 			continue
 		}
@@ -560,7 +1656,7 @@ func printRateGraph(hist *RateHistogram, minRatePct float64) {
 				t := bucket.Start
 				delOnlyStart = &t
 			}
-			delOnlyEnd = bucket.Start
+			delOnlyEnd = bucket.End
 			delOnlyCount++
 			delOnlyTotal += bucket.SeqCount
 			continue
@@ -675,7 +1771,7 @@ func printCombinedGraph(hist *RateHistogram, minRatePct float64) {
 	printSkipped := func() {
 		if skipCount > 0 && skipStart != nil {
 			startStr := skipStart.Format("2006-01-02 15:04:05")
-			duration := skipEnd.Sub(*skipStart) + hist.Granularity
+			duration := skipEnd.Sub(*skipStart)
 			durationStr := "+" + formatDuration(duration)
 			rateMsg := fmt.Sprintf("... %d skipped %s ...", skipCount, durationStr)
 			tputMsg := fmt.Sprintf("... %s ...", durationStr)
@@ -689,7 +1785,7 @@ func printCombinedGraph(hist *RateHistogram, minRatePct float64) {
 	printDelOnly := func() {
 		if delOnlyCount > 0 && delOnlyStart != nil {
 			startStr := delOnlyStart.Format("2006-01-02 15:04:05")
-			duration := delOnlyEnd.Sub(*delOnlyStart) + hist.Granularity
+			duration := delOnlyEnd.Sub(*delOnlyStart)
 			durationStr := "+" + formatDuration(duration)
 			rateMsg := fmt.Sprintf("... %d del-only %s ...", delOnlyCount, durationStr)
 			tputMsg := fmt.Sprintf("... %s ...", durationStr)
@@ -711,7 +1807,7 @@ func printCombinedGraph(hist *RateHistogram, minRatePct float64) {
 				t := bucket.Start
 				skipStart = &t
 			}
-			skipEnd = bucket.Start
+			skipEnd = bucket.End
 			skipCount++
 			continue
 		}
@@ -724,7 +1820,7 @@ func printCombinedGraph(hist *RateHistogram, minRatePct float64) {
 				t := bucket.Start
 				delOnlyStart = &t
 			}
-			delOnlyEnd = bucket.Start
+			delOnlyEnd = bucket.End
 			delOnlyCount++
 			delOnlyTotal += bucket.SeqCount
 			continue
@@ -885,7 +1981,7 @@ func printThroughputGraph(hist *RateHistogram, minRatePct float64) {
 	printSkipped := func() {
 		if skipCount > 0 && skipStart != nil {
 			startStr := skipStart.Format("2006-01-02 15:04:05")
-			duration := skipEnd.Sub(*skipStart) + hist.Granularity // Include the last bucket
+			duration := skipEnd.Sub(*skipStart) // Ends with the last bucket
 			fmt.Printf("  %-20s | %12s | ... %d buckets skipped ...\n", startStr, "+"+formatDuration(duration), skipCount)
 			skipCount = 0
 			skipStart = nil
@@ -899,7 +1995,7 @@ func printThroughputGraph(hist *RateHistogram, minRatePct float64) {
 				t := bucket.Start
 				skipStart = &t
 			}
-			skipEnd = bucket.Start
+			skipEnd = bucket.End
 			skipCount++
 			continue
 		}
@@ -926,10 +2022,12 @@ func printThroughputGraph(hist *RateHistogram, minRatePct float64) {
 }
 
 // printRateStats prints the rate and throughput statistics
-func printRateStats(stats RateStatistics, showRate, showThroughput bool) {
+func printRateStats(stats RateStatistics, interpolation InterpolationStrategy, showRate, showThroughput bool) {
 	fmt.Println("Statistics:")
 	fmt.Printf("  Total Messages:                %s\n", humanize.Comma(int64(stats.TotalMessages)))
-	fmt.Printf("  Total Messages (per seq nums):  %s\n", humanize.Comma(int64(stats.LastSeq-stats.FirstSeq+1)))
+	if stats.HasSeqRange() {
+		fmt.Printf("  Total Messages (per seq nums):  %s\n", humanize.Comma(int64(stats.LastSeq-stats.FirstSeq+1)))
+	}
 	fmt.Printf("  Total Data:                    %s\n", formatBytes(stats.TotalBytes))
 	fmt.Printf("  Time Span:                     %s (%s to %s)\n",
 		formatDuration(stats.TotalDuration),
@@ -953,16 +2051,18 @@ func printRateStats(stats RateStatistics, showRate, showThroughput bool) {
 		fmt.Printf("    Std Dev:        %.2f msg/s\n", stats.StdDevRate)
 		fmt.Println()
 
-		fmt.Println("  Message Storage Rate (per sequence numbers, with deletes interpolated):")
-		fmt.Printf("    Average:        %.2f msg/s\n", stats.AvgSeqRate)
-		fmt.Printf("    P50:            %.2f msg/s\n", stats.P50SeqRate)
-		fmt.Printf("    P90:            %.2f msg/s\n", stats.P90SeqRate)
-		fmt.Printf("    P99:            %.2f msg/s\n", stats.P99SeqRate)
-		fmt.Printf("    P99.9:          %.2f msg/s\n", stats.P999SeqRate)
-		fmt.Printf("    Min:            %.2f msg/s\n", stats.MinSeqRate)
-		fmt.Printf("    Max:            %.2f msg/s\n", stats.MaxSeqRate)
-		fmt.Printf("    Std Dev:        %.2f msg/s\n", stats.StdDevSeqRate)
-		fmt.Println()
+		if stats.HasSeqRange() {
+			fmt.Printf("  Message Storage Rate (per sequence numbers, with deletes interpolated, %s):\n", interpolation)
+			fmt.Printf("    Average:        %.2f msg/s\n", stats.AvgSeqRate)
+			fmt.Printf("    P50:            %.2f msg/s\n", stats.P50SeqRate)
+			fmt.Printf("    P90:            %.2f msg/s\n", stats.P90SeqRate)
+			fmt.Printf("    P99:            %.2f msg/s\n", stats.P99SeqRate)
+			fmt.Printf("    P99.9:          %.2f msg/s\n", stats.P999SeqRate)
+			fmt.Printf("    Min:            %.2f msg/s\n", stats.MinSeqRate)
+			fmt.Printf("    Max:            %.2f msg/s\n", stats.MaxSeqRate)
+			fmt.Printf("    Std Dev:        %.2f msg/s\n", stats.StdDevSeqRate)
+			fmt.Println()
+		}
 	}
 
 	if showThroughput {
@@ -1054,7 +2154,8 @@ func WriteCSV(filename string, hist *RateHistogram, streamName string) error {
 	defer writer.Flush()
 
 	// Write header
-	header := []string{"stream", "timestamp", "count", "bytes", "rate_msg_per_sec", "throughput_bytes_per_sec"}
+	header := []string{"stream", "timestamp", "count", "bytes", "rate_msg_per_sec", "throughput_bytes_per_sec", "seq_count", "seq_rate_msg_per_sec", "interpolation",
+		"count_lt_1kib", "count_1kib_64kib", "count_ge_64kib", "bytes_lt_1kib", "bytes_1kib_64kib", "bytes_ge_64kib"}
 	if err := writer.Write(header); err != nil {
 		return fmt.Errorf("failed to write CSV header: %w", err)
 	}
@@ -1068,7 +2169,11 @@ func WriteCSV(filename string, hist *RateHistogram, streamName string) error {
 			fmt.Sprintf("%d", bucket.Bytes),
 			fmt.Sprintf("%.2f", bucket.Rate),
 			fmt.Sprintf("%.2f", bucket.Throughput),
+			fmt.Sprintf("%d", bucket.SeqCount),
+			fmt.Sprintf("%.2f", bucket.SeqRate),
+			string(hist.Interpolation),
 		}
+		row = append(row, sizeClassColumns(bucket.SizeSketch)...)
 		if err := writer.Write(row); err != nil {
 			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
@@ -1097,7 +2202,11 @@ func AppendCSV(filename string, hist *RateHistogram, streamName string) error {
 			fmt.Sprintf("%d", bucket.Bytes),
 			fmt.Sprintf("%.2f", bucket.Rate),
 			fmt.Sprintf("%.2f", bucket.Throughput),
+			fmt.Sprintf("%d", bucket.SeqCount),
+			fmt.Sprintf("%.2f", bucket.SeqRate),
+			string(hist.Interpolation),
 		}
+		row = append(row, sizeClassColumns(bucket.SizeSketch)...)
 		if err := writer.Write(row); err != nil {
 			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
@@ -1105,3 +2214,16 @@ func AppendCSV(filename string, hist *RateHistogram, streamName string) error {
 
 	return nil
 }
+
+// sizeClassColumns returns the CSV columns of the size classes: messages, then bytes per class
+func sizeClassColumns(sizes *SizeSketch) []string {
+	classes := sizes.Log2Histogram().Classes()
+	cols := make([]string, 0, 2*len(classes))
+	for _, v := range classes {
+		cols = append(cols, fmt.Sprintf("%d", v.Messages))
+	}
+	for _, v := range classes {
+		cols = append(cols, fmt.Sprintf("%d", v.Bytes))
+	}
+	return cols
+}
@@ -0,0 +1,698 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/dustin/go-humanize"
+)
+
+// Commands of the CLI, analyze is the default
+const (
+	cmdAnalyze  = "analyze"
+	cmdServe    = "serve"
+	cmdExport   = "export"
+	cmdCompare  = "compare"
+	cmdSnapshot = "snapshot"
+	cmdConfig   = "config"
+)
+
+// Environment variables naming the config file and profile
+const (
+	configEnvar  = "JTH_CONFIG"
+	profileEnvar = "JTH_PROFILE"
+)
+
+// flagGroup is a set of related flags shared by the commands that need them, validated after
+// parsing when the command that ran has them
+type flagGroup struct {
+	add      func(cmd *fisk.CmdClause, cfg *Config)
+	validate func(cfg *Config)
+}
+
+var (
+	streamFlags      = flagGroup{add: addStreamFlags}
+	fetchFlags       = flagGroup{add: addFetchFlags, validate: validateFetchFlags}
+	windowFlags      = flagGroup{add: addWindowFlags, validate: validateWindowFlags}
+	bucketFlags      = flagGroup{add: addBucketFlags, validate: validateBucketFlags}
+	reportFlags      = flagGroup{add: addReportFlags, validate: validateReportFlags}
+	analysisFlags    = flagGroup{add: addAnalysisFlags, validate: validateAnalysisFlags}
+	advisoryFlags    = flagGroup{add: addAdvisoryFlags}
+	jszFlags         = flagGroup{add: addJSZFlags, validate: validateJSZFlags}
+	compareFlags     = flagGroup{add: addCompareFlags, validate: validateCompareFlags}
+	compareOutFlags  = flagGroup{add: addCompareOutputFlags}
+	guiFlags         = flagGroup{add: addGUIFlags}
+	exportFlags      = flagGroup{add: addExportFlags, validate: validateExportFlags}
+	snapshotFileArgs = flagGroup{add: addSnapshotFileArgs, validate: validateSnapshotFileArgs}
+)
+
+// commands lists the commands with their flag groups
+var commands = []struct {
+	name   string
+	help   string
+	groups []flagGroup
+}{
+	{cmdAnalyze, "Analyze the stored message rates and print the report (default)",
+		[]flagGroup{streamFlags, fetchFlags, windowFlags, bucketFlags, reportFlags, analysisFlags, advisoryFlags, jszFlags}},
+	{cmdServe, "Analyze the stored message rates and explore them in the web-based interactive GUI",
+		[]flagGroup{streamFlags, fetchFlags, windowFlags, bucketFlags, analysisFlags, advisoryFlags, jszFlags, compareFlags, guiFlags}},
+	{cmdExport, "Export the histograms to CSV or publish the analysis into JetStream or KV",
+		[]flagGroup{streamFlags, fetchFlags, windowFlags, bucketFlags, jszFlags, exportFlags}},
+	{cmdCompare, "Compare the stored message rates with an earlier window or a saved snapshot",
+		[]flagGroup{streamFlags, fetchFlags, windowFlags, bucketFlags, compareFlags, compareOutFlags}},
+	{cmdSnapshot, "Save the analysis to a snapshot file for later comparison",
+		[]flagGroup{streamFlags, fetchFlags, windowFlags, bucketFlags, snapshotFileArgs}},
+}
+
+func parseFlags() Config {
+	cfg := Config{}
+
+	app := fisk.New("js-traffic-history", "Analyze stored message rates across NATS JetStream for accessible streams in the account (with limits retention policy)")
+	app.Version(version)
+	app.Author("JNM at Synadia")
+
+	app.Flag("context", "NATS context name (uses default if empty)").
+		Short('c').
+		StringVar(&cfg.Context)
+
+	app.Flag("timezone", "Timezone for bucket alignment and timestamps (IANA name, Local or UTC)").
+		Default("UTC").
+		StringVar(&cfg.Timezone)
+
+	app.Flag("progress", "Show progress during message fetching").
+		Default("true").
+		BoolVar(&cfg.ShowProgress)
+
+	app.Flag("config", "YAML config file with flag values for every run and named profiles").
+		Envar(configEnvar).
+		ExistingFileVar(&cfg.ConfigFile)
+
+	app.Flag("profile", "Profile of the config file to apply, flags given on the command line override it").
+		Envar(profileEnvar).
+		StringVar(&cfg.Profile)
+
+	// Every command also has a config subcommand with the same flags that prints its effective configuration
+	configCmd := app.Command(cmdConfig, "Print the effective configuration of a command, from the config file, profile and flags")
+	cmds := make(map[string]*fisk.CmdClause)
+	for _, c := range commands {
+		cmd := app.Command(c.name, c.help)
+		if c.name == cmdAnalyze {
+			cmd.Default()
+		}
+		show := configCmd.Command(c.name, fmt.Sprintf("Print the effective configuration of %s", c.name))
+		for _, g := range c.groups {
+			g.add(cmd, &cfg)
+			g.add(show, &cfg)
+		}
+		cmds[cmd.FullCommand()] = cmd
+		cmds[show.FullCommand()] = show
+	}
+
+	args := legacyArgs(os.Args[1:])
+	configFile, profile := findConfigArgs(args)
+	if configFile != "" {
+		file, err := LoadConfigFile(configFile)
+		if err != nil {
+			fisk.Fatalf("%v", err)
+		}
+		settings, err := file.Settings(profile)
+		if err != nil {
+			fisk.Fatalf("%s: %v", configFile, err)
+		}
+		if err := applySettings(app, slices.Collect(maps.Values(cmds)), settings); err != nil {
+			fisk.Fatalf("%s: %v", configFile, err)
+		}
+	} else if profile != "" {
+		fisk.Fatalf("--profile needs a config file (--config or $%s)", configEnvar)
+	}
+
+	cfg.Command = app.MustParseWithUsage(args)
+	if name, ok := strings.CutPrefix(cfg.Command, cmdConfig+" "); ok {
+		if err := PrintEffectiveConfig(app, cmds[cfg.Command], name, configFile, profile); err != nil {
+			fisk.Fatalf("%v", err)
+		}
+		os.Exit(0)
+	}
+	cfg.GUI = cfg.Command == cmdServe
+
+	for _, c := range commands {
+		if c.name != cfg.Command {
+			continue
+		}
+		for _, g := range c.groups {
+			if g.validate != nil {
+				g.validate(&cfg)
+			}
+		}
+	}
+
+	if cfg.Command == cmdCompare && !cfg.Comparing() {
+		fisk.Fatalf("compare needs a baseline: --compare-shift, --compare-start or --compare-snapshot")
+	}
+
+	if cfg.JSZ && (cfg.Comparing() || cfg.AdvisoryStream != "" || cfg.RulesFile != "" || cfg.Publish.Stream != "" || cfg.Publish.KV != "") {
+		fisk.Fatalf("--jsz cannot be used with comparisons, --advisories, --rules or publishing")
+	}
+
+	if len(cfg.Backups) > 0 && (cfg.JSZ || cfg.AdvisoryStream != "" || cfg.Publish.Stream != "" || cfg.Publish.KV != "") {
+		fisk.Fatalf("--backup cannot be used with --jsz, --advisories or publishing")
+	}
+
+	return cfg
+}
+
+// legacyArgs maps the deprecated --gui, --gui-port and --csv flags of the analysis, from
+// before the commands, to the serve and export commands, warning about it. A false --gui
+// or --no-gui is dropped.
+func legacyArgs(args []string) []string {
+	var gui, csv bool
+	var mapped, port []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch {
+		case name == "--gui" && hasValue:
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				fisk.Fatalf("invalid value %q for --gui", value)
+			}
+			gui = v
+		case name == "--gui":
+			gui = true
+		case name == "--no-gui":
+			gui = false
+		case name == "--gui-port" && hasValue:
+			port = []string{"--port=" + value}
+		case name == "--gui-port" && i+1 < len(args):
+			port = []string{"--port", args[i+1]}
+			i++
+		default:
+			csv = csv || name == "--csv"
+			mapped = append(mapped, args[i])
+		}
+	}
+
+	var command string
+	switch {
+	case gui && csv:
+		fisk.Fatalf("--gui and --csv are now the serve and export commands, run them separately")
+	case gui:
+		command = cmdServe
+		mapped = append(mapped, port...)
+	case csv:
+		command = cmdExport
+	default:
+		// Without --gui the port did nothing
+		return mapped
+	}
+
+	// Only the analysis, the default command, had these flags
+	i := slices.IndexFunc(mapped, func(arg string) bool {
+		return slices.Contains([]string{cmdAnalyze, cmdServe, cmdExport, cmdCompare, cmdSnapshot, cmdConfig}, arg)
+	})
+	switch {
+	case i < 0:
+		mapped = append([]string{command}, mapped...)
+	case mapped[i] == cmdAnalyze:
+		mapped[i] = command
+	default:
+		return args
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: --gui, --gui-port and --csv are deprecated, use the %s command: js-traffic-history %s\n", command, strings.Join(mapped, " "))
+	return mapped
+}
+
+// addStreamFlags adds the flags selecting the streams and where they are read from
+func addStreamFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("stream", "Analyze specific stream(s) (can be repeated)").
+		Short('s').
+		StringsVar(&cfg.StreamNames)
+
+	cmd.Flag("backup", "Read a stream from a `nats stream backup` directory, its stream.tar.s2 or a file store directory instead of a server, can be repeated").
+		ExistingFilesOrDirsVar(&cfg.Backups)
+}
+
+// addFetchFlags adds the flags controlling how messages are fetched
+func addFetchFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("batch-size", "Messages per batch request").
+		Default("10000").
+		IntVar(&cfg.BatchSize)
+
+	cmd.Flag("parallel", "Sequence range chunks fetched concurrently per stream").
+		Default("4").
+		IntVar(&cfg.Parallel)
+
+	cmd.Flag("max-inflight", "Max concurrent batch requests across all fetches (0 = no limit)").
+		Default("8").
+		IntVar(&cfg.MaxInFlight)
+
+	cmd.Flag("max-msg-rate", "Max messages per second to fetch (0 = unlimited)").
+		Default("0").
+		Float64Var(&cfg.MaxMsgRate)
+
+	cmd.Flag("max-byte-rate", "Max bytes per second to fetch, e.g. 10MB (0 = unlimited)").
+		Default("0").
+		StringVar(&cfg.MaxByteRate)
+
+	cmd.Flag("adaptive-batch", "Reduce the batch size when batch requests get slow or fail").
+		Default("true").
+		BoolVar(&cfg.AdaptiveBatch)
+
+	cmd.Flag("target-latency", "Batch request latency above which the adaptive batch size backs off").
+		Default("2s").
+		DurationVar(&cfg.TargetLatency)
+
+	cmd.Flag("min-batch-size", "Smallest batch size the adaptive batch sizing will use").
+		Default("100").
+		IntVar(&cfg.MinBatchSize)
+
+	cmd.Flag("retries", "Retries for a failed batch request before giving up on the rest of the range").
+		Default("3").
+		IntVar(&cfg.Retries)
+
+	cmd.Flag("retry-backoff", "Initial backoff between retries (doubles on each retry)").
+		Default("500ms").
+		DurationVar(&cfg.RetryBackoff)
+
+	cmd.Flag("limit", "Max messages to analyze per stream (0 = all)").
+		Short('l').
+		Default("0").
+		IntVar(&cfg.Limit)
+
+	cmd.Flag("start-seq", "First sequence to fetch as [STREAM:]SEQ, or [STREAM:]FIRST-LAST for a range (repeatable)").
+		PlaceHolder("[STREAM:]SEQ").
+		StringsVar(&cfg.StartSeqs)
+
+	cmd.Flag("end-seq", "Last sequence to fetch as [STREAM:]SEQ (repeatable)").
+		PlaceHolder("[STREAM:]SEQ").
+		StringsVar(&cfg.EndSeqs)
+
+	cmd.Flag("last", "Only fetch the last N messages within the sequence and time range, as [STREAM:]N (repeatable)").
+		PlaceHolder("[STREAM:]N").
+		StringsVar(&cfg.LastMsgs)
+}
+
+func validateFetchFlags(cfg *Config) {
+	if cfg.BatchSize <= 0 {
+		fisk.Fatalf("--batch-size must be positive")
+	}
+
+	if cfg.Parallel <= 0 {
+		fisk.Fatalf("--parallel must be positive")
+	}
+
+	if cfg.MaxInFlight < 0 {
+		fisk.Fatalf("--max-inflight cannot be negative")
+	}
+
+	if cfg.MaxMsgRate < 0 {
+		fisk.Fatalf("--max-msg-rate cannot be negative")
+	}
+
+	if _, err := humanize.ParseBytes(cfg.MaxByteRate); err != nil {
+		fisk.Fatalf("invalid --max-byte-rate %q: %v", cfg.MaxByteRate, err)
+	}
+
+	if cfg.MinBatchSize <= 0 {
+		fisk.Fatalf("--min-batch-size must be positive")
+	}
+
+	if cfg.Retries < 0 {
+		fisk.Fatalf("--retries cannot be negative")
+	}
+
+	if cfg.Limit > 0 && len(cfg.LastMsgs) > 0 {
+		fisk.Fatalf("--limit cannot be combined with --last")
+	}
+
+	selections, err := ParseStreamSelections(cfg.StartSeqs, cfg.EndSeqs, cfg.LastMsgs)
+	if err != nil {
+		fisk.Fatalf("%v", err)
+	}
+	cfg.Selections = selections
+}
+
+// addWindowFlags adds the flags selecting the time window to analyze
+func addWindowFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("start", "Start time (e.g., 2026-10-01 09:00, now-2h, yesterday, last monday 09:00, epoch seconds or millis, optionally followed by a timezone name)").
+		StringVar(&cfg.StartTime)
+
+	cmd.Flag("end", "End time, in the same forms as --start").
+		StringVar(&cfg.EndTime)
+
+	cmd.Flag("since", "Relative start time before the newest message (e.g., 1h, 30m, 2h30m)").
+		DurationVar(&cfg.Since)
+
+	cmd.Flag("window", "Time window as START,DURATION or START..END (e.g., \"yesterday 09:00,8h\" or 2026-10-01..2026-10-07)").
+		StringVar(&cfg.Window)
+}
+
+func validateWindowFlags(cfg *Config) {
+	if cfg.Since > 0 && cfg.StartTime != "" {
+		fisk.Fatalf("cannot use both --since and --start")
+	}
+	if cfg.Window != "" && (cfg.StartTime != "" || cfg.EndTime != "" || cfg.Since > 0) {
+		fisk.Fatalf("--window cannot be combined with --start, --end or --since")
+	}
+}
+
+// addBucketFlags adds the flags shaping the rate histogram
+func addBucketFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("granularity", "Time bucket size for rate calculation, a duration or day, week or month").
+		Default("1s").
+		IsSetByUser(&cfg.GranularitySet).
+		StringVar(&cfg.RateGranularity)
+
+	cmd.Flag("purge-min-gap", "Contiguous deleted messages from which a gap is classified as a purge (0 = never)").
+		Default("1000").
+		IntVar(&cfg.PurgeMinGap)
+
+	cmd.Flag("purge-gaps", "How purge gaps count in the per sequence number rate (interpolate, exclude)").
+		Default(string(PurgeGapsInterpolate)).
+		EnumVar(&cfg.PurgeGaps, string(PurgeGapsInterpolate), string(PurgeGapsExclude))
+
+	cmd.Flag("interpolation", "How deleted messages are spread between stored messages (even, proportional, midpoint, exp-decay, none)").
+		Default(string(InterpolateEven)).
+		EnumVar(&cfg.Interpolation, interpolationStrategyNames()...)
+}
+
+func validateBucketFlags(cfg *Config) {
+	layout, err := ParseBucketLayout(cfg.RateGranularity, cfg.Timezone)
+	if err != nil {
+		fisk.Fatalf("%v", err)
+	}
+	cfg.BucketLayout = layout
+
+	if cfg.PurgeMinGap < 0 {
+		fisk.Fatalf("--purge-min-gap cannot be negative")
+	}
+}
+
+// addReportFlags adds the flags selecting what the printed report shows
+func addReportFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("graph", "Display ASCII graph").
+		Short('g').
+		BoolVar(&cfg.ShowGraph)
+
+	cmd.Flag("rate", "Show message rate graph and stats").
+		Default("true").
+		BoolVar(&cfg.ShowRate)
+
+	cmd.Flag("throughput", "Show throughput graph and stats").
+		Default("true").
+		BoolVar(&cfg.ShowThroughput)
+
+	cmd.Flag("per-stream", "Also show stats and graphs for each individual stream").
+		Default("true").
+		BoolVar(&cfg.PerStream)
+
+	cmd.Flag("min-rate-pct", "Skip graph buckets below this percentage of max rate").
+		Default("10").
+		Float64Var(&cfg.MinRatePct)
+
+	cmd.Flag("distribution", "Show message distribution over streams").
+		Default("true").
+		BoolVar(&cfg.Distribution)
+
+	cmd.Flag("seasonality", "Show hour-of-day and day-of-week rate profiles").
+		BoolVar(&cfg.Seasonality)
+
+	cmd.Flag("bursts", "Show bursts and max sustained rates").
+		BoolVar(&cfg.Bursts)
+
+	cmd.Flag("burst-threshold", "Rate above which buckets are part of a burst, in msgs/s or a percentile of non-empty buckets (e.g. p99)").
+		Default("p95").
+		StringVar(&cfg.BurstThreshold)
+
+	cmd.Flag("sustained-windows", "Comma separated windows for the max sustained rate").
+		Default("10s,1m,5m").
+		StringVar(&cfg.SustainedWin)
+
+	cmd.Flag("top", "Number of bursts, busiest windows and idle gaps to list").
+		Default("5").
+		IntVar(&cfg.TopN)
+
+	cmd.Flag("anomalies", "Show spikes, drops to zero and level shifts against a rolling baseline").
+		BoolVar(&cfg.Anomalies)
+
+	cmd.Flag("idle-gaps", "Show periods without stored messages in each stream").
+		BoolVar(&cfg.IdleGaps)
+
+	cmd.Flag("idle-gap-min", "Minimum idle gap to report (0 = derive from the stream's inter-arrival times)").
+		Default("0s").
+		DurationVar(&cfg.IdleGapOptions.MinGap)
+
+	cmd.Flag("idle-gap-factor", "With --idle-gap-min 0, report gaps longer than this many times the p99 inter-arrival time").
+		Default("10").
+		Float64Var(&cfg.IdleGapOptions.Factor)
+
+	cmd.Flag("inter-arrival", "Show inter-arrival time distribution, burstiness and same-timestamp batching per stream").
+		BoolVar(&cfg.InterArrival)
+
+	cmd.Flag("sizes", "Show the message size distribution and size classes").
+		BoolVar(&cfg.Sizes)
+
+	cmd.Flag("correlation", "Show the cross-correlation of stream rates and clusters of streams moving together").
+		BoolVar(&cfg.Correlation)
+
+	cmd.Flag("rules", "Check the statistics against a YAML or JSON rules file and exit with status 2 on violations").
+		StringVar(&cfg.RulesFile)
+}
+
+func validateReportFlags(cfg *Config) {
+	threshold, err := ParseBurstThreshold(cfg.BurstThreshold)
+	if err != nil {
+		fisk.Fatalf("%v", err)
+	}
+	windows, err := ParseSustainedWindows(cfg.SustainedWin)
+	if err != nil {
+		fisk.Fatalf("%v", err)
+	}
+	if cfg.TopN <= 0 {
+		fisk.Fatalf("--top must be positive")
+	}
+	cfg.BurstOptions = BurstOptions{Threshold: threshold, Windows: windows, TopN: cfg.TopN}
+
+	if cfg.IdleGapOptions.MinGap < 0 {
+		fisk.Fatalf("--idle-gap-min cannot be negative")
+	}
+
+	if cfg.IdleGapOptions.Factor <= 0 {
+		fisk.Fatalf("--idle-gap-factor must be positive")
+	}
+	cfg.IdleGapOptions.TopN = cfg.TopN
+}
+
+// addAnalysisFlags adds the settings of the anomaly detection, forecast and correlation, used
+// by the report and the GUI
+func addAnalysisFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("anomaly-window", "Buckets in the rolling baseline for anomaly detection").
+		Default("60").
+		IntVar(&cfg.AnomalyOptions.Window)
+
+	cmd.Flag("anomaly-threshold", "Deviation from the rolling median, in median absolute deviations, to flag an anomaly").
+		Default("5").
+		Float64Var(&cfg.AnomalyOptions.Threshold)
+
+	cmd.Flag("forecast", "Show a Holt-Winters forecast of the rate and throughput").
+		BoolVar(&cfg.Forecast)
+
+	cmd.Flag("forecast-horizon", "How far ahead to forecast").
+		Default("1h").
+		DurationVar(&cfg.ForecastOptions.Horizon)
+
+	cmd.Flag("forecast-season", "Length of the seasonal cycle of the forecast (0 = no season)").
+		Default("24h").
+		DurationVar(&cfg.ForecastOptions.Season)
+
+	cmd.Flag("correlation-max-lag", "Buckets to shift streams against each other when looking for lagged correlation").
+		Default("10").
+		IntVar(&cfg.CorrelationOpts.MaxLag)
+
+	cmd.Flag("correlation-threshold", "Mean correlation needed to group streams into a cluster").
+		Default("0.7").
+		Float64Var(&cfg.CorrelationOpts.Threshold)
+}
+
+func validateAnalysisFlags(cfg *Config) {
+	if cfg.AnomalyOptions.Window < 2 {
+		fisk.Fatalf("--anomaly-window must be at least 2")
+	}
+
+	if cfg.AnomalyOptions.Threshold <= 0 {
+		fisk.Fatalf("--anomaly-threshold must be positive")
+	}
+
+	if cfg.ForecastOptions.Horizon <= 0 {
+		fisk.Fatalf("--forecast-horizon must be positive")
+	}
+
+	if cfg.ForecastOptions.Season < 0 {
+		fisk.Fatalf("--forecast-season cannot be negative")
+	}
+
+	if cfg.CorrelationOpts.MaxLag < 0 {
+		fisk.Fatalf("--correlation-max-lag cannot be negative")
+	}
+
+	if cfg.CorrelationOpts.Threshold < -1 || cfg.CorrelationOpts.Threshold > 1 {
+		fisk.Fatalf("--correlation-threshold must be between -1 and 1")
+	}
+}
+
+// addAdvisoryFlags adds the flag reading advisories along the analysis
+func addAdvisoryFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("advisories", "Read JetStream advisories and metrics captured in this stream and show them along the publish rate timeline").
+		StringVar(&cfg.AdvisoryStream)
+}
+
+// addJSZFlags adds the flags of JSZ sampling as data source
+func addJSZFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("jsz", "Sample the JetStream details of all servers over time instead of reading messages, needs system account credentials").
+		BoolVar(&cfg.JSZ)
+
+	cmd.Flag("jsz-context", "NATS context with system account credentials for --jsz (default: --context)").
+		StringVar(&cfg.JSZOptions.Context)
+
+	cmd.Flag("jsz-account", "Only sample the streams of this account with --jsz").
+		StringVar(&cfg.JSZOptions.Account)
+
+	cmd.Flag("jsz-interval", "Time between --jsz sampling rounds, also the bucket length").
+		Default("10s").
+		DurationVar(&cfg.JSZOptions.Interval)
+
+	cmd.Flag("jsz-duration", "How long to sample with --jsz").
+		Default("5m").
+		DurationVar(&cfg.JSZOptions.Duration)
+}
+
+func validateJSZFlags(cfg *Config) {
+	if cfg.JSZ && cfg.GranularitySet {
+		fisk.Fatalf("--granularity cannot be used with --jsz, its buckets are the --jsz-interval")
+	}
+
+	if cfg.JSZOptions.Interval <= 0 || cfg.JSZOptions.Duration < cfg.JSZOptions.Interval {
+		fisk.Fatalf("--jsz-interval must be positive and no longer than --jsz-duration")
+	}
+
+	if cfg.JSZOptions.Context == "" {
+		cfg.JSZOptions.Context = cfg.Context
+	}
+}
+
+// addCompareFlags adds the flags selecting the baseline of a comparison
+func addCompareFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("compare-shift", "Compare with the same window this much earlier, e.g. 168h for week over week").
+		DurationVar(&cfg.CompareShift)
+
+	cmd.Flag("compare-start", "Start of the baseline window to compare with (RFC3339 or 2006-01-02 15:04:05)").
+		StringVar(&cfg.CompareStart)
+
+	cmd.Flag("compare-end", "End of the baseline window (default: as long as the current window)").
+		StringVar(&cfg.CompareEnd)
+
+	cmd.Flag("compare-snapshot", "Compare with a saved snapshot as baseline, given twice compares the two snapshots offline").
+		StringsVar(&cfg.CompareSnaps)
+}
+
+// addCompareOutputFlags adds the flags selecting what the printed comparison shows
+func addCompareOutputFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("per-stream", "Also compare each individual stream").
+		Default("true").
+		BoolVar(&cfg.PerStream)
+}
+
+func validateCompareFlags(cfg *Config) {
+	if cfg.CompareShift < 0 {
+		fisk.Fatalf("--compare-shift cannot be negative")
+	}
+
+	baselines := 0
+	for _, set := range []bool{cfg.CompareShift > 0, cfg.CompareStart != "", len(cfg.CompareSnaps) > 0} {
+		if set {
+			baselines++
+		}
+	}
+	if baselines > 1 {
+		fisk.Fatalf("use only one of --compare-shift, --compare-start and --compare-snapshot")
+	}
+
+	if cfg.CompareEnd != "" && cfg.CompareStart == "" {
+		fisk.Fatalf("--compare-end requires --compare-start")
+	}
+
+	if len(cfg.CompareSnaps) > 2 {
+		fisk.Fatalf("--compare-snapshot can be given at most twice")
+	}
+}
+
+// addGUIFlags adds the flags of the web server
+func addGUIFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("port", "Port for web-based GUI server").
+		Default("8080").
+		IntVar(&cfg.GUIPort)
+
+	cmd.Flag("browser", "Auto-open browser when GUI starts").
+		Default("true").
+		BoolVar(&cfg.GUIBrowser)
+}
+
+// addExportFlags adds the destinations of an export
+func addExportFlags(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Flag("csv", "Export the per-stream histogram data to this CSV file").
+		StringVar(&cfg.CSVFile)
+
+	cmd.Flag("publish-stream", "Publish the summary, per-stream statistics and bucket series into this JetStream stream, created if missing").
+		StringVar(&cfg.Publish.Stream)
+
+	cmd.Flag("publish-kv", "Put the summary, per-stream statistics and bucket series into this KV bucket, created if missing").
+		StringVar(&cfg.Publish.KV)
+
+	cmd.Flag("publish-prefix", "Subject prefix for published records: <prefix>.summary and <prefix>.stream.<name>").
+		Default("jth").
+		StringVar(&cfg.Publish.Prefix)
+
+	cmd.Flag("publish-max-buckets", "Average published bucket series down to at most this many buckets").
+		Default("500").
+		IntVar(&cfg.Publish.MaxBuckets)
+}
+
+func validateExportFlags(cfg *Config) {
+	if cfg.CSVFile == "" && cfg.Publish.Stream == "" && cfg.Publish.KV == "" {
+		fisk.Fatalf("export needs --csv, --publish-stream or --publish-kv")
+	}
+
+	if cfg.Publish.Prefix == "" || strings.ContainsAny(cfg.Publish.Prefix, "*> ") {
+		fisk.Fatalf("--publish-prefix must be a subject without wildcards")
+	}
+
+	if cfg.Publish.MaxBuckets < 1 {
+		fisk.Fatalf("--publish-max-buckets must be positive")
+	}
+
+	// Add .csv extension if missing
+	if cfg.CSVFile != "" && !strings.HasSuffix(strings.ToLower(cfg.CSVFile), ".csv") {
+		cfg.CSVFile += ".csv"
+	}
+}
+
+// addSnapshotFileArgs adds the snapshot file to save to
+func addSnapshotFileArgs(cmd *fisk.CmdClause, cfg *Config) {
+	cmd.Arg("file", "Snapshot file to write").
+		Required().
+		StringVar(&cfg.SaveSnapshot)
+}
+
+func validateSnapshotFileArgs(cfg *Config) {
+	// The bucket layout is restored from the timezone name, which has to mean the same
+	// wherever the snapshot is compared
+	if cfg.BucketLayout.location() == time.Local {
+		fisk.Fatalf("snapshots cannot use --timezone Local, use an IANA name such as Europe/Amsterdam or UTC")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLegacyArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-s", "ORDERS"}, []string{"-s", "ORDERS"}},
+		{[]string{"--gui", "-s", "ORDERS"}, []string{"serve", "-s", "ORDERS"}},
+		{[]string{"--gui=true"}, []string{"serve"}},
+		{[]string{"--gui=1", "--gui-port", "8080"}, []string{"serve", "--port", "8080"}},
+		{[]string{"--gui-port=8080", "--gui"}, []string{"serve", "--port=8080"}},
+		{[]string{"analyze", "--gui", "-s", "ORDERS"}, []string{"serve", "-s", "ORDERS"}},
+		{[]string{"--gui=false", "-s", "ORDERS"}, []string{"-s", "ORDERS"}},
+		{[]string{"--gui=0", "--gui-port", "8080"}, nil},
+		{[]string{"--no-gui", "-s", "ORDERS"}, []string{"-s", "ORDERS"}},
+		{[]string{"--gui", "--no-gui"}, nil},
+		{[]string{"--no-gui", "--gui"}, []string{"serve"}},
+		{[]string{"--gui-port", "8080", "-s", "ORDERS"}, []string{"-s", "ORDERS"}},
+		{[]string{"--csv", "out.csv"}, []string{"export", "--csv", "out.csv"}},
+		{[]string{"analyze", "--csv=out.csv"}, []string{"export", "--csv=out.csv"}},
+		{[]string{"--gui=false", "--csv", "out.csv"}, []string{"export", "--csv", "out.csv"}},
+		{[]string{"compare", "--gui"}, []string{"compare", "--gui"}},
+	}
+
+	for _, tt := range tests {
+		if got := legacyArgs(tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("legacyArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
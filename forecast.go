@@ -0,0 +1,250 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// maxForecastHistory is the most steps of history the model is fitted to, longer
+	// histories are resampled into coarser steps
+	maxForecastHistory = 2000
+	// maxForecastSteps is the most steps forecast over the horizon
+	maxForecastSteps = 48
+	// forecastDamping damps the trend, so long horizons level off instead of running away
+	forecastDamping = 0.98
+	// forecastZ is the normal quantile of the 95% prediction interval
+	forecastZ = 1.96
+)
+
+// Candidate smoothing parameters, the combination with the smallest one-step error is used
+var (
+	forecastAlphas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+	forecastBetas  = []float64{0, 0.01, 0.05, 0.1, 0.2}
+	forecastGammas = []float64{0, 0.05, 0.1, 0.2, 0.4}
+)
+
+// ForecastOptions controls the traffic forecast
+type ForecastOptions struct {
+	Horizon time.Duration // how far ahead to forecast, 0 disables forecasting
+	Season  time.Duration // length of the seasonal cycle, 0 for none
+}
+
+// ForecastPoint is the forecast over one step, with its 95% prediction interval
+type ForecastPoint struct {
+	Start          time.Time
+	End            time.Time
+	Rate           float64
+	RateLow        float64
+	RateHigh       float64
+	Throughput     float64
+	ThroughputLow  float64
+	ThroughputHigh float64
+}
+
+// HoltWintersFit is a fitted model of one series
+type HoltWintersFit struct {
+	Alpha float64 // level smoothing
+	Beta  float64 // trend smoothing
+	Gamma float64 // seasonal smoothing, 0 without a season
+	RMSE  float64 // root mean squared one-step error over the history
+}
+
+// Forecast projects the stored rate and throughput of a histogram
+type Forecast struct {
+	Step          time.Duration // length of a forecast step, nominal for calendar layouts
+	Season        int           // steps per seasonal cycle, 0 without a season
+	History       int           // steps the models were fitted to
+	RateFit       HoltWintersFit
+	ThroughputFit HoltWintersFit
+	Points        []ForecastPoint
+}
+
+// BuildForecast fits additive Holt-Winters models with a damped trend to the stored rate and
+// throughput of a histogram and forecasts them over the horizon. The buckets are resampled
+// into steps coarse enough to keep the model small, and the season is only used when the
+// history covers at least two cycles. Returns nil without enough history.
+func BuildForecast(hist *RateHistogram, opts ForecastOptions) *Forecast {
+	if hist == nil || opts.Horizon <= 0 || len(hist.Buckets) == 0 {
+		return nil
+	}
+
+	bucket := hist.Layout.Nominal()
+	n := len(hist.Buckets)
+	k := max(1, ceilDiv(n, maxForecastHistory), ceilDiv(int(opts.Horizon/bucket), maxForecastSteps))
+
+	// A season needs a whole number of steps per cycle and two cycles of history
+	season := 0
+	if opts.Season > 0 && opts.Season%bucket == 0 {
+		seasonBuckets := int(opts.Season / bucket)
+		for steps := k; steps <= seasonBuckets/2; steps++ {
+			if seasonBuckets%steps == 0 {
+				k = steps
+				season = seasonBuckets / steps
+				break
+			}
+		}
+		if n/k < 2*season {
+			season = 0
+		}
+	}
+
+	starts, rates, throughputs := resampleBuckets(hist.Buckets, k)
+	if len(rates) < 4 {
+		return nil
+	}
+
+	f := &Forecast{
+		Step:    time.Duration(k) * bucket,
+		Season:  season,
+		History: len(rates),
+	}
+	horizon := max(1, int(opts.Horizon/f.Step))
+
+	var rateFc, rateWidth, tputFc, tputWidth []float64
+	f.RateFit, rateFc, rateWidth = fitHoltWinters(rates, season, horizon)
+	f.ThroughputFit, tputFc, tputWidth = fitHoltWinters(throughputs, season, horizon)
+
+	last := starts[len(starts)-1]
+	for h := 1; h <= horizon; h++ {
+		start := last.Add(time.Duration(h) * f.Step)
+		f.Points = append(f.Points, ForecastPoint{
+			Start:          start,
+			End:            start.Add(f.Step),
+			Rate:           max(rateFc[h-1], 0),
+			RateLow:        max(rateFc[h-1]-rateWidth[h-1], 0),
+			RateHigh:       max(rateFc[h-1]+rateWidth[h-1], 0),
+			Throughput:     max(tputFc[h-1], 0),
+			ThroughputLow:  max(tputFc[h-1]-tputWidth[h-1], 0),
+			ThroughputHigh: max(tputFc[h-1]+tputWidth[h-1], 0),
+		})
+	}
+
+	return f
+}
+
+// resampleBuckets sums every k buckets into one step and returns the step starts with their
+// stored rate and throughput. Steps are grouped from the end so the latest step is complete.
+func resampleBuckets(buckets []RateBucket, k int) ([]time.Time, []float64, []float64) {
+	var starts []time.Time
+	var rates, throughputs []float64
+	for i := len(buckets) % k; i+k <= len(buckets); i += k {
+		var count int
+		var bytes int64
+		for _, b := range buckets[i : i+k] {
+			count += b.Count
+			bytes += b.Bytes
+		}
+		seconds := buckets[i+k-1].End.Sub(buckets[i].Start).Seconds()
+		starts = append(starts, buckets[i].Start)
+		rates = append(rates, float64(count)/seconds)
+		throughputs = append(throughputs, float64(bytes)/seconds)
+	}
+	return starts, rates, throughputs
+}
+
+// fitHoltWinters picks the smoothing parameters with the smallest one-step error and returns
+// the fit with the forecast and the half width of its prediction interval for each step
+func fitHoltWinters(y []float64, season int, horizon int) (HoltWintersFit, []float64, []float64) {
+	gammas := forecastGammas
+	if season == 0 {
+		gammas = []float64{0}
+	}
+
+	best := HoltWintersFit{RMSE: math.Inf(1)}
+	for _, alpha := range forecastAlphas {
+		for _, beta := range forecastBetas {
+			for _, gamma := range gammas {
+				fit := HoltWintersFit{Alpha: alpha, Beta: beta, Gamma: gamma}
+				fit.RMSE, _ = runHoltWinters(y, season, fit, 0)
+				if fit.RMSE < best.RMSE {
+					best = fit
+				}
+			}
+		}
+	}
+
+	_, forecast := runHoltWinters(y, season, best, horizon)
+
+	// The variance of the h-step error grows with the smoothing weights of the steps in between
+	widths := make([]float64, horizon)
+	sum := 0.0
+	damped := 0.0
+	for h := 1; h <= horizon; h++ {
+		widths[h-1] = forecastZ * best.RMSE * math.Sqrt(1+sum)
+		damped += math.Pow(forecastDamping, float64(h))
+		c := best.Alpha * (1 + best.Beta*damped)
+		if season > 0 && h%season == 0 {
+			c += best.Gamma
+		}
+		sum += c * c
+	}
+
+	return best, forecast, widths
+}
+
+// runHoltWinters runs the model over the series and returns the root mean squared one-step
+// error and the forecast for the next horizon steps
+func runHoltWinters(y []float64, season int, fit HoltWintersFit, horizon int) (float64, []float64) {
+	seasonal := make([]float64, max(season, 1))
+	var level, trend float64
+	first := 1
+	if season > 0 {
+		// Initialize from the first two cycles: their means give the level and trend and
+		// the first cycle's deviations from its mean the seasonal components
+		mean1, mean2 := mean(y[:season]), mean(y[season:2*season])
+		level = mean1
+		trend = (mean2 - mean1) / float64(season)
+		for i := range season {
+			seasonal[i] = y[i] - mean1
+		}
+		first = season
+	} else {
+		level = y[0]
+		trend = y[1] - y[0]
+	}
+
+	sse := 0.0
+	for t := first; t < len(y); t++ {
+		s := 0.0
+		if season > 0 {
+			s = seasonal[t%season]
+		}
+		err := y[t] - (level + forecastDamping*trend + s)
+		sse += err * err
+
+		newLevel := fit.Alpha*(y[t]-s) + (1-fit.Alpha)*(level+forecastDamping*trend)
+		trend = fit.Beta*(newLevel-level) + (1-fit.Beta)*forecastDamping*trend
+		if season > 0 {
+			seasonal[t%season] = fit.Gamma*(y[t]-newLevel) + (1-fit.Gamma)*s
+		}
+		level = newLevel
+	}
+	rmse := math.Sqrt(sse / float64(len(y)-first))
+
+	forecast := make([]float64, horizon)
+	damped := 0.0
+	for h := 1; h <= horizon; h++ {
+		damped += math.Pow(forecastDamping, float64(h))
+		forecast[h-1] = level + damped*trend
+		if season > 0 {
+			forecast[h-1] += seasonal[(len(y)-1+h)%season]
+		}
+	}
+
+	return rmse, forecast
+}
+
+// mean returns the mean of values
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// ceilDiv returns a / b rounded up
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
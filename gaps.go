@@ -0,0 +1,206 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// GapCause is the likely reason for sequences missing between two stored messages of a stream
+type GapCause string
+
+const (
+	// GapPurge is a long run of contiguous deleted sequences, as left behind by a purge
+	GapPurge GapCause = "purge"
+	// GapRollover is a gap that older messages removed by the per-subject limit can explain
+	GapRollover GapCause = "rollover"
+	// GapSparse is a short gap left by individually deleted messages
+	GapSparse GapCause = "sparse"
+)
+
+// gapCauses lists the gap causes in display order
+var gapCauses = []GapCause{GapPurge, GapRollover, GapSparse}
+
+// PurgeGapMode controls how purge gaps are counted in the sequence based rate
+type PurgeGapMode string
+
+const (
+	// PurgeGapsInterpolate spreads purged messages over the gap like any other deletes
+	PurgeGapsInterpolate PurgeGapMode = "interpolate"
+	// PurgeGapsExclude leaves purged messages out of the sequence based rate
+	PurgeGapsExclude PurgeGapMode = "exclude"
+)
+
+// GapStreamState is the stream state used to classify the gaps of a stream
+type GapStreamState struct {
+	NumDeleted        int
+	MaxMsgsPerSubject int64
+	SubjectCounts     map[string]uint64 // nil if unknown
+}
+
+// GapOptions controls how deleted-message gaps are classified and interpolated
+type GapOptions struct {
+	PurgeMinGap int // contiguous deleted sequences from which a gap counts as a purge (0 = never)
+	PurgeMode   PurgeGapMode
+	Streams     map[string]GapStreamState // keyed by stream name
+}
+
+// NewGapOptions builds gap options from the stream metadata
+func NewGapOptions(streams []StreamInfo, purgeMinGap int, purgeMode PurgeGapMode) GapOptions {
+	opts := GapOptions{
+		PurgeMinGap: purgeMinGap,
+		PurgeMode:   purgeMode,
+		Streams:     make(map[string]GapStreamState, len(streams)),
+	}
+	for _, si := range streams {
+		opts.Streams[si.Name] = GapStreamState{
+			NumDeleted:        si.NumDeleted,
+			MaxMsgsPerSubject: si.MaxMsgsPerSubject,
+			SubjectCounts:     si.SubjectCounts,
+		}
+	}
+	return opts
+}
+
+// DeleteGap is a run of deleted sequences between two consecutive stored messages of a stream
+type DeleteGap struct {
+	StreamName string
+	PrevSeq    uint64 // sequence of the stored message before the gap
+	PrevTime   time.Time
+	NextTime   time.Time
+	Count      int // deleted sequences in the gap
+	Cause      GapCause
+}
+
+// GapVolume counts gaps and the messages deleted in them
+type GapVolume struct {
+	Gaps     int
+	Messages int
+}
+
+// GapBreakdown holds the deleted message volume of a stream per gap cause
+type GapBreakdown struct {
+	StreamName   string
+	StateDeleted int // deleted messages in the whole stream according to its state
+	ByCause      map[GapCause]GapVolume
+}
+
+// Total returns the deleted messages found in gaps across all causes
+func (b GapBreakdown) Total() int {
+	total := 0
+	for _, v := range b.ByCause {
+		total += v.Messages
+	}
+	return total
+}
+
+// findDeleteGaps finds and classifies the gaps between consecutive stored messages of each stream
+// Messages are expected to be sorted by timestamp
+func findDeleteGaps(messages []MessageData, opts GapOptions) []DeleteGap {
+	horizons := rolloverHorizons(messages, opts.Streams)
+
+	// Track the last seen message per stream, since sequence numbers are per-stream
+	// and messages from multiple streams may be interleaved
+	var gaps []DeleteGap
+	lastMsgPerStream := make(map[string]*MessageData)
+
+	for i := range messages {
+		msg := &messages[i]
+		prevMsg, hasPrev := lastMsgPerStream[msg.StreamName]
+		lastMsgPerStream[msg.StreamName] = msg
+
+		if !hasPrev || msg.Sequence <= prevMsg.Sequence+1 {
+			continue
+		}
+
+		gap := DeleteGap{
+			StreamName: msg.StreamName,
+			PrevSeq:    prevMsg.Sequence,
+			PrevTime:   prevMsg.Timestamp,
+			NextTime:   msg.Timestamp,
+			Count:      int(msg.Sequence - prevMsg.Sequence - 1),
+		}
+
+		switch {
+		case opts.PurgeMinGap > 0 && gap.Count >= opts.PurgeMinGap:
+			gap.Cause = GapPurge
+		case prevMsg.Sequence < horizons[msg.StreamName]:
+			gap.Cause = GapRollover
+		default:
+			gap.Cause = GapSparse
+		}
+		gaps = append(gaps, gap)
+	}
+
+	return gaps
+}
+
+// rolloverHorizons returns per stream the sequence below which deleted messages can be
+// explained by its per-subject limit. A message only rolls over once its subject holds the
+// maximum number of messages and is then older than every stored message of that subject,
+// so the horizon is the highest first stored sequence among the subjects at the limit.
+// With a time filter the first stored sequence is taken from the fetched messages, which
+// can move the horizon later than it really is.
+func rolloverHorizons(messages []MessageData, streams map[string]GapStreamState) map[string]uint64 {
+	type subjectKey struct {
+		stream  string
+		subject string
+	}
+	firstSeq := make(map[subjectKey]uint64)
+	fetched := make(map[subjectKey]uint64)
+
+	for _, msg := range messages {
+		if streams[msg.StreamName].MaxMsgsPerSubject <= 0 {
+			continue
+		}
+		key := subjectKey{stream: msg.StreamName, subject: msg.Subject}
+		if seq, ok := firstSeq[key]; !ok || msg.Sequence < seq {
+			firstSeq[key] = msg.Sequence
+		}
+		fetched[key]++
+	}
+
+	horizons := make(map[string]uint64)
+	for key, seq := range firstSeq {
+		state := streams[key.stream]
+		// Prefer the stored count from the stream state, the fetched messages may be a subset
+		count := fetched[key]
+		if state.SubjectCounts != nil {
+			count = state.SubjectCounts[key.subject]
+		}
+		if count >= uint64(state.MaxMsgsPerSubject) && seq > horizons[key.stream] {
+			horizons[key.stream] = seq
+		}
+	}
+
+	return horizons
+}
+
+// breakdownGaps sums the gap volume per stream and cause, sorted by stream name
+func breakdownGaps(gaps []DeleteGap, streams map[string]GapStreamState) []GapBreakdown {
+	byStream := make(map[string]*GapBreakdown)
+	for _, gap := range gaps {
+		b, ok := byStream[gap.StreamName]
+		if !ok {
+			b = &GapBreakdown{
+				StreamName:   gap.StreamName,
+				StateDeleted: streams[gap.StreamName].NumDeleted,
+				ByCause:      make(map[GapCause]GapVolume),
+			}
+			byStream[gap.StreamName] = b
+		}
+		v := b.ByCause[gap.Cause]
+		v.Gaps++
+		v.Messages += gap.Count
+		b.ByCause[gap.Cause] = v
+	}
+
+	breakdown := make([]GapBreakdown, 0, len(byStream))
+	for _, b := range byStream {
+		breakdown = append(breakdown, *b)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		return breakdown[i].StreamName < breakdown[j].StreamName
+	})
+
+	return breakdown
+}
@@ -5,18 +5,19 @@ go 1.25.1
 require (
 	github.com/choria-io/fisk v0.7.2
 	github.com/dustin/go-humanize v1.0.1
+	github.com/klauspost/compress v1.18.3
 	github.com/nats-io/nats.go v1.48.0
 	github.com/synadia-io/orbit.go/jetstreamext v0.2.0
 	github.com/synadia-io/orbit.go/natscontext v0.1.1
+	golang.org/x/term v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/klauspost/compress v1.18.3 // indirect
 	github.com/nats-io/nkeys v0.4.12 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
 	github.com/synadia-io/orbit.go/natsext v0.1.1 // indirect
 	golang.org/x/crypto v0.47.0 // indirect
 	golang.org/x/net v0.49.0 // indirect
 	golang.org/x/sys v0.40.0 // indirect
-	golang.org/x/term v0.39.0 // indirect
 )
@@ -4,11 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"math"
 	"net/http"
 	"os/exec"
 	"runtime"
 	"sort"
-	"strconv"
+	"sync"
 	"time"
 
 	"js-traffic-history/web"
@@ -19,21 +20,71 @@ type GUIServer struct {
 	port        int
 	openBrowser bool
 	combined    *RateHistogram
-	histograms  map[string]*RateHistogram
 	summary     *ReportSummary
+	anomalyOpts AnomalyOptions
+	comparison  *Comparison     // nil unless comparing with a baseline
+	forecast    ForecastOptions // horizon 0 unless forecasting
+	correlation CorrelationOptions
+	advisories  []AdvisoryEvent // nil unless reading an advisory stream
+
+	mu           sync.Mutex
+	interpolated map[InterpolationStrategy]*RateHistogram // combined histogram per interpolation strategy
+	perStream    map[streamStrategy]*RateHistogram        // stream histogram per interpolation strategy
+}
+
+// streamStrategy keys the cached histogram of a stream interpolated with a strategy
+type streamStrategy struct {
+	stream   string
+	strategy InterpolationStrategy
 }
 
 // JSONSummary is the JSON representation of ReportSummary
 type JSONSummary struct {
-	StartTime   time.Time           `json:"start_time"`
-	EndTime     time.Time           `json:"end_time"`
-	DurationNs  int64               `json:"duration_ns"`
-	StreamCount int                 `json:"stream_count"`
-	TotalMsgs   int                 `json:"total_msgs"`
-	TotalBytes  int64               `json:"total_bytes"`
-	TotalSeqs   uint64              `json:"total_seqs"`
-	SeqRate     float64             `json:"seq_rate"`
-	Streams     []JSONStreamSummary `json:"streams"`
+	StartTime     time.Time           `json:"start_time"`
+	EndTime       time.Time           `json:"end_time"`
+	DurationNs    int64               `json:"duration_ns"`
+	WindowStart   *time.Time          `json:"window_start,omitempty"` // requested time window, unset when open
+	WindowEnd     *time.Time          `json:"window_end,omitempty"`
+	StreamCount   int                 `json:"stream_count"`
+	TotalMsgs     int                 `json:"total_msgs"`
+	TotalBytes    int64               `json:"total_bytes"`
+	TotalSeqs     uint64              `json:"total_seqs"`
+	SeqRate       float64             `json:"seq_rate"`
+	Streams       []JSONStreamSummary `json:"streams"`
+	Fetch         []JSONFetchStatus   `json:"fetch,omitempty"`
+	Deletes       []JSONGapBreakdown  `json:"deletes,omitempty"`
+	PurgeGaps     string              `json:"purge_gaps,omitempty"`
+	Interpolation string              `json:"interpolation,omitempty"`
+	Granularity   string              `json:"granularity"`
+	Timezone      string              `json:"timezone,omitempty"` // IANA name, empty for the browser's local time
+}
+
+// JSONGapBreakdown is the JSON representation of GapBreakdown
+type JSONGapBreakdown struct {
+	Stream       string                   `json:"stream"`
+	StateDeleted int                      `json:"state_deleted"`
+	ByCause      map[string]JSONGapVolume `json:"by_cause"`
+}
+
+// JSONGapVolume is the JSON representation of GapVolume
+type JSONGapVolume struct {
+	Gaps     int `json:"gaps"`
+	Messages int `json:"messages"`
+}
+
+// JSONFetchStatus is the JSON representation of FetchCompleteness
+type JSONFetchStatus struct {
+	Stream    string         `json:"stream"`
+	Complete  bool           `json:"complete"`
+	FirstSeq  uint64         `json:"first_seq"`
+	LastSeq   uint64         `json:"last_seq"`
+	Fetched   int            `json:"fetched"`
+	Deleted   uint64         `json:"deleted"`
+	Missing   uint64         `json:"missing"`
+	ErrorGaps [][2]uint64    `json:"error_gaps,omitempty"`
+	Retries   int            `json:"retries"`
+	Errors    map[string]int `json:"errors,omitempty"`
+	Fatal     string         `json:"fatal,omitempty"`
 }
 
 // JSONStreamSummary is the JSON representation of StreamSummary
@@ -67,6 +118,21 @@ type JSONBucket struct {
 	MaxMsgSize int                              `json:"max_msg_size"`
 	SumMsgSize int64                            `json:"sum_msg_size"`
 	PerStream  map[string]*JSONStreamBucketData `json:"per_stream,omitempty"`
+	// Messages and bytes per size class, in the order of the histogram's size_classes
+	SizeClassMsgs  []int   `json:"size_class_msgs,omitempty"`
+	SizeClassBytes []int64 `json:"size_class_bytes,omitempty"`
+	// Baseline rate and throughput over the bucket, only when comparing with a baseline
+	BaselineRate       *float64 `json:"baseline_rate,omitempty"`
+	BaselineThroughput *float64 `json:"baseline_throughput,omitempty"`
+}
+
+// JSONSizeBin is the JSON representation of a SizeHistogram bin
+type JSONSizeBin struct {
+	Label    string `json:"label"`
+	MinSize  int    `json:"min_size"`
+	MaxSize  int    `json:"max_size"` // first size beyond the bin
+	Messages int    `json:"messages"`
+	Bytes    int64  `json:"bytes"`
 }
 
 // JSONStats is the JSON representation of RateStatistics
@@ -118,19 +184,285 @@ type JSONStats struct {
 // JSONHistogram is the JSON representation of RateHistogram
 type JSONHistogram struct {
 	Buckets       []JSONBucket `json:"buckets"`
-	GranularityNs int64        `json:"granularity_ns"`
+	GranularityNs int64        `json:"granularity_ns"` // average bucket length
+	Timezone      string       `json:"timezone,omitempty"`
 	Stats         JSONStats    `json:"stats"`
+	Interpolation string       `json:"interpolation,omitempty"`
+	// Sizes is the log2 message size histogram of all the buckets
+	Sizes       []JSONSizeBin `json:"sizes"`
+	SizeClasses []string      `json:"size_classes"`
+}
+
+// JSONProfileSlot is the JSON representation of ProfileSlot
+type JSONProfileSlot struct {
+	Label    string  `json:"label"`
+	Buckets  int     `json:"buckets"`
+	MeanRate float64 `json:"mean_rate"`
+	P50Rate  float64 `json:"p50_rate"`
+	P99Rate  float64 `json:"p99_rate"`
+}
+
+// JSONAnomaly is the JSON representation of Anomaly
+type JSONAnomaly struct {
+	Kind     string    `json:"kind"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Buckets  int       `json:"buckets"`
+	Rate     float64   `json:"rate"`
+	Baseline float64   `json:"baseline"`
+	Score    float64   `json:"score"`
+}
+
+// JSONAnomalies is the JSON representation of the anomalies of a histogram
+type JSONAnomalies struct {
+	Window    int           `json:"window"`
+	Threshold float64       `json:"threshold"`
+	Anomalies []JSONAnomaly `json:"anomalies"`
+}
+
+// JSONInterArrivalBin is the JSON representation of InterArrivalBin
+type JSONInterArrivalBin struct {
+	Label   string `json:"label"`
+	LowerNs int64  `json:"lower_ns"`
+	UpperNs int64  `json:"upper_ns"` // 0 for the open-ended last bin
+	Count   int    `json:"count"`
+}
+
+// JSONInterArrival is the JSON representation of InterArrivalStats
+type JSONInterArrival struct {
+	Stream         string                `json:"stream"`
+	Intervals      int                   `json:"intervals"`
+	MeanNs         int64                 `json:"mean_ns"`
+	StdDevNs       int64                 `json:"stddev_ns"`
+	MinNs          int64                 `json:"min_ns"`
+	MaxNs          int64                 `json:"max_ns"`
+	P50Ns          int64                 `json:"p50_ns"`
+	P90Ns          int64                 `json:"p90_ns"`
+	P99Ns          int64                 `json:"p99_ns"`
+	P999Ns         int64                 `json:"p999_ns"`
+	CV             float64               `json:"cv"`
+	Burstiness     float64               `json:"burstiness"`
+	Batches        int                   `json:"batches"`
+	BatchedMsgs    int                   `json:"batched_msgs"`
+	MaxBatch       int                   `json:"max_batch"`
+	SameTimestamps int                   `json:"same_timestamps"`
+	Histogram      []JSONInterArrivalBin `json:"histogram"`
+}
+
+// JSONSeasonality is the JSON representation of SeasonalityProfile
+type JSONSeasonality struct {
+	HourOfDay      []JSONProfileSlot `json:"hour_of_day"`
+	DayOfWeek      []JSONProfileSlot `json:"day_of_week"`
+	Heatmap        [][]float64       `json:"heatmap"`
+	HeatmapBuckets [][]int           `json:"heatmap_buckets"`
+	Days           []string          `json:"days"`
+}
+
+// JSONForecastPoint is the JSON representation of ForecastPoint
+type JSONForecastPoint struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Rate           float64   `json:"rate"`
+	RateLow        float64   `json:"rate_low"`
+	RateHigh       float64   `json:"rate_high"`
+	Throughput     float64   `json:"throughput"`
+	ThroughputLow  float64   `json:"throughput_low"`
+	ThroughputHigh float64   `json:"throughput_high"`
+}
+
+// JSONForecast is the JSON representation of Forecast
+type JSONForecast struct {
+	StepNs         int64               `json:"step_ns"`
+	Season         int                 `json:"season"`
+	History        int                 `json:"history"`
+	RateRMSE       float64             `json:"rate_rmse"`
+	ThroughputRMSE float64             `json:"throughput_rmse"`
+	Points         []JSONForecastPoint `json:"points"`
+}
+
+// JSONStreamPairCorrelation is the JSON representation of StreamPairCorrelation
+type JSONStreamPairCorrelation struct {
+	A              string  `json:"a"`
+	B              string  `json:"b"`
+	Correlation    float64 `json:"correlation"`
+	LagNs          int64   `json:"lag_ns"`
+	LagCorrelation float64 `json:"lag_correlation"`
+}
+
+// JSONStreamCluster is the JSON representation of StreamCluster
+type JSONStreamCluster struct {
+	Streams         []string `json:"streams"`
+	MeanCorrelation float64  `json:"mean_correlation"`
+}
+
+// JSONCorrelation is the JSON representation of CorrelationAnalysis, undefined
+// correlations in the matrix are null
+type JSONCorrelation struct {
+	StepNs    int64                       `json:"step_ns"`
+	MaxLagNs  int64                       `json:"max_lag_ns"`
+	Threshold float64                     `json:"threshold"`
+	Streams   []string                    `json:"streams"`
+	Omitted   int                         `json:"omitted"`
+	Matrix    [][]*float64                `json:"matrix"`
+	Pairs     []JSONStreamPairCorrelation `json:"pairs"`
+	Clusters  []JSONStreamCluster         `json:"clusters"`
+}
+
+// maxAdvisoryAnnotations is the most advisories sent to annotate the rate chart, the
+// earliest are kept
+const maxAdvisoryAnnotations = 5000
+
+// JSONAdvisoryEvent is the JSON representation of AdvisoryEvent, without ack latencies
+type JSONAdvisoryEvent struct {
+	Kind     string    `json:"kind"`
+	Time     time.Time `json:"time"`
+	Stream   string    `json:"stream,omitempty"`
+	Consumer string    `json:"consumer,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// JSONAdvisoryCount is the JSON representation of AdvisoryCount
+type JSONAdvisoryCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// JSONLatencyStats is the JSON representation of LatencyStats
+type JSONLatencyStats struct {
+	Count int   `json:"count"`
+	AvgNs int64 `json:"avg_ns"`
+	P50Ns int64 `json:"p50_ns"`
+	P90Ns int64 `json:"p90_ns"`
+	P99Ns int64 `json:"p99_ns"`
+	MaxNs int64 `json:"max_ns"`
+}
+
+// JSONAdvisories is the JSON representation of an AdvisoryAnalysis, with the advisories
+// other than acks to annotate the rate chart
+type JSONAdvisories struct {
+	Totals        map[string]int      `json:"totals"`
+	AckLatency    JSONLatencyStats    `json:"ack_latency"`
+	AckBins       []JSONAdvisoryCount `json:"ack_bins"`
+	TopErrors     []JSONAdvisoryCount `json:"top_errors"`
+	TopMaxDeliver []JSONAdvisoryCount `json:"top_max_deliver"`
+	Events        []JSONAdvisoryEvent `json:"events"`
+	Omitted       int                 `json:"omitted"` // events beyond maxAdvisoryAnnotations
+}
+
+// JSONStatDelta is the JSON representation of StatDelta
+type JSONStatDelta struct {
+	Name     string   `json:"name"`
+	Unit     string   `json:"unit"`
+	Baseline float64  `json:"baseline"`
+	Current  float64  `json:"current"`
+	Delta    float64  `json:"delta"`
+	Change   *float64 `json:"change"` // relative, null without a baseline
+}
+
+// JSONStreamDelta is the JSON representation of StreamDelta
+type JSONStreamDelta struct {
+	Name         string  `json:"name"`
+	BaseMessages int     `json:"base_messages"`
+	CurMessages  int     `json:"cur_messages"`
+	BaseBytes    int64   `json:"base_bytes"`
+	CurBytes     int64   `json:"cur_bytes"`
+	BaseShare    float64 `json:"base_share"`
+	CurShare     float64 `json:"cur_share"`
+}
+
+// JSONComparisonSide is the JSON representation of ComparisonSide
+type JSONComparisonSide struct {
+	Label       string    `json:"label"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Messages    int       `json:"messages"`
+}
+
+// JSONComparison is the JSON representation of Comparison
+type JSONComparison struct {
+	Baseline JSONComparisonSide `json:"baseline"`
+	Current  JSONComparisonSide `json:"current"`
+	ShiftNs  int64              `json:"shift_ns"`
+	Stats    []JSONStatDelta    `json:"stats"`
+	Streams  []JSONStreamDelta  `json:"streams"`
+}
+
+// GUIOptions holds the analysis the GUI server shows and how it is started
+type GUIOptions struct {
+	Port        int
+	OpenBrowser bool
+	Combined    *RateHistogram // with the per-stream breakdown
+	Summary     *ReportSummary
+	Anomalies   AnomalyOptions
+	Comparison  *Comparison     // nil unless comparing with a baseline
+	Forecast    ForecastOptions // horizon 0 unless forecasting
+	Correlation CorrelationOptions
+	Advisories  []AdvisoryEvent // nil unless reading an advisory stream
 }
 
 // NewGUIServer creates a new GUI server
-func NewGUIServer(port int, autoBrowser bool, combined *RateHistogram, histograms map[string]*RateHistogram, summary *ReportSummary) *GUIServer {
+func NewGUIServer(opts GUIOptions) *GUIServer {
 	return &GUIServer{
-		port:        port,
-		openBrowser: autoBrowser,
-		combined:    combined,
-		histograms:  histograms,
-		summary:     summary,
+		port:        opts.Port,
+		openBrowser: opts.OpenBrowser,
+		combined:    opts.Combined,
+		summary:     opts.Summary,
+		anomalyOpts: opts.Anomalies,
+		comparison:  opts.Comparison,
+		forecast:    opts.Forecast,
+		correlation: opts.Correlation,
+		advisories:  opts.Advisories,
+	}
+}
+
+// convertAdvisories converts an AdvisoryAnalysis to JSONAdvisories, with the events it was
+// built from other than acks
+func convertAdvisories(a *AdvisoryAnalysis, events []AdvisoryEvent) JSONAdvisories {
+	counts := func(counts []AdvisoryCount) []JSONAdvisoryCount {
+		result := make([]JSONAdvisoryCount, len(counts))
+		for i, c := range counts {
+			result[i] = JSONAdvisoryCount{Key: c.Key, Count: c.Count}
+		}
+		return result
+	}
+
+	result := JSONAdvisories{
+		Totals: make(map[string]int, len(a.Totals)),
+		AckLatency: JSONLatencyStats{
+			Count: a.AckLatency.Count,
+			AvgNs: int64(a.AckLatency.Avg),
+			P50Ns: int64(a.AckLatency.P50),
+			P90Ns: int64(a.AckLatency.P90),
+			P99Ns: int64(a.AckLatency.P99),
+			MaxNs: int64(a.AckLatency.Max),
+		},
+		TopErrors:     counts(a.TopErrors),
+		TopMaxDeliver: counts(a.TopMaxDeliver),
+		Events:        []JSONAdvisoryEvent{},
 	}
+	for kind, n := range a.Totals {
+		result.Totals[string(kind)] = n
+	}
+	for i, n := range a.AckBins {
+		result.AckBins = append(result.AckBins, JSONAdvisoryCount{Key: ackLatencyBins[i].Label, Count: n})
+	}
+	for _, e := range events {
+		if e.Kind == AdvisoryAck {
+			continue
+		}
+		if len(result.Events) == maxAdvisoryAnnotations {
+			result.Omitted++
+			continue
+		}
+		result.Events = append(result.Events, JSONAdvisoryEvent{
+			Kind:     string(e.Kind),
+			Time:     e.Time,
+			Stream:   e.Stream,
+			Consumer: e.Consumer,
+			Detail:   e.Detail,
+		})
+	}
+	return result
 }
 
 // convertSummary converts ReportSummary to JSONSummary
@@ -151,17 +483,75 @@ func convertSummary(s *ReportSummary) JSONSummary {
 		}
 	}
 
+	var fetch []JSONFetchStatus
+	for _, fc := range s.Fetch {
+		status := JSONFetchStatus{
+			Stream:   fc.StreamName,
+			Complete: fc.Complete(),
+			FirstSeq: fc.FirstSeq,
+			LastSeq:  fc.LastSeq,
+			Fetched:  fc.Fetched,
+			Deleted:  fc.Deleted,
+			Missing:  fc.Missing,
+			Retries:  fc.Retries,
+			Fatal:    fc.Fatal,
+		}
+		for _, gap := range fc.ErrorGaps {
+			status.ErrorGaps = append(status.ErrorGaps, [2]uint64{gap.First, gap.Last})
+		}
+		if len(fc.Errors) > 0 {
+			status.Errors = make(map[string]int, len(fc.Errors))
+			for class, n := range fc.Errors {
+				status.Errors[string(class)] = n
+			}
+		}
+		fetch = append(fetch, status)
+	}
+
 	return JSONSummary{
-		StartTime:   s.StartTime,
-		EndTime:     s.EndTime,
-		DurationNs:  s.Duration.Nanoseconds(),
-		StreamCount: s.StreamCount,
-		TotalMsgs:   s.TotalMsgs,
-		TotalBytes:  s.TotalBytes,
-		TotalSeqs:   s.TotalSeqs,
-		SeqRate:     s.SeqRate,
-		Streams:     streams,
+		StartTime:     s.StartTime,
+		EndTime:       s.EndTime,
+		DurationNs:    s.Duration.Nanoseconds(),
+		WindowStart:   s.WindowStart,
+		WindowEnd:     s.WindowEnd,
+		StreamCount:   s.StreamCount,
+		TotalMsgs:     s.TotalMsgs,
+		TotalBytes:    s.TotalBytes,
+		TotalSeqs:     s.TotalSeqs,
+		SeqRate:       s.SeqRate,
+		Streams:       streams,
+		Fetch:         fetch,
+		Deletes:       convertGapBreakdowns(s.Deletes),
+		PurgeGaps:     string(s.PurgeGaps),
+		Interpolation: string(s.Interpolation),
+		Granularity:   s.Layout.String(),
+		Timezone:      timezoneName(s.Layout.location()),
+	}
+}
+
+// convertGapBreakdowns converts GapBreakdowns to their JSON representation
+func convertGapBreakdowns(breakdowns []GapBreakdown) []JSONGapBreakdown {
+	var deletes []JSONGapBreakdown
+	for _, b := range breakdowns {
+		jb := JSONGapBreakdown{
+			Stream:       b.StreamName,
+			StateDeleted: b.StateDeleted,
+			ByCause:      make(map[string]JSONGapVolume, len(b.ByCause)),
+		}
+		for cause, v := range b.ByCause {
+			jb.ByCause[string(cause)] = JSONGapVolume{Gaps: v.Gaps, Messages: v.Messages}
+		}
+		deletes = append(deletes, jb)
+	}
+	return deletes
+}
+
+// timezoneName returns the IANA name of loc for the browser, empty for the local timezone
+func timezoneName(loc *time.Location) string {
+	if loc == time.Local {
+		return ""
 	}
+	return loc.String()
 }
 
 // convertHistogram converts RateHistogram to JSONHistogram
@@ -185,6 +575,12 @@ func convertHistogram(h *RateHistogram) JSONHistogram {
 			MaxMsgSize: b.MaxMsgSize,
 			SumMsgSize: b.SumMsgSize,
 		}
+		if b.SizeSketch != nil {
+			for _, v := range b.SizeSketch.Log2Histogram().Classes() {
+				buckets[i].SizeClassMsgs = append(buckets[i].SizeClassMsgs, v.Messages)
+				buckets[i].SizeClassBytes = append(buckets[i].SizeClassBytes, v.Bytes)
+			}
+		}
 		// Include per-stream data if available
 		if len(b.PerStream) > 0 {
 			buckets[i].PerStream = make(map[string]*JSONStreamBucketData, len(b.PerStream))
@@ -198,55 +594,271 @@ func convertHistogram(h *RateHistogram) JSONHistogram {
 		}
 	}
 
-	stats := JSONStats{
-		TotalMessages:    h.Stats.TotalMessages,
-		TotalBytes:       h.Stats.TotalBytes,
-		StartTime:        h.Stats.StartTime,
-		EndTime:          h.Stats.EndTime,
-		TotalDurationNs:  h.Stats.TotalDuration.Nanoseconds(),
-		AvgRate:          h.Stats.AvgRate,
-		P50Rate:          h.Stats.P50Rate,
-		P90Rate:          h.Stats.P90Rate,
-		P99Rate:          h.Stats.P99Rate,
-		P999Rate:         h.Stats.P999Rate,
-		MinRate:          h.Stats.MinRate,
-		MaxRate:          h.Stats.MaxRate,
-		StdDevRate:       h.Stats.StdDevRate,
-		AvgSeqRate:       h.Stats.AvgSeqRate,
-		P50SeqRate:       h.Stats.P50SeqRate,
-		P90SeqRate:       h.Stats.P90SeqRate,
-		P99SeqRate:       h.Stats.P99SeqRate,
-		P999SeqRate:      h.Stats.P999SeqRate,
-		MinSeqRate:       h.Stats.MinSeqRate,
-		MaxSeqRate:       h.Stats.MaxSeqRate,
-		StdDevSeqRate:    h.Stats.StdDevSeqRate,
-		AvgThroughput:    h.Stats.AvgThroughput,
-		P50Throughput:    h.Stats.P50Throughput,
-		P90Throughput:    h.Stats.P90Throughput,
-		P99Throughput:    h.Stats.P99Throughput,
-		P999Throughput:   h.Stats.P999Throughput,
-		MinThroughput:    h.Stats.MinThroughput,
-		MaxThroughput:    h.Stats.MaxThroughput,
-		StdDevThroughput: h.Stats.StdDevTput,
-		AvgMsgSize:       h.Stats.AvgMsgSize,
-		P50MsgSize:       h.Stats.P50MsgSize,
-		P90MsgSize:       h.Stats.P90MsgSize,
-		P99MsgSize:       h.Stats.P99MsgSize,
-		P999MsgSize:      h.Stats.P999MsgSize,
-		MinMsgSize:       h.Stats.MinMsgSize,
-		MaxMsgSize:       h.Stats.MaxMsgSize,
-		StdDevMsgSize:    h.Stats.StdDevMsgSize,
-		FirstSeq:         h.Stats.FirstSeq,
-		LastSeq:          h.Stats.LastSeq,
-		SeqRate:          h.Stats.SeqRate,
-		ActiveBuckets:    h.Stats.ActiveBuckets,
-		TotalBuckets:     h.Stats.TotalBuckets,
+	stats := convertStats(h.Stats)
+
+	sizes := mergeBucketSketches(h.Buckets).Log2Histogram()
+	sizeBins := make([]JSONSizeBin, 0, len(sizes.Counts))
+	for bin, count := range sizes.Counts {
+		lower, upper := sizeBinBounds(bin)
+		sizeBins = append(sizeBins, JSONSizeBin{
+			Label:    sizeBinLabel(bin),
+			MinSize:  lower,
+			MaxSize:  upper,
+			Messages: count,
+			Bytes:    sizes.Bytes[bin],
+		})
+	}
+	classLabels := make([]string, len(sizeClasses))
+	for i, class := range sizeClasses {
+		classLabels[i] = class.Label
 	}
 
 	return JSONHistogram{
 		Buckets:       buckets,
-		GranularityNs: h.Granularity.Nanoseconds(),
+		GranularityNs: bucketLength(h).Nanoseconds(),
+		Timezone:      timezoneName(h.Layout.location()),
 		Stats:         stats,
+		Interpolation: string(h.Interpolation),
+		Sizes:         sizeBins,
+		SizeClasses:   classLabels,
+	}
+}
+
+// convertStats converts RateStatistics to JSONStats
+func convertStats(s RateStatistics) JSONStats {
+	return JSONStats{
+		TotalMessages:    s.TotalMessages,
+		TotalBytes:       s.TotalBytes,
+		StartTime:        s.StartTime,
+		EndTime:          s.EndTime,
+		TotalDurationNs:  s.TotalDuration.Nanoseconds(),
+		AvgRate:          s.AvgRate,
+		P50Rate:          s.P50Rate,
+		P90Rate:          s.P90Rate,
+		P99Rate:          s.P99Rate,
+		P999Rate:         s.P999Rate,
+		MinRate:          s.MinRate,
+		MaxRate:          s.MaxRate,
+		StdDevRate:       s.StdDevRate,
+		AvgSeqRate:       s.AvgSeqRate,
+		P50SeqRate:       s.P50SeqRate,
+		P90SeqRate:       s.P90SeqRate,
+		P99SeqRate:       s.P99SeqRate,
+		P999SeqRate:      s.P999SeqRate,
+		MinSeqRate:       s.MinSeqRate,
+		MaxSeqRate:       s.MaxSeqRate,
+		StdDevSeqRate:    s.StdDevSeqRate,
+		AvgThroughput:    s.AvgThroughput,
+		P50Throughput:    s.P50Throughput,
+		P90Throughput:    s.P90Throughput,
+		P99Throughput:    s.P99Throughput,
+		P999Throughput:   s.P999Throughput,
+		MinThroughput:    s.MinThroughput,
+		MaxThroughput:    s.MaxThroughput,
+		StdDevThroughput: s.StdDevTput,
+		AvgMsgSize:       s.AvgMsgSize,
+		P50MsgSize:       s.P50MsgSize,
+		P90MsgSize:       s.P90MsgSize,
+		P99MsgSize:       s.P99MsgSize,
+		P999MsgSize:      s.P999MsgSize,
+		MinMsgSize:       s.MinMsgSize,
+		MaxMsgSize:       s.MaxMsgSize,
+		StdDevMsgSize:    s.StdDevMsgSize,
+		FirstSeq:         s.FirstSeq,
+		LastSeq:          s.LastSeq,
+		SeqRate:          s.SeqRate,
+		ActiveBuckets:    s.ActiveBuckets,
+		TotalBuckets:     s.TotalBuckets,
+	}
+}
+
+// bucketLength returns the average length of the histogram's buckets, calendar buckets, buckets
+// across DST changes and downsampled buckets differ from the nominal granularity
+func bucketLength(h *RateHistogram) time.Duration {
+	if len(h.Buckets) == 0 {
+		return h.Granularity
+	}
+	return h.Buckets[len(h.Buckets)-1].End.Sub(h.Buckets[0].Start) / time.Duration(len(h.Buckets))
+}
+
+// convertForecast converts Forecast to JSONForecast
+func convertForecast(f *Forecast) JSONForecast {
+	points := make([]JSONForecastPoint, len(f.Points))
+	for i, p := range f.Points {
+		points[i] = JSONForecastPoint(p)
+	}
+	return JSONForecast{
+		StepNs:         f.Step.Nanoseconds(),
+		Season:         f.Season,
+		History:        f.History,
+		RateRMSE:       f.RateFit.RMSE,
+		ThroughputRMSE: f.ThroughputFit.RMSE,
+		Points:         points,
+	}
+}
+
+// convertCorrelation converts CorrelationAnalysis to JSONCorrelation
+func convertCorrelation(c *CorrelationAnalysis, opts CorrelationOptions) JSONCorrelation {
+	result := JSONCorrelation{
+		StepNs:    c.Step.Nanoseconds(),
+		MaxLagNs:  c.MaxLag.Nanoseconds(),
+		Threshold: opts.Threshold,
+		Streams:   c.Streams,
+		Omitted:   c.Omitted,
+		Matrix:    make([][]*float64, len(c.Matrix)),
+		Pairs:     make([]JSONStreamPairCorrelation, len(c.Pairs)),
+		Clusters:  make([]JSONStreamCluster, len(c.Clusters)),
+	}
+	for i, row := range c.Matrix {
+		result.Matrix[i] = make([]*float64, len(row))
+		for j, v := range row {
+			if !math.IsNaN(v) {
+				result.Matrix[i][j] = &v
+			}
+		}
+	}
+	for i, p := range c.Pairs {
+		result.Pairs[i] = JSONStreamPairCorrelation{
+			A:              p.A,
+			B:              p.B,
+			Correlation:    p.Correlation,
+			LagNs:          p.Lag.Nanoseconds(),
+			LagCorrelation: p.LagCorrelation,
+		}
+	}
+	for i, cluster := range c.Clusters {
+		result.Clusters[i] = JSONStreamCluster(cluster)
+	}
+	return result
+}
+
+// convertComparison converts a Comparison to JSONComparison, with the given statistic changes
+func convertComparison(c *Comparison, deltas []StatDelta) JSONComparison {
+	side := func(s ComparisonSide) JSONComparisonSide {
+		return JSONComparisonSide{
+			Label:       s.Label,
+			WindowStart: s.WindowStart,
+			WindowEnd:   s.WindowEnd,
+			Messages:    s.Summary.TotalMsgs,
+		}
+	}
+
+	stats := make([]JSONStatDelta, len(deltas))
+	for i, d := range deltas {
+		stats[i] = JSONStatDelta{
+			Name:     d.Name,
+			Unit:     string(d.Unit),
+			Baseline: d.Baseline,
+			Current:  d.Current,
+			Delta:    d.Delta(),
+		}
+		if change, ok := d.Change(); ok {
+			stats[i].Change = &change
+		}
+	}
+
+	streams := make([]JSONStreamDelta, len(c.Streams))
+	for i, d := range c.Streams {
+		streams[i] = JSONStreamDelta{
+			Name:         d.Name,
+			BaseMessages: d.BaseMessages,
+			CurMessages:  d.CurMessages,
+			BaseBytes:    d.BaseBytes,
+			CurBytes:     d.CurBytes,
+			BaseShare:    d.BaseShare,
+			CurShare:     d.CurShare,
+		}
+	}
+
+	return JSONComparison{
+		Baseline: side(c.Baseline),
+		Current:  side(c.Current),
+		ShiftNs:  c.Shift.Nanoseconds(),
+		Stats:    stats,
+		Streams:  streams,
+	}
+}
+
+// convertSeasonality converts SeasonalityProfile to JSONSeasonality
+func convertSeasonality(p *SeasonalityProfile) JSONSeasonality {
+	if p == nil {
+		return JSONSeasonality{}
+	}
+
+	convertSlots := func(slots []ProfileSlot) []JSONProfileSlot {
+		out := make([]JSONProfileSlot, len(slots))
+		for i, slot := range slots {
+			out[i] = JSONProfileSlot{
+				Label:    slot.Label,
+				Buckets:  slot.Buckets,
+				MeanRate: slot.MeanRate,
+				P50Rate:  slot.P50Rate,
+				P99Rate:  slot.P99Rate,
+			}
+		}
+		return out
+	}
+
+	return JSONSeasonality{
+		HourOfDay:      convertSlots(p.HourOfDay),
+		DayOfWeek:      convertSlots(p.DayOfWeek),
+		Heatmap:        p.Heatmap,
+		HeatmapBuckets: p.HeatmapBuckets,
+		Days:           weekdayLabels,
+	}
+}
+
+// convertAnomalies converts anomalies to JSONAnomalies
+func convertAnomalies(anomalies []Anomaly, opts AnomalyOptions) JSONAnomalies {
+	out := JSONAnomalies{
+		Window:    opts.Window,
+		Threshold: opts.Threshold,
+		Anomalies: make([]JSONAnomaly, len(anomalies)),
+	}
+	for i, a := range anomalies {
+		out.Anomalies[i] = JSONAnomaly{
+			Kind:     string(a.Kind),
+			Start:    a.Start,
+			End:      a.End,
+			Buckets:  a.Buckets,
+			Rate:     a.Rate,
+			Baseline: a.Baseline,
+			Score:    a.Score,
+		}
+	}
+	return out
+}
+
+// convertInterArrival converts InterArrivalStats to JSONInterArrival
+func convertInterArrival(s *InterArrivalStats) JSONInterArrival {
+	bins := make([]JSONInterArrivalBin, len(s.Histogram))
+	for i, bin := range s.Histogram {
+		bins[i] = JSONInterArrivalBin{
+			Label:   interArrivalBinLabel(bin),
+			LowerNs: bin.Lower.Nanoseconds(),
+			UpperNs: bin.Upper.Nanoseconds(),
+			Count:   bin.Count,
+		}
+	}
+
+	return JSONInterArrival{
+		Stream:         s.StreamName,
+		Intervals:      s.Intervals,
+		MeanNs:         s.Mean.Nanoseconds(),
+		StdDevNs:       s.StdDev.Nanoseconds(),
+		MinNs:          s.Min.Nanoseconds(),
+		MaxNs:          s.Max.Nanoseconds(),
+		P50Ns:          s.P50.Nanoseconds(),
+		P90Ns:          s.P90.Nanoseconds(),
+		P99Ns:          s.P99.Nanoseconds(),
+		P999Ns:         s.P999.Nanoseconds(),
+		CV:             s.CV,
+		Burstiness:     s.Burstiness,
+		Batches:        s.Batches,
+		BatchedMsgs:    s.BatchedMsgs,
+		MaxBatch:       s.MaxBatch,
+		SameTimestamps: s.SameTimestamps,
+		Histogram:      bins,
 	}
 }
 
@@ -316,6 +928,19 @@ func downsampleHistogram(hist *RateHistogram, maxBuckets int, useAverage bool) *
 			agg.SeqCount += buckets[j].SeqCount
 			agg.Bytes += buckets[j].Bytes
 
+			// Merge message size stats
+			if buckets[j].Count > 0 {
+				if agg.SizeSketch == nil {
+					agg.SizeSketch = &SizeSketch{}
+					agg.MinMsgSize = buckets[j].MinMsgSize
+					agg.MaxMsgSize = buckets[j].MaxMsgSize
+				}
+				agg.MinMsgSize = min(agg.MinMsgSize, buckets[j].MinMsgSize)
+				agg.MaxMsgSize = max(agg.MaxMsgSize, buckets[j].MaxMsgSize)
+				agg.SumMsgSize += buckets[j].SumMsgSize
+				agg.SizeSketch.Merge(buckets[j].SizeSketch)
+			}
+
 			if !useAverage {
 				// Use MAX for rates to preserve peaks in the graph
 				if buckets[j].Rate > agg.Rate {
@@ -341,6 +966,12 @@ func downsampleHistogram(hist *RateHistogram, maxBuckets int, useAverage bool) *
 					agg.PerStream[name].Count += data.Count
 					agg.PerStream[name].SeqCount += data.SeqCount
 					agg.PerStream[name].Bytes += data.Bytes
+					if data.SizeSketch != nil {
+						if agg.PerStream[name].SizeSketch == nil {
+							agg.PerStream[name].SizeSketch = &SizeSketch{}
+						}
+						agg.PerStream[name].SizeSketch.Merge(data.SizeSketch)
+					}
 				}
 			}
 		}
@@ -359,9 +990,11 @@ func downsampleHistogram(hist *RateHistogram, maxBuckets int, useAverage bool) *
 	}
 
 	return &RateHistogram{
-		Buckets:     newBuckets,
-		Granularity: hist.Granularity * time.Duration(factor),
-		Stats:       hist.Stats, // Keep original stats for accurate statistics
+		Buckets:       newBuckets,
+		Granularity:   hist.Granularity * time.Duration(factor),
+		Layout:        hist.Layout, // of the original buckets, merged buckets start at its bounds
+		Stats:         hist.Stats,  // Keep original stats for accurate statistics
+		Interpolation: hist.Interpolation,
 	}
 }
 
@@ -385,9 +1018,11 @@ func filterHistogramByTime(hist *RateHistogram, startTime, endTime *time.Time) *
 
 	if len(filtered) == 0 {
 		return &RateHistogram{
-			Buckets:     filtered,
-			Granularity: hist.Granularity,
-			Stats:       RateStatistics{},
+			Buckets:       filtered,
+			Granularity:   hist.Granularity,
+			Layout:        hist.Layout,
+			Stats:         RateStatistics{},
+			Interpolation: hist.Interpolation,
 		}
 	}
 
@@ -395,22 +1030,73 @@ func filterHistogramByTime(hist *RateHistogram, startTime, endTime *time.Time) *
 	stats := CalculateStatsFromBuckets(filtered)
 
 	return &RateHistogram{
-		Buckets:     filtered,
-		Granularity: hist.Granularity,
-		Stats:       stats,
+		Buckets:       filtered,
+		Granularity:   hist.Granularity,
+		Layout:        hist.Layout,
+		Stats:         stats,
+		Interpolation: hist.Interpolation,
+	}
+}
+
+// combinedFor returns the combined histogram with deletes spread using the given strategy
+// Re-interpolated histograms are cached, as the GUI requests them repeatedly while zooming.
+func (g *GUIServer) combinedFor(strategy InterpolationStrategy) *RateHistogram {
+	if g.combined == nil || strategy == "" || strategy == g.combined.Interpolation {
+		return g.combined
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if hist, ok := g.interpolated[strategy]; ok {
+		return hist
+	}
+	if g.interpolated == nil {
+		g.interpolated = make(map[InterpolationStrategy]*RateHistogram)
+	}
+	hist := g.combined.Reinterpolate(strategy)
+	g.interpolated[strategy] = hist
+	return hist
+}
+
+// streamFor returns the histogram of a stream with deletes spread using the given strategy,
+// or false if the stream is unknown. Like combinedFor it caches the histograms it builds.
+func (g *GUIServer) streamFor(name string, strategy InterpolationStrategy) (*RateHistogram, bool) {
+	combined := g.combinedFor(strategy)
+	if combined == nil {
+		return nil, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := streamStrategy{name, strategy}
+	if hist, ok := g.perStream[key]; ok {
+		return hist, true
 	}
+
+	hist := extractStreamHistogram(combined, name)
+	// Names come from requests, only cache streams that have data
+	if hist.Stats.TotalMessages == 0 {
+		return hist, true
+	}
+
+	if g.perStream == nil {
+		g.perStream = make(map[streamStrategy]*RateHistogram)
+	}
+	g.perStream[key] = hist
+	return hist, true
 }
 
 // extractStreamHistogram creates a histogram for a specific stream from the combined histogram's per-stream data
-func (g *GUIServer) extractStreamHistogram(streamName string) *RateHistogram {
-	if g.combined == nil {
+func extractStreamHistogram(combined *RateHistogram, streamName string) *RateHistogram {
+	if combined == nil {
 		return nil
 	}
 
-	buckets := make([]RateBucket, len(g.combined.Buckets))
-	granularitySecs := g.combined.Granularity.Seconds()
+	buckets := make([]RateBucket, len(combined.Buckets))
 
-	for i, b := range g.combined.Buckets {
+	for i, b := range combined.Buckets {
 		buckets[i] = RateBucket{
 			Start: b.Start,
 			End:   b.End,
@@ -419,22 +1105,53 @@ func (g *GUIServer) extractStreamHistogram(streamName string) *RateHistogram {
 			buckets[i].Count = streamData.Count
 			buckets[i].SeqCount = streamData.SeqCount
 			buckets[i].Bytes = streamData.Bytes
-			buckets[i].Rate = float64(streamData.Count) / granularitySecs
-			buckets[i].SeqRate = float64(streamData.SeqCount) / granularitySecs
-			buckets[i].Throughput = float64(streamData.Bytes) / granularitySecs
+			buckets[i].SizeSketch = streamData.SizeSketch
+			buckets[i].SumMsgSize = streamData.Bytes
+			if streamData.SizeSketch != nil {
+				buckets[i].MinMsgSize = streamData.SizeSketch.Min
+				buckets[i].MaxMsgSize = streamData.SizeSketch.Max
+			}
 		}
 	}
+	computeBucketRates(buckets)
 
 	// Calculate stats from the extracted buckets
 	stats := CalculateStatsFromBuckets(buckets)
 
 	return &RateHistogram{
-		Buckets:     buckets,
-		Granularity: g.combined.Granularity,
-		Stats:       stats,
+		Buckets:       buckets,
+		Granularity:   combined.Granularity,
+		Layout:        combined.Layout,
+		Stats:         stats,
+		Interpolation: combined.Interpolation,
 	}
 }
 
+// timeRange parses the start and end query parameters, nil when not given. Timestamps
+// without a UTC offset are in the report's timezone.
+func (g *GUIServer) timeRange(startParam, endParam string) (start, end *time.Time, err error) {
+	loc := time.UTC
+	if g.summary != nil {
+		loc = g.summary.Layout.location()
+	}
+	now := time.Now()
+	if startParam != "" {
+		t, err := parseTimestampAt(startParam, loc, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		start = &t
+	}
+	if endParam != "" {
+		t, err := parseTimestampAt(endParam, loc, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		end = &t
+	}
+	return start, end, nil
+}
+
 // handleHistogram returns histogram data as JSON
 func (g *GUIServer) handleHistogram(w http.ResponseWriter, r *http.Request) {
 	streamName := r.URL.Query().Get("stream")
@@ -443,41 +1160,31 @@ func (g *GUIServer) handleHistogram(w http.ResponseWriter, r *http.Request) {
 	downsampleParam := r.URL.Query().Get("downsample")
 	useAverageDownsample := downsampleParam == "avg"
 
+	var strategy InterpolationStrategy
+	if param := r.URL.Query().Get("interpolation"); param != "" {
+		var err error
+		if strategy, err = ParseInterpolationStrategy(param); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	var hist *RateHistogram
 	if streamName == "" {
-		hist = g.combined
+		hist = g.combinedFor(strategy)
 	} else {
-		// Try to get from pre-built histograms, or extract from combined
-		if g.histograms != nil {
-			var ok bool
-			hist, ok = g.histograms[streamName]
-			if !ok {
-				http.Error(w, "Stream not found", http.StatusNotFound)
-				return
-			}
-		} else {
-			// Extract from combined histogram's per-stream data
-			hist = g.extractStreamHistogram(streamName)
-			if hist == nil {
-				http.Error(w, "Stream not found", http.StatusNotFound)
-				return
-			}
+		var ok bool
+		if hist, ok = g.streamFor(streamName, strategy); !ok {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
 		}
 	}
 
-	// Parse time range parameters (unix timestamps in seconds)
-	var startTime, endTime *time.Time
-	if startParam != "" {
-		if ts, err := strconv.ParseFloat(startParam, 64); err == nil {
-			t := time.Unix(int64(ts), int64((ts-float64(int64(ts)))*1e9))
-			startTime = &t
-		}
-	}
-	if endParam != "" {
-		if ts, err := strconv.ParseFloat(endParam, 64); err == nil {
-			t := time.Unix(int64(ts), int64((ts-float64(int64(ts)))*1e9))
-			endTime = &t
-		}
+	// Parse time range parameters (unix timestamps in seconds, or time expressions as for --start)
+	startTime, endTime, err := g.timeRange(startParam, endParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Filter by time range if specified
@@ -490,20 +1197,153 @@ func (g *GUIServer) handleHistogram(w http.ResponseWriter, r *http.Request) {
 		hist = downsampleHistogram(hist, maxGUIBuckets, useAverageDownsample)
 	}
 
+	data := convertHistogram(hist)
+	if g.comparison != nil && hist != nil {
+		rates, throughputs := g.comparison.BaselineSeries(streamName, hist.Buckets)
+		for i := range data.Buckets {
+			data.Buckets[i].BaselineRate = &rates[i]
+			data.Buckets[i].BaselineThroughput = &throughputs[i]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// streamHistogram returns the full histogram of a stream, or the combined one if name is empty
+func (g *GUIServer) streamHistogram(name string) *RateHistogram {
+	if name == "" {
+		return g.combined
+	}
+	return extractStreamHistogram(g.combined, name)
+}
+
+// handleCompare returns the changes from the baseline to the current analysis of a stream,
+// or of all streams, as JSON
+func (g *GUIServer) handleCompare(w http.ResponseWriter, r *http.Request) {
+	if g.comparison == nil {
+		http.Error(w, "No comparison", http.StatusNotFound)
+		return
+	}
+
+	c := g.comparison
+	deltas := c.Stats
+	if streamName := r.URL.Query().Get("stream"); streamName != "" {
+		deltas = c.StreamStats(streamName)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertComparison(c, deltas))
+}
+
+// handleForecast returns the forecast of a stream, or of all streams, as JSON
+func (g *GUIServer) handleForecast(w http.ResponseWriter, r *http.Request) {
+	if g.forecast.Horizon <= 0 {
+		http.Error(w, "Forecast not enabled", http.StatusNotFound)
+		return
+	}
+	hist := g.streamHistogram(r.URL.Query().Get("stream"))
+	if hist == nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+	f := BuildForecast(hist, g.forecast)
+	if f == nil {
+		http.Error(w, "Not enough history to forecast", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertForecast(f))
+}
+
+// handleCorrelation returns the cross-correlation of the streams of the combined histogram as JSON
+func (g *GUIServer) handleCorrelation(w http.ResponseWriter, r *http.Request) {
+	c := BuildCorrelation(g.combined, g.correlation)
+	if c == nil {
+		http.Error(w, "Correlation needs at least two streams", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertCorrelation(c, g.correlation))
+}
+
+// handleAdvisories returns the advisories about a stream, or all advisories, as JSON
+func (g *GUIServer) handleAdvisories(w http.ResponseWriter, r *http.Request) {
+	if g.advisories == nil {
+		http.Error(w, "No advisory stream", http.StatusNotFound)
+		return
+	}
+	streamName := r.URL.Query().Get("stream")
+	hist := g.streamHistogram(streamName)
+	if hist == nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+	events := g.advisories
+	if streamName != "" {
+		events = filterAdvisories(events, streamName)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(convertHistogram(hist))
+	json.NewEncoder(w).Encode(convertAdvisories(BuildAdvisoryAnalysis(events, hist), events))
+}
+
+// handleSeasonality returns the hour-of-day and day-of-week profiles as JSON
+func (g *GUIServer) handleSeasonality(w http.ResponseWriter, r *http.Request) {
+	hist := g.streamHistogram(r.URL.Query().Get("stream"))
+	if hist == nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertSeasonality(BuildSeasonality(hist)))
+}
+
+// handleInterArrival returns the inter-arrival time statistics of a stream, or of all streams, as JSON
+func (g *GUIServer) handleInterArrival(w http.ResponseWriter, r *http.Request) {
+	streamName := r.URL.Query().Get("stream")
+
+	var found *InterArrivalStats
+	if g.summary != nil {
+		for _, s := range g.summary.InterArrival {
+			if s.StreamName == streamName {
+				found = s
+				break
+			}
+		}
+		// With a single stream there is no separate entry for all streams
+		if found == nil && streamName == "" && len(g.summary.InterArrival) == 1 {
+			found = g.summary.InterArrival[0]
+		}
+	}
+	if found == nil {
+		http.Error(w, "No inter-arrival data for stream", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertInterArrival(found))
+}
+
+// handleAnomalies returns the anomalies of the full histogram as JSON
+func (g *GUIServer) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	hist := g.streamHistogram(r.URL.Query().Get("stream"))
+	if hist == nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertAnomalies(DetectAnomalies(hist, g.anomalyOpts), g.anomalyOpts))
 }
 
 // handleStreams returns the list of stream names
 func (g *GUIServer) handleStreams(w http.ResponseWriter, r *http.Request) {
 	var streams []string
-	if g.histograms != nil {
-		streams = make([]string, 0, len(g.histograms))
-		for name := range g.histograms {
-			streams = append(streams, name)
-		}
-	} else if g.summary != nil {
-		// Get stream names from summary
+	if g.summary != nil {
 		streams = make([]string, 0, len(g.summary.Streams))
 		for _, s := range g.summary.Streams {
 			streams = append(streams, s.Name)
@@ -520,19 +1360,11 @@ func (g *GUIServer) handleDistribution(w http.ResponseWriter, r *http.Request) {
 	startParam := r.URL.Query().Get("start")
 	endParam := r.URL.Query().Get("end")
 
-	// Parse time range parameters (unix timestamps in seconds)
-	var startTime, endTime *time.Time
-	if startParam != "" {
-		if ts, err := strconv.ParseFloat(startParam, 64); err == nil {
-			t := time.Unix(int64(ts), int64((ts-float64(int64(ts)))*1e9))
-			startTime = &t
-		}
-	}
-	if endParam != "" {
-		if ts, err := strconv.ParseFloat(endParam, 64); err == nil {
-			t := time.Unix(int64(ts), int64((ts-float64(int64(ts)))*1e9))
-			endTime = &t
-		}
+	// Parse time range parameters (unix timestamps in seconds, or time expressions as for --start)
+	startTime, endTime, err := g.timeRange(startParam, endParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// If no time range specified, return the original summary streams
@@ -632,6 +1464,13 @@ func (g *GUIServer) Start() error {
 	mux.HandleFunc("/api/histogram", g.handleHistogram)
 	mux.HandleFunc("/api/streams", g.handleStreams)
 	mux.HandleFunc("/api/distribution", g.handleDistribution)
+	mux.HandleFunc("/api/seasonality", g.handleSeasonality)
+	mux.HandleFunc("/api/anomalies", g.handleAnomalies)
+	mux.HandleFunc("/api/interarrival", g.handleInterArrival)
+	mux.HandleFunc("/api/compare", g.handleCompare)
+	mux.HandleFunc("/api/forecast", g.handleForecast)
+	mux.HandleFunc("/api/correlation", g.handleCorrelation)
+	mux.HandleFunc("/api/advisories", g.handleAdvisories)
 
 	addr := fmt.Sprintf(":%d", g.port)
 	url := fmt.Sprintf("http://localhost:%d", g.port)
@@ -655,7 +1494,7 @@ func (g *GUIServer) Start() error {
 }
 
 // StartGUIServer creates and starts the GUI server
-func StartGUIServer(port int, autoBrowser bool, combined *RateHistogram, histograms map[string]*RateHistogram, summary *ReportSummary) error {
-	server := NewGUIServer(port, autoBrowser, combined, histograms, summary)
+func StartGUIServer(opts GUIOptions) error {
+	server := NewGUIServer(opts)
 	return server.Start()
 }
@@ -9,9 +9,12 @@ import (
 
 // StreamBucketData holds per-stream data within a bucket
 type StreamBucketData struct {
-	Count    int // stored messages
-	SeqCount int // stored + interpolated deletes
-	Bytes    int64
+	Count      int // stored messages
+	SeqCount   int // stored + interpolated deletes
+	Bytes      int64
+	SizeSketch *SizeSketch // nil if no stored messages
+	// InBucketDeletes counts the stream's deletes between its stored messages of this bucket
+	InBucketDeletes int
 }
 
 // RateBucket represents a time bucket with message count and throughput
@@ -27,9 +30,13 @@ type RateBucket struct {
 	// Message size stats for this bucket
 	MinMsgSize int
 	MaxMsgSize int
-	SumMsgSize int64 // sum of message sizes for average calculation
+	SumMsgSize int64       // sum of message sizes for average calculation
+	SizeSketch *SizeSketch // message size sketch for quantiles and log2 bins, nil if no stored messages
 	// Per-stream breakdown (only populated for combined histogram)
 	PerStream map[string]*StreamBucketData
+	// InBucketDeletes counts deletes between stored messages of this bucket, which every
+	// interpolation strategy but none puts here
+	InBucketDeletes int
 }
 
 // RateStatistics contains statistics for rate analysis
@@ -78,11 +85,23 @@ type RateStatistics struct {
 	TotalBuckets   int
 }
 
+// HasSeqRange reports whether the statistics know the sequence range, sampled JetStream
+// details leave it unset
+func (s RateStatistics) HasSeqRange() bool {
+	return s.LastSeq > 0
+}
+
 // RateHistogram represents message rates over time
 type RateHistogram struct {
 	Buckets     []RateBucket
-	Granularity time.Duration
+	Granularity time.Duration // bucket length, nominal for calendar layouts
+	Layout      BucketLayout
 	Stats       RateStatistics
+	Deletes     []GapBreakdown // deleted message volume per stream and gap cause
+	// Gaps holds the gaps spanning several buckets, kept to re-interpolate with another
+	// strategy. Gaps within a bucket are only counted in its InBucketDeletes.
+	Gaps          []DeleteGap
+	Interpolation InterpolationStrategy
 }
 
 // StreamSummary holds summary info for a stream
@@ -100,12 +119,23 @@ type ReportSummary struct {
 	StartTime   time.Time
 	EndTime     time.Time
 	Duration    time.Duration
+	WindowStart *time.Time // requested time window, nil when open
+	WindowEnd   *time.Time
 	StreamCount int
 	TotalMsgs   int
 	TotalBytes  int64
 	TotalSeqs   uint64  // sum of (lastSeq - firstSeq) across all streams
 	SeqRate     float64 // rate based on sequence numbers (msgs recorded/s)
 	Streams     []StreamSummary
+	Layout      BucketLayout        // bucket granularity and timezone of the histograms
+	Fetch       []FetchCompleteness // per-stream fetch completeness
+	Deletes     []GapBreakdown      // deleted message volume per stream and gap cause
+	PurgeGaps   PurgeGapMode        // how purge gaps are counted in the sequence based rate
+	// Interpolation is the strategy used to spread deleted messages in the sequence based rate
+	Interpolation InterpolationStrategy
+	// InterArrival holds the inter-arrival time statistics per stream, preceded by all
+	// streams together when there are several. Only set when requested.
+	InterArrival []*InterArrivalStats
 }
 
 // BuildReportSummary creates a summary from collected messages
@@ -178,14 +208,25 @@ func BuildReportSummary(messages []MessageData, streamCount int) ReportSummary {
 	return summary
 }
 
+// HistogramOptions controls how a rate histogram is built
+type HistogramOptions struct {
+	Layout       BucketLayout
+	ShowProgress bool
+	// TrackPerStream should be true only for combined histograms (where per-stream breakdown is needed)
+	TrackPerStream bool
+	Gaps           GapOptions
+	Interpolation  InterpolationStrategy
+}
+
 // BuildRateHistogram creates a rate histogram from message data
-// trackPerStream should be true only for combined histograms (where per-stream breakdown is needed)
-func BuildRateHistogram(streamName string, messages []MessageData, granularity time.Duration, showProgress bool, trackPerStream bool) *RateHistogram {
+func BuildRateHistogram(streamName string, messages []MessageData, opts HistogramOptions) *RateHistogram {
+	layout := opts.Layout
+	trackPerStream := opts.TrackPerStream
 	if len(messages) == 0 {
-		return &RateHistogram{Granularity: granularity}
+		return &RateHistogram{Granularity: layout.Nominal(), Layout: layout, Interpolation: opts.Interpolation}
 	}
 
-	if showProgress {
+	if opts.ShowProgress {
 		fmt.Printf("Building rate histogram for %s from %d messages...\n", streamName, len(messages))
 	}
 
@@ -195,33 +236,17 @@ func BuildRateHistogram(streamName string, messages []MessageData, granularity t
 	firstSeq := messages[0].Sequence
 	lastSeq := messages[len(messages)-1].Sequence
 
-	// Align to granularity boundaries
-	startTime := minTime.Truncate(granularity)
-	endTime := maxTime.Truncate(granularity).Add(granularity)
-
-	// Create buckets
-	numBuckets := int(endTime.Sub(startTime) / granularity)
-	if numBuckets == 0 {
-		numBuckets = 1
-	}
-
-	buckets := make([]RateBucket, numBuckets)
-	for i := range buckets {
-		buckets[i].Start = startTime.Add(time.Duration(i) * granularity)
-		buckets[i].End = buckets[i].Start.Add(granularity)
-	}
+	// Create buckets aligned to the granularity boundaries in the layout's timezone
+	buckets := layout.makeBuckets(minTime, maxTime)
+	startTime := buckets[0].Start
+	endTime := buckets[len(buckets)-1].End
+	bucketIndex := layout.bucketIndexer(buckets)
 
 	// Count messages and bytes per bucket, collect message sizes
 	var totalBytes int64
 	msgSizes := make([]int, len(messages))
 	for i, msg := range messages {
-		bucketIdx := int(msg.Timestamp.Sub(startTime) / granularity)
-		if bucketIdx >= len(buckets) {
-			bucketIdx = len(buckets) - 1
-		}
-		if bucketIdx < 0 {
-			bucketIdx = 0
-		}
+		bucketIdx := bucketIndex(msg.Timestamp)
 		buckets[bucketIdx].Count++
 		buckets[bucketIdx].SeqCount++ // Each stored message counts as 1 in sequence count too
 		buckets[bucketIdx].Bytes += int64(msg.Size)
@@ -230,6 +255,10 @@ func BuildRateHistogram(streamName string, messages []MessageData, granularity t
 
 		// Track message size stats per bucket
 		buckets[bucketIdx].SumMsgSize += int64(msg.Size)
+		if buckets[bucketIdx].SizeSketch == nil {
+			buckets[bucketIdx].SizeSketch = &SizeSketch{}
+		}
+		buckets[bucketIdx].SizeSketch.Add(msg.Size)
 		if buckets[bucketIdx].Count == 1 {
 			// First message in this bucket - initialize min/max
 			buckets[bucketIdx].MinMsgSize = msg.Size
@@ -256,79 +285,38 @@ func BuildRateHistogram(streamName string, messages []MessageData, granularity t
 			streamData.Count++
 			streamData.SeqCount++ // Each stored message also counts toward SeqCount
 			streamData.Bytes += int64(msg.Size)
+			if streamData.SizeSketch == nil {
+				streamData.SizeSketch = &SizeSketch{}
+			}
+			streamData.SizeSketch.Add(msg.Size)
 		}
 	}
 
 	// Interpolate deleted messages: distribute gaps between consecutive messages
 	// across the buckets spanning their timestamps
-	// IMPORTANT: Track the last seen message per stream, since sequence numbers
-	// are per-stream and messages from multiple streams may be interleaved
-	lastMsgPerStream := make(map[string]*MessageData)
-
-	for i := range messages {
-		msg := &messages[i]
-		prevMsg, hasPrev := lastMsgPerStream[msg.StreamName]
-		lastMsgPerStream[msg.StreamName] = msg
-
-		if !hasPrev {
-			continue
-		}
-
-		// Calculate how many messages were deleted between these two (same stream)
-		gap := int(msg.Sequence - prevMsg.Sequence - 1)
-		if gap <= 0 {
-			continue
-		}
-
-		// Find the bucket indices for the two messages
-		prevBucketIdx := int(prevMsg.Timestamp.Sub(startTime) / granularity)
-		currBucketIdx := int(msg.Timestamp.Sub(startTime) / granularity)
-
-		// Clamp to valid range
-		if prevBucketIdx < 0 {
-			prevBucketIdx = 0
-		}
-		if prevBucketIdx >= len(buckets) {
-			prevBucketIdx = len(buckets) - 1
-		}
-		if currBucketIdx < 0 {
-			currBucketIdx = 0
-		}
-		if currBucketIdx >= len(buckets) {
-			currBucketIdx = len(buckets) - 1
-		}
-
-		// Distribute deleted messages across buckets from prevBucketIdx to currBucketIdx
-		bucketSpan := currBucketIdx - prevBucketIdx + 1
-		if bucketSpan <= 0 {
-			bucketSpan = 1
-		}
-
-		// Distribute evenly, with remainder going to earlier buckets
-		perBucket := gap / bucketSpan
-		remainder := gap % bucketSpan
-
-		for b := prevBucketIdx; b <= currBucketIdx; b++ {
-			addCount := perBucket
-			if remainder > 0 {
-				addCount++
-				remainder--
+	allGaps := findDeleteGaps(messages, opts.Gaps)
+	gaps := allGaps
+	if opts.Gaps.PurgeMode == PurgeGapsExclude {
+		gaps = make([]DeleteGap, 0, len(allGaps))
+		for _, gap := range allGaps {
+			if gap.Cause != GapPurge {
+				gaps = append(gaps, gap)
 			}
-			buckets[b].SeqCount += addCount
 		}
 	}
+	interpolateDeletes(buckets, gaps, layout, opts.Interpolation, trackPerStream)
+	gaps = spanningGaps(buckets, gaps, layout, trackPerStream)
 
 	// Calculate rates and throughput
-	granularitySecs := granularity.Seconds()
-	for i := range buckets {
-		buckets[i].Rate = float64(buckets[i].Count) / granularitySecs
-		buckets[i].SeqRate = float64(buckets[i].SeqCount) / granularitySecs
-		buckets[i].Throughput = float64(buckets[i].Bytes) / granularitySecs
-	}
+	computeBucketRates(buckets)
 
 	hist := &RateHistogram{
-		Buckets:     buckets,
-		Granularity: granularity,
+		Buckets:       buckets,
+		Granularity:   layout.Nominal(),
+		Layout:        layout,
+		Deletes:       breakdownGaps(allGaps, opts.Gaps.Streams),
+		Gaps:          gaps,
+		Interpolation: opts.Interpolation,
 	}
 
 	hist.Stats = calculateRateStats(buckets, len(messages), totalBytes, startTime, endTime, msgSizes, firstSeq, lastSeq)
@@ -336,6 +324,17 @@ func BuildRateHistogram(streamName string, messages []MessageData, granularity t
 	return hist
 }
 
+// computeBucketRates calculates the per second rates and throughput of the buckets
+// Buckets can differ in length (calendar layouts), so each is normalized by its own duration.
+func computeBucketRates(buckets []RateBucket) {
+	for i := range buckets {
+		bucketSecs := buckets[i].End.Sub(buckets[i].Start).Seconds()
+		buckets[i].Rate = float64(buckets[i].Count) / bucketSecs
+		buckets[i].SeqRate = float64(buckets[i].SeqCount) / bucketSecs
+		buckets[i].Throughput = float64(buckets[i].Bytes) / bucketSecs
+	}
+}
+
 // calculateRateStats computes statistics from rate buckets and message sizes
 func calculateRateStats(buckets []RateBucket, totalMessages int, totalBytes int64, startTime, endTime time.Time, msgSizes []int, firstSeq, lastSeq uint64) RateStatistics {
 	if len(buckets) == 0 {
@@ -618,9 +617,7 @@ func CalculateStatsFromBuckets(buckets []RateBucket) RateStatistics {
 	}
 	stats.StdDevTput = math.Sqrt(sumSquaredDiff / float64(len(throughputs)))
 
-	// Calculate message size statistics from bucket data
-	// Collect all message sizes by expanding bucket stats
-	var allMsgSizes []float64
+	// Calculate message size statistics from the merged size sketches of the buckets
 	var sumMsgSize int64
 	firstBucketWithMessages := true
 
@@ -644,35 +641,17 @@ func CalculateStatsFromBuckets(buckets []RateBucket) RateStatistics {
 				stats.MaxMsgSize = bucket.MaxMsgSize
 			}
 		}
-
-		// For percentile calculation, we use the average message size per bucket
-		// weighted by count (approximation since we don't have individual sizes)
-		if bucket.Count > 0 {
-			avgSize := float64(bucket.SumMsgSize) / float64(bucket.Count)
-			for j := 0; j < bucket.Count; j++ {
-				allMsgSizes = append(allMsgSizes, avgSize)
-			}
-		}
 	}
 
 	if totalMessages > 0 {
 		stats.AvgMsgSize = float64(sumMsgSize) / float64(totalMessages)
 
-		// Sort for percentiles
-		sort.Float64s(allMsgSizes)
-
-		stats.P50MsgSize = percentileFloat64(allMsgSizes, 0.50)
-		stats.P90MsgSize = percentileFloat64(allMsgSizes, 0.90)
-		stats.P99MsgSize = percentileFloat64(allMsgSizes, 0.99)
-		stats.P999MsgSize = percentileFloat64(allMsgSizes, 0.999)
-
-		// Standard deviation (approximation using bucket averages)
-		sumSquaredDiff = 0
-		for _, size := range allMsgSizes {
-			diff := size - stats.AvgMsgSize
-			sumSquaredDiff += diff * diff
-		}
-		stats.StdDevMsgSize = math.Sqrt(sumSquaredDiff / float64(len(allMsgSizes)))
+		sketch := mergeBucketSketches(buckets)
+		stats.P50MsgSize = sketch.Quantile(0.50)
+		stats.P90MsgSize = sketch.Quantile(0.90)
+		stats.P99MsgSize = sketch.Quantile(0.99)
+		stats.P999MsgSize = sketch.Quantile(0.999)
+		stats.StdDevMsgSize = sketch.StdDev(stats.AvgMsgSize)
 	}
 
 	return stats
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// IdleKind tells whether an idle gap had publishes that were deleted since
+type IdleKind string
+
+const (
+	// IdleNoPublishes is a gap with consecutive sequences on either side, nothing was published
+	IdleNoPublishes IdleKind = "no-publishes"
+	// IdleDeleted is a gap with missing sequences, messages were published but later deleted
+	IdleDeleted IdleKind = "deleted"
+	// IdleWindowEdge is a gap from the window start to the first message or from the last
+	// message to the window end, publishes outside the read messages are unknown
+	IdleWindowEdge IdleKind = "window-edge"
+)
+
+// IdleGapOptions controls idle gap detection
+type IdleGapOptions struct {
+	MinGap time.Duration // report gaps at least this long, 0 = derive from the inter-arrival times
+	Factor float64       // with MinGap 0, report gaps longer than Factor times the p99 inter-arrival time
+	TopN   int           // longest gaps to list per stream
+	// WindowStart and WindowEnd bound the time the messages were read from, zero when
+	// open. The stream is also idle from the start to its first message and from its
+	// last message to the end.
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+// IdleGap is a period without stored messages between two consecutive stored messages of a
+// stream, or between a window bound and the nearest stored message
+type IdleGap struct {
+	Start   time.Time // timestamp of the stored message before the gap, or the window start
+	End     time.Time // timestamp of the stored message after the gap, or the window end
+	PrevSeq uint64    // 0 for the gap from the window start
+	NextSeq uint64    // 0 for the gap up to the window end
+	Deleted int       // sequences published in between and deleted since
+	Cause   GapCause  // cause of the deletes, empty if none
+}
+
+// Duration returns how long the stream was idle
+func (g IdleGap) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+// Kind returns whether anything was published during the gap
+func (g IdleGap) Kind() IdleKind {
+	if g.PrevSeq == 0 || g.NextSeq == 0 {
+		return IdleWindowEdge
+	}
+	if g.Deleted > 0 {
+		return IdleDeleted
+	}
+	return IdleNoPublishes
+}
+
+// IdleGapReport holds the idle gaps of a stream
+type IdleGapReport struct {
+	StreamName  string
+	Threshold   time.Duration
+	P50Interval time.Duration // median inter-arrival time
+	P99Interval time.Duration
+	TotalGaps   int
+	NoPublishes int
+	WithDeletes int
+	AtEdges     int // gaps at the window start or end
+	IdleTime    time.Duration
+	Gaps        []IdleGap // top N longest, longest first
+}
+
+// FindIdleGaps finds the gaps in a stream's timeline longer than the threshold, including
+// those at the window bounds. The messages are expected to be from one stream, sorted by
+// timestamp. The delete gaps of the stream, if given, supply the cause of gaps that had
+// their messages deleted.
+func FindIdleGaps(streamName string, messages []MessageData, deleteGaps []DeleteGap, opts IdleGapOptions) *IdleGapReport {
+	if len(messages) < 2 {
+		return nil
+	}
+
+	intervals := make([]float64, 0, len(messages)-1)
+	for i := 1; i < len(messages); i++ {
+		intervals = append(intervals, float64(messages[i].Timestamp.Sub(messages[i-1].Timestamp)))
+	}
+	sort.Float64s(intervals)
+
+	report := &IdleGapReport{
+		StreamName:  streamName,
+		Threshold:   opts.MinGap,
+		P50Interval: time.Duration(percentileFloat64(intervals, 0.50)),
+		P99Interval: time.Duration(percentileFloat64(intervals, 0.99)),
+	}
+	if report.Threshold <= 0 {
+		report.Threshold = time.Duration(opts.Factor * float64(report.P99Interval))
+	}
+	if report.Threshold <= 0 {
+		// Every message arrived at the same time, nothing can be idle
+		return report
+	}
+
+	causes := make(map[uint64]GapCause, len(deleteGaps))
+	for _, gap := range deleteGaps {
+		if gap.StreamName == streamName {
+			causes[gap.PrevSeq] = gap.Cause
+		}
+	}
+
+	var gaps []IdleGap
+	for i := 1; i < len(messages); i++ {
+		prev, next := messages[i-1], messages[i]
+		if next.Timestamp.Sub(prev.Timestamp) < report.Threshold {
+			continue
+		}
+
+		gap := IdleGap{
+			Start:   prev.Timestamp,
+			End:     next.Timestamp,
+			PrevSeq: prev.Sequence,
+			NextSeq: next.Sequence,
+		}
+		if next.Sequence > prev.Sequence+1 {
+			gap.Deleted = int(next.Sequence - prev.Sequence - 1)
+			gap.Cause = causes[prev.Sequence]
+			report.WithDeletes++
+		} else {
+			report.NoPublishes++
+		}
+		report.IdleTime += gap.Duration()
+		gaps = append(gaps, gap)
+	}
+
+	for _, gap := range edgeGaps(messages, opts.WindowStart, opts.WindowEnd) {
+		if gap.Duration() < report.Threshold {
+			continue
+		}
+		report.AtEdges++
+		report.IdleTime += gap.Duration()
+		gaps = append(gaps, gap)
+	}
+	report.TotalGaps = len(gaps)
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gaps[i].Duration() > gaps[j].Duration()
+	})
+	if opts.TopN > 0 && len(gaps) > opts.TopN {
+		gaps = gaps[:opts.TopN]
+	}
+	report.Gaps = gaps
+
+	return report
+}
+
+// edgeGaps returns the idle gaps from the window start to the first message and from the
+// last message to the window end, skipping open bounds. The messages are sorted by timestamp.
+func edgeGaps(messages []MessageData, start, end time.Time) []IdleGap {
+	if len(messages) == 0 {
+		return nil
+	}
+	var gaps []IdleGap
+	if first := messages[0]; !start.IsZero() && first.Timestamp.After(start) {
+		gaps = append(gaps, IdleGap{Start: start, End: first.Timestamp, NextSeq: first.Sequence})
+	}
+	if last := messages[len(messages)-1]; !end.IsZero() && end.After(last.Timestamp) {
+		gaps = append(gaps, IdleGap{Start: last.Timestamp, End: end, PrevSeq: last.Sequence})
+	}
+	return gaps
+}
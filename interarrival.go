@@ -0,0 +1,163 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// interArrivalBounds are the upper bounds of the log-scale inter-arrival histogram bins,
+// after a first bin for identical timestamps and before a last open-ended bin
+var interArrivalBounds = []time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+// InterArrivalBin counts the intervals falling in [Lower, Upper), Upper is 0 for the last bin
+type InterArrivalBin struct {
+	Lower time.Duration
+	Upper time.Duration
+	Count int
+}
+
+// InterArrivalStats describes the time between consecutive stored messages of a stream
+type InterArrivalStats struct {
+	StreamName string // empty for all streams combined
+	Intervals  int
+	Mean       time.Duration
+	StdDev     time.Duration
+	Min        time.Duration
+	Max        time.Duration
+	P50        time.Duration
+	P90        time.Duration
+	P99        time.Duration
+	P999       time.Duration
+	// CV is the coefficient of variation, 1 for Poisson arrivals and above 1 for bursty traffic
+	CV float64
+	// Burstiness is (stddev - mean) / (stddev + mean): -1 for periodic, 0 for Poisson and
+	// towards 1 for bursty arrivals
+	Burstiness float64
+	// Batches are runs of two or more messages sharing a timestamp
+	Batches        int
+	BatchedMsgs    int // messages in batches
+	MaxBatch       int
+	SameTimestamps int // intervals of zero
+	Histogram      []InterArrivalBin
+}
+
+// BatchedShare returns the fraction of messages that arrived in a batch
+func (s *InterArrivalStats) BatchedShare() float64 {
+	if s.Intervals == 0 {
+		return 0
+	}
+	return float64(s.BatchedMsgs) / float64(s.Intervals+1)
+}
+
+// CalculateInterArrival computes the inter-arrival statistics of messages sorted by timestamp
+// Messages of several streams give the arrival pattern of the streams together.
+func CalculateInterArrival(streamName string, messages []MessageData) *InterArrivalStats {
+	if len(messages) < 2 {
+		return nil
+	}
+
+	stats := &InterArrivalStats{
+		StreamName: streamName,
+		Intervals:  len(messages) - 1,
+		Histogram:  make([]InterArrivalBin, len(interArrivalBounds)+2),
+	}
+	lower := time.Duration(0)
+	for i, bound := range interArrivalBounds {
+		stats.Histogram[i+1] = InterArrivalBin{Lower: lower, Upper: bound}
+		lower = bound
+	}
+	stats.Histogram[len(stats.Histogram)-1] = InterArrivalBin{Lower: lower}
+
+	intervals := make([]float64, 0, stats.Intervals)
+	var sum float64
+	batch := 1
+	endBatch := func() {
+		if batch > 1 {
+			stats.Batches++
+			stats.BatchedMsgs += batch
+			stats.MaxBatch = max(stats.MaxBatch, batch)
+		}
+		batch = 1
+	}
+
+	for i := 1; i < len(messages); i++ {
+		d := messages[i].Timestamp.Sub(messages[i-1].Timestamp)
+		intervals = append(intervals, float64(d))
+		sum += float64(d)
+
+		if d == 0 {
+			stats.SameTimestamps++
+			stats.Histogram[0].Count++
+			batch++
+			continue
+		}
+		endBatch()
+
+		bin := sort.Search(len(interArrivalBounds), func(b int) bool {
+			return d < interArrivalBounds[b]
+		})
+		stats.Histogram[bin+1].Count++
+	}
+	endBatch()
+
+	mean := sum / float64(len(intervals))
+	var variance float64
+	for _, d := range intervals {
+		variance += (d - mean) * (d - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(intervals)))
+
+	sort.Float64s(intervals)
+	stats.Mean = time.Duration(mean)
+	stats.StdDev = time.Duration(stdDev)
+	stats.Min = time.Duration(intervals[0])
+	stats.Max = time.Duration(intervals[len(intervals)-1])
+	stats.P50 = time.Duration(percentileFloat64(intervals, 0.50))
+	stats.P90 = time.Duration(percentileFloat64(intervals, 0.90))
+	stats.P99 = time.Duration(percentileFloat64(intervals, 0.99))
+	stats.P999 = time.Duration(percentileFloat64(intervals, 0.999))
+	if mean > 0 {
+		stats.CV = stdDev / mean
+		stats.Burstiness = (stdDev - mean) / (stdDev + mean)
+	}
+
+	return stats
+}
+
+// interArrivalBinLabel describes a histogram bin, e.g. "1ms-10ms"
+func interArrivalBinLabel(bin InterArrivalBin) string {
+	switch {
+	case bin.Upper == 0 && bin.Lower == 0:
+		return "0 (same time)"
+	case bin.Upper == 0:
+		return ">= " + shortDuration(bin.Lower)
+	case bin.Lower == 0:
+		return "< " + shortDuration(bin.Upper)
+	}
+	return shortDuration(bin.Lower) + "-" + shortDuration(bin.Upper)
+}
+
+// shortDuration formats a round duration compactly, e.g. 10m instead of 10m0s
+func shortDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	case d >= time.Minute && d%time.Minute == 0:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	}
+	return d.String()
+}
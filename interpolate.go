@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// InterpolationStrategy decides how the deleted messages of a gap are spread over the
+// buckets between the stored messages on either side of it
+type InterpolationStrategy string
+
+const (
+	// InterpolateEven spreads deletes evenly, with the remainder going to earlier buckets
+	InterpolateEven InterpolationStrategy = "even"
+	// InterpolateProportional spreads deletes in proportion to the stream's stored messages per bucket
+	InterpolateProportional InterpolationStrategy = "proportional"
+	// InterpolateMidpoint puts all deletes in the bucket halfway between the two stored messages
+	InterpolateMidpoint InterpolationStrategy = "midpoint"
+	// InterpolateExpDecay concentrates deletes right after the previous stored message,
+	// decaying by 1/e every quarter of the gap's buckets
+	InterpolateExpDecay InterpolationStrategy = "exp-decay"
+	// InterpolateNone does not interpolate, the sequence based rate equals the stored rate
+	InterpolateNone InterpolationStrategy = "none"
+)
+
+// interpolationStrategies lists all strategies, the first one is the default
+var interpolationStrategies = []InterpolationStrategy{
+	InterpolateEven,
+	InterpolateProportional,
+	InterpolateMidpoint,
+	InterpolateExpDecay,
+	InterpolateNone,
+}
+
+// interpolationStrategyNames returns the strategy names for flag enums
+func interpolationStrategyNames() []string {
+	names := make([]string, len(interpolationStrategies))
+	for i, s := range interpolationStrategies {
+		names[i] = string(s)
+	}
+	return names
+}
+
+// ParseInterpolationStrategy validates a strategy name
+func ParseInterpolationStrategy(s string) (InterpolationStrategy, error) {
+	for _, strategy := range interpolationStrategies {
+		if string(strategy) == s {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown interpolation strategy %q", s)
+}
+
+// interpolateDeletes adds the deleted messages of the gaps to the SeqCount of the buckets.
+// SeqCount is expected to hold only the stored messages. If trackPerStream is set, the
+// per-stream SeqCount is updated too.
+func interpolateDeletes(buckets []RateBucket, gaps []DeleteGap, layout BucketLayout, strategy InterpolationStrategy, trackPerStream bool) {
+	if len(buckets) == 0 || strategy == InterpolateNone {
+		return
+	}
+
+	bucketIndex := layout.bucketIndexer(buckets)
+
+	var weights []float64
+	for _, gap := range gaps {
+		// Find the bucket indices for the two messages
+		prevBucketIdx := bucketIndex(gap.PrevTime)
+		currBucketIdx := bucketIndex(gap.NextTime)
+		bucketSpan := max(currBucketIdx-prevBucketIdx+1, 1)
+
+		add := func(b, count int) {
+			if count == 0 {
+				return
+			}
+			buckets[b].SeqCount += count
+			if trackPerStream {
+				if buckets[b].PerStream == nil {
+					buckets[b].PerStream = make(map[string]*StreamBucketData)
+				}
+				streamData := buckets[b].PerStream[gap.StreamName]
+				if streamData == nil {
+					streamData = &StreamBucketData{}
+					buckets[b].PerStream[gap.StreamName] = streamData
+				}
+				streamData.SeqCount += count
+			}
+		}
+
+		switch strategy {
+		case InterpolateMidpoint:
+			add(bucketIndex(gap.PrevTime.Add(gap.NextTime.Sub(gap.PrevTime)/2)), gap.Count)
+			continue
+
+		case InterpolateProportional:
+			weights = weights[:0]
+			var total float64
+			for b := prevBucketIdx; b < prevBucketIdx+bucketSpan; b++ {
+				// Use the gap's own stream when the buckets hold several streams
+				stored := buckets[b].Count
+				if trackPerStream {
+					stored = 0
+					if streamData := buckets[b].PerStream[gap.StreamName]; streamData != nil {
+						stored = streamData.Count
+					}
+				}
+				weights = append(weights, float64(stored))
+				total += float64(stored)
+			}
+			if total > 0 {
+				for i, count := range distributeWeighted(gap.Count, weights) {
+					add(prevBucketIdx+i, count)
+				}
+				continue
+			}
+			// No stored messages to go by, fall back to an even spread
+
+		case InterpolateExpDecay:
+			weights = weights[:0]
+			tau := max(float64(bucketSpan)/4, 1)
+			for i := range bucketSpan {
+				weights = append(weights, math.Exp(-float64(i)/tau))
+			}
+			for i, count := range distributeWeighted(gap.Count, weights) {
+				add(prevBucketIdx+i, count)
+			}
+			continue
+		}
+
+		// Distribute evenly, with remainder going to earlier buckets
+		perBucket := gap.Count / bucketSpan
+		remainder := gap.Count % bucketSpan
+		for b := prevBucketIdx; b < prevBucketIdx+bucketSpan; b++ {
+			addCount := perBucket
+			if remainder > 0 {
+				addCount++
+				remainder--
+			}
+			add(b, addCount)
+		}
+	}
+}
+
+// spanningGaps returns the gaps spanning several buckets. The deletes of the other gaps are
+// added to the InBucketDeletes of their bucket instead, as they end up there whatever the
+// strategy, so only the spanning gaps need to be kept to re-interpolate.
+func spanningGaps(buckets []RateBucket, gaps []DeleteGap, layout BucketLayout, trackPerStream bool) []DeleteGap {
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	bucketIndex := layout.bucketIndexer(buckets)
+	var spanning []DeleteGap
+	for _, gap := range gaps {
+		b := bucketIndex(gap.PrevTime)
+		if b != bucketIndex(gap.NextTime) {
+			spanning = append(spanning, gap)
+			continue
+		}
+		buckets[b].InBucketDeletes += gap.Count
+		if trackPerStream {
+			// Both stored messages around the gap are in this bucket, so the stream has an entry
+			buckets[b].PerStream[gap.StreamName].InBucketDeletes += gap.Count
+		}
+	}
+	return spanning
+}
+
+// distributeWeighted splits count in proportion to weights using the largest remainder
+// method, so the parts always add up to count. Ties go to earlier positions.
+func distributeWeighted(count int, weights []float64) []int {
+	parts := make([]int, len(weights))
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return parts
+	}
+
+	remainders := make([]int, len(weights))
+	fractions := make([]float64, len(weights))
+	assigned := 0
+	for i, w := range weights {
+		exact := float64(count) * w / total
+		parts[i] = int(exact)
+		fractions[i] = exact - float64(parts[i])
+		remainders[i] = i
+		assigned += parts[i]
+	}
+
+	sort.SliceStable(remainders, func(a, b int) bool {
+		return fractions[remainders[a]] > fractions[remainders[b]]
+	})
+	for i := 0; assigned < count; i++ {
+		parts[remainders[i%len(remainders)]]++
+		assigned++
+	}
+
+	return parts
+}
+
+// Reinterpolate returns a copy of the histogram with its gaps spread using another strategy
+// Stored message statistics are kept, the sequence based rate statistics are recalculated.
+func (h *RateHistogram) Reinterpolate(strategy InterpolationStrategy) *RateHistogram {
+	if h == nil || strategy == h.Interpolation {
+		return h
+	}
+
+	inBucket := func(deletes int) int {
+		if strategy == InterpolateNone {
+			return 0
+		}
+		return deletes
+	}
+
+	buckets := make([]RateBucket, len(h.Buckets))
+	trackPerStream := false
+	for i, b := range h.Buckets {
+		buckets[i] = b
+		buckets[i].SeqCount = b.Count + inBucket(b.InBucketDeletes)
+		if b.PerStream != nil {
+			trackPerStream = true
+			buckets[i].PerStream = make(map[string]*StreamBucketData, len(b.PerStream))
+			for name, data := range b.PerStream {
+				if data.Count == 0 && data.Bytes == 0 {
+					// Only held interpolated deletes
+					continue
+				}
+				buckets[i].PerStream[name] = &StreamBucketData{
+					Count:           data.Count,
+					SeqCount:        data.Count + inBucket(data.InBucketDeletes),
+					Bytes:           data.Bytes,
+					InBucketDeletes: data.InBucketDeletes,
+					SizeSketch:      data.SizeSketch,
+				}
+			}
+		}
+	}
+
+	interpolateDeletes(buckets, h.Gaps, h.Layout, strategy, trackPerStream)
+	computeBucketRates(buckets)
+
+	stats := h.Stats
+	setSeqRateStats(&stats, CalculateStatsFromBuckets(buckets))
+
+	return &RateHistogram{
+		Buckets:       buckets,
+		Granularity:   h.Granularity,
+		Layout:        h.Layout,
+		Stats:         stats,
+		Deletes:       h.Deletes,
+		Gaps:          h.Gaps,
+		Interpolation: strategy,
+	}
+}
+
+// setSeqRateStats copies the sequence based rate statistics from src to dst
+func setSeqRateStats(dst *RateStatistics, src RateStatistics) {
+	dst.AvgSeqRate = src.AvgSeqRate
+	dst.P50SeqRate = src.P50SeqRate
+	dst.P90SeqRate = src.P90SeqRate
+	dst.P99SeqRate = src.P99SeqRate
+	dst.P999SeqRate = src.P999SeqRate
+	dst.MinSeqRate = src.MinSeqRate
+	dst.MaxSeqRate = src.MaxSeqRate
+	dst.StdDevSeqRate = src.StdDevSeqRate
+}
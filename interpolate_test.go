@@ -0,0 +1,134 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDistributeWeighted(t *testing.T) {
+	tests := []struct {
+		count   int
+		weights []float64
+		want    []int
+	}{
+		{10, []float64{1, 1, 1, 1, 1}, []int{2, 2, 2, 2, 2}},
+		{7, []float64{1, 1, 1}, []int{3, 2, 2}},
+		{10, []float64{3, 0, 1}, []int{8, 0, 2}},
+		{100, []float64{0.5, 0.25, 0.25}, []int{50, 25, 25}},
+		{1, []float64{1, 2, 1}, []int{0, 1, 0}},
+		{5, []float64{0, 0}, []int{0, 0}},
+		{0, []float64{1, 2}, []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		if got := distributeWeighted(tt.count, tt.weights); !slices.Equal(got, tt.want) {
+			t.Errorf("distributeWeighted(%d, %v) = %v, want %v", tt.count, tt.weights, got, tt.want)
+		}
+	}
+}
+
+// interpolationHistogram returns ten minute buckets where stream A stores 4, 1 and 5 messages
+// in the first, second and last bucket, with 100 deletes in between and 3 in the first bucket.
+// Stream B stores 6 messages in the fifth bucket, which the A deletes ignore.
+func interpolationHistogram() *RateHistogram {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	stored := map[string][]int{
+		"A": {4, 1, 0, 0, 0, 0, 0, 0, 0, 5},
+		"B": {0, 0, 0, 0, 6, 0, 0, 0, 0, 0},
+	}
+
+	buckets := make([]RateBucket, 10)
+	for i := range buckets {
+		b := &buckets[i]
+		b.Start = start.Add(time.Duration(i) * time.Minute)
+		b.End = b.Start.Add(time.Minute)
+		b.PerStream = make(map[string]*StreamBucketData)
+		for name, counts := range stored {
+			if counts[i] == 0 {
+				continue
+			}
+			b.PerStream[name] = &StreamBucketData{Count: counts[i], SeqCount: counts[i], Bytes: int64(100 * counts[i])}
+			b.Count += counts[i]
+			b.SeqCount += counts[i]
+			b.Bytes += int64(100 * counts[i])
+		}
+	}
+	buckets[0].InBucketDeletes = 3
+	buckets[0].PerStream["A"].InBucketDeletes = 3
+	computeBucketRates(buckets)
+
+	return &RateHistogram{
+		Buckets:       buckets,
+		Granularity:   time.Minute,
+		Layout:        BucketLayout{Duration: time.Minute},
+		Stats:         CalculateStatsFromBuckets(buckets),
+		Gaps:          []DeleteGap{{StreamName: "A", PrevSeq: 8, PrevTime: start.Add(50 * time.Second), NextTime: start.Add(9*time.Minute + 10*time.Second), Count: 100}},
+		Interpolation: InterpolateNone,
+	}
+}
+
+func TestReinterpolate(t *testing.T) {
+	tests := []struct {
+		strategy InterpolationStrategy
+		deletes  int // all deletes of stream A
+		check    func(spread []int) bool
+	}{
+		{InterpolateEven, 103, func(spread []int) bool {
+			return slices.Equal(spread, []int{13, 10, 10, 10, 10, 10, 10, 10, 10, 10})
+		}},
+		{InterpolateProportional, 103, func(spread []int) bool {
+			return slices.Equal(spread, []int{43, 10, 0, 0, 0, 0, 0, 0, 0, 50})
+		}},
+		{InterpolateMidpoint, 103, func(spread []int) bool {
+			return slices.Equal(spread, []int{3, 0, 0, 0, 0, 100, 0, 0, 0, 0})
+		}},
+		{InterpolateExpDecay, 103, func(spread []int) bool {
+			// Falling by 1/e every 2.5 buckets, so about a third in the first one
+			return slices.IsSortedFunc(spread[1:], func(a, b int) int { return b - a }) && spread[0]-3 >= 33 && spread[5] <= 5
+		}},
+		{InterpolateNone, 0, func(spread []int) bool {
+			return slices.Equal(spread, make([]int, 10))
+		}},
+	}
+
+	base := interpolationHistogram()
+	for _, tt := range tests {
+		// By way of another strategy, so the deletes of one strategy are not kept by the next
+		h := base.Reinterpolate(InterpolateMidpoint).Reinterpolate(tt.strategy)
+		if h.Interpolation != tt.strategy {
+			t.Errorf("%s: interpolation %s", tt.strategy, h.Interpolation)
+		}
+
+		spread := make([]int, len(h.Buckets))
+		var deletes int
+		for i, b := range h.Buckets {
+			if b.Count != base.Buckets[i].Count {
+				t.Errorf("%s: bucket %d stores %d messages, want %d", tt.strategy, i, b.Count, base.Buckets[i].Count)
+			}
+			if a := b.PerStream["A"]; a != nil {
+				spread[i] = a.SeqCount - a.Count
+			}
+			if other := b.PerStream["B"]; other != nil && other.SeqCount != other.Count {
+				t.Errorf("%s: bucket %d has %d stream B deletes", tt.strategy, i, other.SeqCount-other.Count)
+			}
+			if b.SeqCount-b.Count != spread[i] {
+				t.Errorf("%s: bucket %d has %d deletes, %d of stream A", tt.strategy, i, b.SeqCount-b.Count, spread[i])
+			}
+			if want := float64(b.SeqCount) / 60; b.SeqRate != want {
+				t.Errorf("%s: bucket %d sequence rate %v, want %v", tt.strategy, i, b.SeqRate, want)
+			}
+			deletes += spread[i]
+		}
+
+		if deletes != tt.deletes {
+			t.Errorf("%s: %d deletes placed, want %d", tt.strategy, deletes, tt.deletes)
+		}
+		if !tt.check(spread) {
+			t.Errorf("%s: deletes placed as %v", tt.strategy, spread)
+		}
+		if h.Stats.TotalMessages != base.Stats.TotalMessages || h.Stats.AvgRate != base.Stats.AvgRate {
+			t.Errorf("%s: stored message statistics changed", tt.strategy)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// jszPingSubject asks every server for its JetStream details, answered in the system account
+const jszPingSubject = "$SYS.REQ.SERVER.PING.JSZ"
+
+const (
+	// jszWait is the longest a sampling round waits for servers to answer
+	jszWait = 3 * time.Second
+	// jszSettle ends a round once no server has answered for this long
+	jszSettle = 500 * time.Millisecond
+)
+
+// JSZOptions controls sampling of the JetStream details of all servers
+type JSZOptions struct {
+	Context  string        // NATS context with system account credentials
+	Account  string        // only sample the streams of this account, empty for all
+	Interval time.Duration // time between sampling rounds
+	Duration time.Duration // how long to sample
+}
+
+// jszRequest is the body of a JSZ ping, a subset of the server's JSzOptions
+type jszRequest struct {
+	Account  string `json:"account,omitempty"`
+	Accounts bool   `json:"accounts,omitempty"`
+	Streams  bool   `json:"streams,omitempty"`
+	Config   bool   `json:"config,omitempty"`
+}
+
+// jszResponse is one server's answer to a JSZ ping, with only the fields used here
+type jszResponse struct {
+	Server struct {
+		Name    string `json:"name"`
+		Cluster string `json:"cluster"`
+	} `json:"server"`
+	Data *struct {
+		AccountDetails []struct {
+			Name    string `json:"name"`
+			Streams []struct {
+				Name    string `json:"name"`
+				Cluster *struct {
+					Leader   string `json:"leader"`
+					Replicas []struct {
+						Name string `json:"name"`
+						Lag  uint64 `json:"lag"`
+					} `json:"replicas"`
+				} `json:"cluster"`
+				Config *struct {
+					Retention string `json:"retention"`
+				} `json:"config"`
+				State struct {
+					Msgs     uint64 `json:"messages"`
+					Bytes    uint64 `json:"bytes"`
+					FirstSeq uint64 `json:"first_seq"`
+					LastSeq  uint64 `json:"last_seq"`
+				} `json:"state"`
+			} `json:"stream_detail"`
+		} `json:"account_details"`
+	} `json:"data"`
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// JSZReplica is the state of one replica of a stream as reported by the server holding it
+type JSZReplica struct {
+	Account  string
+	Stream   string
+	Server   string
+	Cluster  string
+	Leader   bool
+	Messages uint64
+	Bytes    uint64
+	FirstSeq uint64
+	LastSeq  uint64
+	Lag      uint64 // operations behind the leader, as the leader sees it
+}
+
+// JSZRound is one sampling round: the replicas reported by every server that answered
+type JSZRound struct {
+	Time     time.Time
+	Servers  int
+	Replicas []JSZReplica
+}
+
+// SampleJSZ pings all servers once and returns the stream replicas they report, keeping
+// limits retention streams only
+func SampleJSZ(ctx context.Context, nc *nats.Conn, opts JSZOptions) (JSZRound, error) {
+	round := JSZRound{Time: time.Now()}
+
+	body, err := json.Marshal(jszRequest{Account: opts.Account, Accounts: true, Streams: true, Config: true})
+	if err != nil {
+		return round, err
+	}
+
+	inbox := nc.NewRespInbox()
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := nc.ChanSubscribe(inbox, msgs)
+	if err != nil {
+		return round, err
+	}
+	defer sub.Unsubscribe()
+
+	if err := nc.PublishRequest(jszPingSubject, inbox, body); err != nil {
+		return round, err
+	}
+
+	// Lags are reported by leaders about their followers
+	lags := make(map[string]uint64)
+	deadline := time.NewTimer(jszWait)
+	defer deadline.Stop()
+	settle := time.NewTimer(jszWait)
+	defer settle.Stop()
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			return round, ctx.Err()
+		case <-deadline.C:
+			done = true
+		case <-settle.C:
+			done = true
+		case msg := <-msgs:
+			settle.Reset(jszSettle)
+
+			var resp jszResponse
+			if err := json.Unmarshal(msg.Data, &resp); err != nil {
+				return round, fmt.Errorf("invalid JSZ response: %w", err)
+			}
+			if resp.Error != nil {
+				return round, fmt.Errorf("server %s: %s (%d)", resp.Server.Name, resp.Error.Description, resp.Error.Code)
+			}
+			if resp.Data == nil {
+				continue
+			}
+			round.Servers++
+
+			for _, account := range resp.Data.AccountDetails {
+				for _, stream := range account.Streams {
+					if stream.Config != nil && stream.Config.Retention != "" && stream.Config.Retention != "limits" {
+						continue
+					}
+					replica := JSZReplica{
+						Account:  account.Name,
+						Stream:   stream.Name,
+						Server:   resp.Server.Name,
+						Cluster:  resp.Server.Cluster,
+						Leader:   stream.Cluster == nil || stream.Cluster.Leader == "" || stream.Cluster.Leader == resp.Server.Name,
+						Messages: stream.State.Msgs,
+						Bytes:    stream.State.Bytes,
+						FirstSeq: stream.State.FirstSeq,
+						LastSeq:  stream.State.LastSeq,
+					}
+					if replica.Leader && stream.Cluster != nil {
+						for _, peer := range stream.Cluster.Replicas {
+							lags[replicaKey(JSZReplica{Account: account.Name, Stream: stream.Name, Server: peer.Name})] = peer.Lag
+						}
+					}
+					round.Replicas = append(round.Replicas, replica)
+				}
+			}
+		}
+	}
+
+	for i, r := range round.Replicas {
+		round.Replicas[i].Lag = lags[replicaKey(r)]
+	}
+	if round.Servers == 0 {
+		return round, fmt.Errorf("no server answered %s, do the credentials belong to the system account?", jszPingSubject)
+	}
+	return round, nil
+}
+
+// CollectJSZ samples all servers every interval for the sampling duration
+func CollectJSZ(ctx context.Context, nc *nats.Conn, opts JSZOptions, showProgress bool) ([]JSZRound, error) {
+	samples := int(opts.Duration/opts.Interval) + 1
+	rounds := make([]JSZRound, 0, samples)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for i := range samples {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		round, err := SampleJSZ(ctx, nc, opts)
+		if err != nil {
+			return nil, err
+		}
+		rounds = append(rounds, round)
+		if showProgress {
+			fmt.Printf("\rSampled %d of %d rounds from %d server(s)", len(rounds), samples, round.Servers)
+		}
+	}
+	if showProgress {
+		fmt.Println()
+	}
+	return rounds, nil
+}
+
+// jszStreamState is the state of a stream in one round, from its leader or its most
+// advanced replica when no leader answered
+type jszStreamState struct {
+	Messages uint64
+	Bytes    uint64
+	FirstSeq uint64
+	LastSeq  uint64
+}
+
+// JSZAnalysis is the traffic of all streams derived from sampled JSZ details
+type JSZAnalysis struct {
+	Summary   ReportSummary
+	Histogram *RateHistogram // combined, with the per-stream breakdown
+	Rounds    int
+	Servers   int
+	// Replicas holds the state of every replica in the last round, and First the state of
+	// the same replicas in the first round they were seen, keyed like replicaKey
+	Replicas []JSZReplica
+	First    map[string]JSZReplica
+}
+
+// replicaKey identifies a replica across rounds
+func replicaKey(r JSZReplica) string {
+	return r.Account + "\x00" + r.Stream + "\x00" + r.Server
+}
+
+// BuildJSZAnalysis turns sampling rounds into a combined rate histogram with one bucket
+// between consecutive rounds. Published messages are the advance of the last sequence, so
+// no payloads are read; their sizes are estimated from the average stored message size.
+// Every published message counts as stored, deletes cannot be told apart. Streams are named
+// ACCOUNT/STREAM when more than one account was sampled. Only streams matching one of the
+// filters are kept, all of them without filters.
+func BuildJSZAnalysis(rounds []JSZRound, filters []string, layout BucketLayout) (*JSZAnalysis, error) {
+	if len(rounds) < 2 {
+		return nil, fmt.Errorf("need at least two sampling rounds, sample for longer than the interval")
+	}
+
+	accounts := make(map[string]bool)
+	for _, round := range rounds {
+		for _, r := range round.Replicas {
+			accounts[r.Account] = true
+		}
+	}
+	name := func(r JSZReplica) string {
+		if len(accounts) > 1 {
+			return r.Account + "/" + r.Stream
+		}
+		return r.Stream
+	}
+	keep := func(r JSZReplica) bool {
+		if len(filters) == 0 {
+			return true
+		}
+		for _, f := range filters {
+			if ok, _ := path.Match(f, r.Stream); ok || f == name(r) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Per round, the state of each stream from its leader or most advanced replica
+	states := make([]map[string]jszStreamState, len(rounds))
+	analysis := &JSZAnalysis{Rounds: len(rounds), First: make(map[string]JSZReplica)}
+	for i, round := range rounds {
+		states[i] = make(map[string]jszStreamState)
+		leaders := make(map[string]bool)
+		for _, r := range round.Replicas {
+			if !keep(r) {
+				continue
+			}
+			if _, seen := analysis.First[replicaKey(r)]; !seen {
+				analysis.First[replicaKey(r)] = r
+			}
+			n := name(r)
+			state, ok := states[i][n]
+			if leaders[n] || (ok && !r.Leader && r.LastSeq <= state.LastSeq) {
+				continue
+			}
+			states[i][n] = jszStreamState{Messages: r.Messages, Bytes: r.Bytes, FirstSeq: r.FirstSeq, LastSeq: r.LastSeq}
+			leaders[n] = r.Leader
+		}
+		analysis.Servers = max(analysis.Servers, round.Servers)
+	}
+	for _, r := range rounds[len(rounds)-1].Replicas {
+		if keep(r) {
+			analysis.Replicas = append(analysis.Replicas, r)
+		}
+	}
+
+	// One bucket between each pair of rounds, counting the sequences each stream advanced
+	// since it was last seen
+	buckets := make([]RateBucket, len(rounds)-1)
+	lastSeen := make(map[string]jszStreamState)
+	published := make(map[string]int)
+	for n, state := range states[0] {
+		lastSeen[n] = state
+	}
+	for i := range buckets {
+		b := &buckets[i]
+		b.Start = rounds[i].Time
+		b.End = rounds[i+1].Time
+		b.PerStream = make(map[string]*StreamBucketData)
+		for n, state := range states[i+1] {
+			prev, ok := lastSeen[n]
+			lastSeen[n] = state
+			if !ok {
+				continue
+			}
+			var count uint64
+			switch {
+			case state.LastSeq >= prev.LastSeq:
+				count = state.LastSeq - prev.LastSeq
+			default:
+				// The stream was recreated, everything in it is new
+				count = state.LastSeq
+			}
+			if count == 0 {
+				continue
+			}
+			var size int
+			if state.Messages > 0 {
+				size = int(state.Bytes / state.Messages)
+			}
+			data := &StreamBucketData{
+				Count:      int(count),
+				SeqCount:   int(count),
+				Bytes:      int64(size) * int64(count),
+				SizeSketch: &SizeSketch{},
+			}
+			data.SizeSketch.AddN(size, int(count))
+			b.PerStream[n] = data
+
+			if b.SizeSketch == nil {
+				b.SizeSketch = &SizeSketch{}
+				b.MinMsgSize, b.MaxMsgSize = size, size
+			}
+			b.SizeSketch.Merge(data.SizeSketch)
+			b.MinMsgSize = min(b.MinMsgSize, size)
+			b.MaxMsgSize = max(b.MaxMsgSize, size)
+			b.Count += int(count)
+			b.SeqCount += int(count)
+			b.Bytes += data.Bytes
+			b.SumMsgSize += data.Bytes
+			published[n] += int(count)
+		}
+	}
+	computeBucketRates(buckets)
+
+	hist := &RateHistogram{
+		Buckets:       buckets,
+		Granularity:   layout.Nominal(),
+		Layout:        layout,
+		Stats:         CalculateStatsFromBuckets(buckets),
+		Interpolation: InterpolateNone,
+	}
+	// The sequences of several streams have no common range, FirstSeq and LastSeq stay unset
+	hist.Stats.TotalBuckets = len(buckets)
+
+	start, end := rounds[0].Time, rounds[len(rounds)-1].Time
+	summary := ReportSummary{
+		StartTime:     start,
+		EndTime:       end,
+		Duration:      end.Sub(start),
+		Layout:        layout,
+		Interpolation: InterpolateNone,
+	}
+	for n, state := range lastSeen {
+		stream := StreamSummary{
+			Name:     n,
+			Messages: int(state.Messages),
+			Bytes:    int64(state.Bytes),
+			FirstSeq: state.FirstSeq,
+			LastSeq:  state.LastSeq,
+		}
+		if summary.Duration > 0 {
+			stream.SeqRate = float64(published[n]) / summary.Duration.Seconds()
+		}
+		summary.Streams = append(summary.Streams, stream)
+		summary.TotalMsgs += stream.Messages
+		summary.TotalBytes += stream.Bytes
+		if state.LastSeq >= state.FirstSeq && state.FirstSeq > 0 {
+			summary.TotalSeqs += state.LastSeq - state.FirstSeq + 1
+		}
+	}
+	if len(summary.Streams) == 0 {
+		return nil, fmt.Errorf("no limits retention streams found in the sampled JetStream details")
+	}
+	sort.Slice(summary.Streams, func(i, j int) bool {
+		return summary.Streams[i].Messages > summary.Streams[j].Messages
+	})
+	summary.StreamCount = len(summary.Streams)
+	if summary.Duration > 0 {
+		summary.SeqRate = float64(hist.Stats.TotalMessages) / summary.Duration.Seconds()
+	}
+
+	analysis.Summary = summary
+	analysis.Histogram = hist
+	return analysis, nil
+}
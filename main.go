@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
-	"strings"
 	"time"
 
-	"github.com/choria-io/fisk"
+	"github.com/dustin/go-humanize"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 var (
@@ -16,22 +19,72 @@ var (
 )
 
 type Config struct {
+	Command         string
+	ConfigFile      string
+	Profile         string
 	Context         string
-	RateGranularity time.Duration
+	RateGranularity string
+	GranularitySet  bool // --granularity was given on the command line
+	Timezone        string
+	BucketLayout    BucketLayout
 	ShowGraph       bool
 	ShowRate        bool
 	ShowThroughput  bool
 	StreamNames     []string
 	BatchSize       int
+	Parallel        int
+	MaxInFlight     int
+	MaxMsgRate      float64
+	MaxByteRate     string
+	AdaptiveBatch   bool
+	TargetLatency   time.Duration
+	MinBatchSize    int
+	Retries         int
+	RetryBackoff    time.Duration
 	Limit           int
+	StartSeqs       []string
+	EndSeqs         []string
+	LastMsgs        []string
+	Selections      map[string]StreamSelection
+	PurgeMinGap     int
+	PurgeGaps       string
+	Interpolation   string
 	PerStream       bool
 	CSVFile         string
 	MinRatePct      float64
 	StartTime       string
 	EndTime         string
 	Since           time.Duration
+	Window          string
 	ShowProgress    bool
 	Distribution    bool
+	Seasonality     bool
+	Bursts          bool
+	BurstThreshold  string
+	SustainedWin    string
+	TopN            int
+	BurstOptions    BurstOptions
+	Anomalies       bool
+	AnomalyOptions  AnomalyOptions
+	IdleGaps        bool
+	IdleGapOptions  IdleGapOptions
+	InterArrival    bool
+	Sizes           bool
+	Forecast        bool
+	ForecastOptions ForecastOptions
+	Correlation     bool
+	CorrelationOpts CorrelationOptions
+	RulesFile       string
+	Publish         PublishOptions
+	AdvisoryStream  string
+	Backups         []string
+	JSZ             bool
+	JSZOptions      JSZOptions
+	CompareShift    time.Duration
+	CompareStart    string
+	CompareEnd      string
+	CompareSnaps    []string
+	SaveSnapshot    string
 	GUI             bool
 	GUIPort         int
 	GUIBrowser      bool
@@ -41,224 +94,506 @@ func main() {
 	cfg := parseFlags()
 
 	if err := run(cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		code := exitCode(err)
+		if code == 2 {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(code)
 	}
 }
 
-func parseFlags() Config {
-	cfg := Config{}
-
-	app := fisk.New("js-traffic-history", "Analyze stored message rates across NATS JetStream for accessible streams in the account (with limits retention policy)")
-	app.Version(version)
-	app.Author("JNM at Synadia")
-
-	app.Flag("context", "NATS context name (uses default if empty)").
-		Short('c').
-		StringVar(&cfg.Context)
+// exitCode returns the exit status for the error of a run: 2 when rules were violated,
+// 1 for any other error
+func exitCode(err error) int {
+	var violations *RuleViolationError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &violations):
+		return 2
+	}
+	return 1
+}
 
-	app.Flag("granularity", "Time bucket size for rate calculation").
-		Default("1s").
-		DurationVar(&cfg.RateGranularity)
+// Comparing reports whether a baseline to compare with was requested
+func (c Config) Comparing() bool {
+	return c.CompareShift > 0 || c.CompareStart != "" || len(c.CompareSnaps) > 0
+}
 
-	app.Flag("graph", "Display ASCII graph").
-		Short('g').
-		BoolVar(&cfg.ShowGraph)
+// sourceLabel names where the messages of the analysis come from
+func (c Config) sourceLabel() string {
+	if len(c.Backups) > 0 {
+		return "backup"
+	}
+	return "live"
+}
 
-	app.Flag("rate", "Show message rate graph and stats").
-		Default("true").
-		BoolVar(&cfg.ShowRate)
+// guiOptions returns the GUI options for an analysis, the forecast has a zero horizon
+// without --forecast
+func (c Config) guiOptions(combined *RateHistogram, summary *ReportSummary) GUIOptions {
+	opts := GUIOptions{
+		Port:        c.GUIPort,
+		OpenBrowser: c.GUIBrowser,
+		Combined:    combined,
+		Summary:     summary,
+		Anomalies:   c.AnomalyOptions,
+		Correlation: c.CorrelationOpts,
+	}
+	if c.Forecast {
+		opts.Forecast = c.ForecastOptions
+	}
+	return opts
+}
 
-	app.Flag("throughput", "Show throughput graph and stats").
-		Default("true").
-		BoolVar(&cfg.ShowThroughput)
+func run(cfg Config) error {
+	ctx := context.Background()
 
-	app.Flag("stream", "Analyze specific stream(s) (can be repeated)").
-		Short('s').
-		StringsVar(&cfg.StreamNames)
+	// Two snapshots are compared without connecting to NATS
+	if len(cfg.CompareSnaps) == 2 {
+		return runSnapshotComparison(cfg)
+	}
 
-	app.Flag("batch-size", "Messages per batch request").
-		Default("10000").
-		IntVar(&cfg.BatchSize)
+	// JSZ sampling reads no messages, only the servers' stream details
+	if cfg.JSZ {
+		return runJSZ(ctx, cfg)
+	}
 
-	app.Flag("limit", "Max messages to analyze per stream (0 = all)").
-		Short('l').
-		Default("0").
-		IntVar(&cfg.Limit)
+	// Load the rules up front, so a broken rules file fails before fetching
+	var rules []Rule
+	if cfg.RulesFile != "" {
+		var err error
+		rules, err = LoadRules(cfg.RulesFile, cfg.BucketLayout.location())
+		if err != nil {
+			return err
+		}
+	}
 
-	app.Flag("per-stream", "Also show stats and graphs for each individual stream").
-		Default("true").
-		BoolVar(&cfg.PerStream)
+	var js jetstream.JetStream
+	var err error
+	var source MessageSource
+	var streams []StreamInfo
+	var advisoryInfo *StreamInfo
+	if len(cfg.Backups) > 0 {
+		// Backups are read without connecting to NATS
+		backups, err := readBackups(cfg)
+		if err != nil {
+			return err
+		}
+		for _, b := range backups {
+			streams = append(streams, b.Info)
+		}
+		source = BackupSource(backups)
+	} else {
+		var nc *nats.Conn
+		nc, js, err = ConnectNATS(cfg.Context)
+		if err != nil {
+			return fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+		defer nc.Close()
+		source = func(ctx context.Context, si StreamInfo, opts FetchOptions) ([]MessageData, FetchCompleteness, error) {
+			return FetchStreamMessages(ctx, js, si, opts)
+		}
 
-	app.Flag("csv", "Export histogram data to CSV file").
-		StringVar(&cfg.CSVFile)
+		// Get streams with limits retention
+		if cfg.ShowProgress {
+			fmt.Println("Discovering streams with limits retention policy...")
+		}
 
-	app.Flag("min-rate-pct", "Skip graph buckets below this percentage of max rate").
-		Default("10").
-		Float64Var(&cfg.MinRatePct)
+		streams, err = GetLimitsStreams(ctx, js, cfg.StreamNames, cfg.ShowProgress)
+		if err != nil {
+			return fmt.Errorf("failed to get streams: %w", err)
+		}
 
-	app.Flag("start", "Start timestamp (RFC3339 or 2006-01-02 15:04:05)").
-		StringVar(&cfg.StartTime)
+		// The advisory stream is read for its advisories, not analysed with the other streams
+		if cfg.AdvisoryStream != "" {
+			advisoryInfo, streams, err = findAdvisoryStream(ctx, js, cfg.AdvisoryStream, streams)
+			if err != nil {
+				return err
+			}
+		}
 
-	app.Flag("end", "End timestamp (RFC3339 or 2006-01-02 15:04:05)").
-		StringVar(&cfg.EndTime)
+		if len(streams) == 0 {
+			fmt.Println("No streams with limits retention policy found.")
+			return nil
+		}
+	}
 
-	app.Flag("since", "Relative start time (e.g., 1h, 30m, 2h30m)").
-		DurationVar(&cfg.Since)
+	if cfg.ShowProgress {
+		fmt.Printf("Found %d stream(s) to analyze\n\n", len(streams))
+	}
 
-	app.Flag("progress", "Show progress during message fetching").
-		Default("true").
-		BoolVar(&cfg.ShowProgress)
+	for name := range cfg.Selections {
+		if name != "" && !slices.ContainsFunc(streams, func(si StreamInfo) bool { return si.Name == name }) {
+			fmt.Printf("Warning: stream %s selected with --start-seq, --end-seq or --last is not analyzed\n", name)
+		}
+	}
 
-	app.Flag("distribution", "Show message distribution over streams").
-		Default("true").
-		BoolVar(&cfg.Distribution)
+	// Find max last timestamp across all streams (for --since calculation)
+	var maxLastTimestamp time.Time
+	for _, si := range streams {
+		if si.LastTimestamp.After(maxLastTimestamp) {
+			maxLastTimestamp = si.LastTimestamp
+		}
+	}
 
-	app.Flag("gui", "Launch web-based interactive GUI").
-		BoolVar(&cfg.GUI)
+	// Parse time filters
+	startTime, endTime, err := timeFilter(cfg, maxLastTimestamp)
+	if err != nil {
+		return err
+	}
 
-	app.Flag("gui-port", "Port for web-based GUI server").
-		Default("8080").
-		IntVar(&cfg.GUIPort)
+	// Show time filter info
+	if startTime != nil || endTime != nil {
+		fmt.Print("Time filter: ")
+		if startTime != nil {
+			fmt.Printf("from %s ", startTime.In(cfg.BucketLayout.location()).Format("2006-01-02 15:04:05"))
+		}
+		if endTime != nil {
+			fmt.Printf("to %s", endTime.In(cfg.BucketLayout.location()).Format("2006-01-02 15:04:05"))
+		}
+		fmt.Println()
+	}
 
-	app.Flag("browser", "Auto-open browser when GUI starts").
-		Default("true").
-		BoolVar(&cfg.GUIBrowser)
+	// Fetch all messages from all streams
+	maxByteRate, _ := humanize.ParseBytes(cfg.MaxByteRate) // validated in parseFlags
+	throttle := NewFetchThrottle(ThrottleOptions{
+		MaxMsgRate:    cfg.MaxMsgRate,
+		MaxByteRate:   float64(maxByteRate),
+		Adaptive:      cfg.AdaptiveBatch,
+		TargetLatency: cfg.TargetLatency,
+		MinBatchSize:  cfg.MinBatchSize,
+		MaxBatchSize:  cfg.BatchSize,
+	})
+	fetchOpts := FetchOptions{
+		BatchSize:  cfg.BatchSize,
+		Limit:      cfg.Limit,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Selections: cfg.Selections,
+		Parallel:   cfg.Parallel,
+		InFlight:   NewRequestLimiter(cfg.MaxInFlight),
+		Throttle:   throttle,
+		Retry: RetryOptions{
+			MaxRetries: cfg.Retries,
+			Backoff:    cfg.RetryBackoff,
+			MaxBackoff: 30 * time.Second,
+		},
+	}
+	if cfg.ShowProgress {
+		fetchOpts.Progress = PrintProgress
+	}
 
-	app.MustParseWithUsage(os.Args[1:])
+	streamMessages, allMessages, completeness := fetchMessages(ctx, source, streams, fetchOpts, cfg)
 
-	if cfg.RateGranularity <= 0 {
-		fisk.Fatalf("--granularity must be positive")
+	// Build report summary and combined histogram
+	histOpts := HistogramOptions{
+		Layout:        cfg.BucketLayout,
+		ShowProgress:  cfg.ShowProgress,
+		Gaps:          NewGapOptions(streams, cfg.PurgeMinGap, PurgeGapMode(cfg.PurgeGaps)),
+		Interpolation: InterpolationStrategy(cfg.Interpolation),
+	}
+	summary, combinedHist := buildCombinedAnalysis(allMessages, streams, completeness, histOpts)
+	summary.WindowStart, summary.WindowEnd = startTime, endTime
+
+	// Inter-arrival times need the individual messages, so they are computed before the GUI frees them
+	if cfg.InterArrival || cfg.GUI {
+		if len(streamMessages) > 1 {
+			if stats := CalculateInterArrival("", allMessages); stats != nil {
+				summary.InterArrival = append(summary.InterArrival, stats)
+			}
+		}
+		for _, streamInfo := range streams {
+			if stats := CalculateInterArrival(streamInfo.Name, streamMessages[streamInfo.Name]); stats != nil {
+				summary.InterArrival = append(summary.InterArrival, stats)
+			}
+		}
 	}
 
-	if cfg.BatchSize <= 0 {
-		fisk.Fatalf("--batch-size must be positive")
+	var advisories []AdvisoryEvent
+	advisoriesRead := 0
+	if advisoryInfo != nil {
+		if cfg.ShowProgress {
+			fmt.Printf("Reading advisories from %s...\n", advisoryInfo.Name)
+		}
+		advisories, advisoriesRead, err = FetchAdvisories(ctx, js, *advisoryInfo, fetchOpts)
+		if err != nil {
+			return err
+		}
+		if advisories == nil {
+			advisories = []AdvisoryEvent{}
+		}
 	}
 
-	// Add .csv extension if missing
-	if cfg.CSVFile != "" && !strings.HasSuffix(strings.ToLower(cfg.CSVFile), ".csv") {
-		cfg.CSVFile += ".csv"
+	current := ComparisonSide{
+		Label:       cfg.sourceLabel(),
+		WindowStart: maxLastTimestamp,
+		WindowEnd:   maxLastTimestamp,
+		Summary:     summary,
+		Histogram:   combinedHist,
+	}
+	if startTime != nil {
+		current.WindowStart = *startTime
+	} else if combinedHist != nil {
+		current.WindowStart = combinedHist.Buckets[0].Start
+	}
+	if endTime != nil {
+		current.WindowEnd = *endTime
+	} else if cfg.Selections != nil && combinedHist != nil {
+		// Selected sequences may end well before the newest message
+		current.WindowEnd = combinedHist.Buckets[len(combinedHist.Buckets)-1].End
 	}
 
-	return cfg
-}
+	switch cfg.Command {
+	case cmdSnapshot:
+		if err := SaveSnapshot(cfg.SaveSnapshot, cfg, current); err != nil {
+			return fmt.Errorf("failed to save snapshot: %w", err)
+		}
+		fmt.Printf("Snapshot saved to %s\n", cfg.SaveSnapshot)
+		PrintFetchLoad(throttle.Load())
+		return nil
 
-// parseTimestamp parses a timestamp string in various formats
-func parseTimestamp(s string) (time.Time, error) {
-	formats := []string{
-		time.RFC3339,
-		"2006-01-02 15:04:05",
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04",
-		"2006-01-02",
+	case cmdExport:
+		if cfg.CSVFile != "" {
+			names := make([]string, 0, len(streams))
+			for _, streamInfo := range streams {
+				names = append(names, streamInfo.Name)
+			}
+			err := exportCSV(cfg.CSVFile, names, func(name string) *RateHistogram {
+				if len(streamMessages[name]) == 0 {
+					return nil
+				}
+				return BuildRateHistogram(name, streamMessages[name], histOpts)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if cfg.Publish.Stream != "" || cfg.Publish.KV != "" {
+			if err := PublishAnalysis(ctx, js, cfg.Publish, current); err != nil {
+				return fmt.Errorf("failed to publish analysis: %w", err)
+			}
+			fmt.Printf("Analysis published under %s\n", cfg.Publish.Prefix)
+		}
+		PrintFetchLoad(throttle.Load())
+		return nil
 	}
-	for _, format := range formats {
-		if t, err := time.Parse(format, s); err == nil {
-			return t, nil
+
+	var comparison *Comparison
+	if cfg.Comparing() {
+		// Free the current messages before fetching the baseline, only the histogram is compared
+		allMessages = nil
+		streamMessages = nil
+		baseline, err := loadBaseline(ctx, source, streams, fetchOpts, histOpts, cfg, current)
+		if err != nil {
+			return err
 		}
+		comparison = NewComparison(baseline, current)
 	}
-	return time.Time{}, fmt.Errorf("unable to parse timestamp %q (use RFC3339 or 2006-01-02 15:04:05 format)", s)
-}
 
-func run(cfg Config) error {
-	ctx := context.Background()
+	// GUI mode: start web server (uses combined histogram only, derives per-stream data on-demand)
+	if cfg.GUI {
+		// Clear message data to free memory - GUI derives per-stream data from combined histogram
+		allMessages = nil
+		streamMessages = nil
+		PrintFetchLoad(throttle.Load())
+		opts := cfg.guiOptions(combinedHist, &summary)
+		opts.Comparison = comparison
+		opts.Advisories = advisories
+		return StartGUIServer(opts)
+	}
 
-	nc, js, err := ConnectNATS(cfg.Context)
-	if err != nil {
-		return fmt.Errorf("failed to connect to NATS: %w", err)
+	if comparison != nil {
+		PrintComparison(comparison, cfg.PerStream, cfg.BucketLayout.location())
+		PrintFetchLoad(throttle.Load())
+		return nil
 	}
-	defer nc.Close()
 
-	// Get streams with limits retention
-	if cfg.ShowProgress {
-		fmt.Println("Discovering streams with limits retention policy...")
+	// Build per-stream histograms for CLI mode (no per-stream tracking needed since each is a single stream)
+	streamHistograms := make(map[string]*RateHistogram)
+	for _, streamInfo := range streams {
+		messages, ok := streamMessages[streamInfo.Name]
+		if !ok || len(messages) == 0 {
+			continue
+		}
+		streamHistograms[streamInfo.Name] = BuildRateHistogram(streamInfo.Name, messages, histOpts)
 	}
 
-	streams, err := GetLimitsStreams(ctx, js, cfg.StreamNames, cfg.ShowProgress)
-	if err != nil {
-		return fmt.Errorf("failed to get streams: %w", err)
+	// CLI mode: print to terminal
+	graphOpts := GraphOptions{
+		ShowGraph:      cfg.ShowGraph,
+		ShowRate:       cfg.ShowRate,
+		ShowThroughput: cfg.ShowThroughput,
+		MinRatePct:     cfg.MinRatePct,
 	}
 
-	if len(streams) == 0 {
-		fmt.Println("No streams with limits retention policy found.")
-		return nil
+	// Print report summary with stats
+	if combinedHist != nil {
+		PrintReportSummary(summary, &combinedHist.Stats, cfg.Distribution)
+		printAnalyses(combinedHist, cfg)
+		if cfg.Correlation {
+			PrintCorrelation(BuildCorrelation(combinedHist, cfg.CorrelationOpts), cfg.CorrelationOpts, cfg.TopN)
+		}
+		if advisoryInfo != nil {
+			PrintAdvisories(BuildAdvisoryAnalysis(advisories, combinedHist), advisoryInfo.Name, advisoriesRead, cfg.BucketLayout.location())
+		}
+	} else {
+		PrintReportSummary(summary, nil, cfg.Distribution)
 	}
 
-	if cfg.ShowProgress {
-		fmt.Printf("Found %d stream(s) to analyze\n\n", len(streams))
+	if cfg.IdleGaps {
+		idleOpts := cfg.IdleGapOptions
+		idleOpts.WindowStart, idleOpts.WindowEnd = idleWindow(startTime, endTime, cfg)
+		var reports []*IdleGapReport
+		for _, streamInfo := range streams {
+			messages := streamMessages[streamInfo.Name]
+			deleteGaps := findDeleteGaps(messages, histOpts.Gaps)
+			if report := FindIdleGaps(streamInfo.Name, messages, deleteGaps, idleOpts); report != nil {
+				reports = append(reports, report)
+			}
+		}
+		PrintIdleGaps(reports, cfg.BucketLayout.location())
 	}
 
-	// Find max last timestamp across all streams (for --since calculation)
-	var maxLastTimestamp time.Time
-	for _, si := range streams {
-		if si.LastTimestamp.After(maxLastTimestamp) {
-			maxLastTimestamp = si.LastTimestamp
+	if cfg.InterArrival {
+		PrintInterArrival(summary.InterArrival)
+	}
+
+	// Show per-stream analysis if requested
+	if cfg.PerStream {
+		for _, streamInfo := range streams {
+			hist, ok := streamHistograms[streamInfo.Name]
+			if !ok {
+				continue
+			}
+
+			messages := streamMessages[streamInfo.Name]
+			PrintStreamHeader(streamInfo.Name, len(messages))
+			PrintRateHistogram(hist, graphOpts)
+			printAnalyses(hist, cfg)
+			fmt.Println()
 		}
 	}
 
-	// Parse time filters
-	var startTime, endTime *time.Time
-	if cfg.Since > 0 {
-		if cfg.StartTime != "" {
-			return fmt.Errorf("cannot use both --since and --start")
+	var violations int
+	if rules != nil {
+		windowStart, windowEnd := idleWindow(startTime, endTime, cfg)
+		combined := RuleTarget{Messages: allMessages, WindowStart: windowStart, WindowEnd: windowEnd}
+		if combinedHist != nil {
+			combined.Stats = combinedHist.Stats
 		}
-		// Use max last timestamp as reference instead of Now()
-		t := maxLastTimestamp.Add(-cfg.Since)
-		startTime = &t
-	} else if cfg.StartTime != "" {
-		t, err := parseTimestamp(cfg.StartTime)
-		if err != nil {
-			return err
+		var targets []RuleTarget
+		for _, streamInfo := range streams {
+			target := RuleTarget{Name: streamInfo.Name, Messages: streamMessages[streamInfo.Name], WindowStart: windowStart, WindowEnd: windowEnd}
+			if hist, ok := streamHistograms[streamInfo.Name]; ok {
+				target.Stats = hist.Stats
+			}
+			targets = append(targets, target)
 		}
-		startTime = &t
-	}
-	if cfg.EndTime != "" {
-		t, err := parseTimestamp(cfg.EndTime)
-		if err != nil {
-			return err
+		results := EvaluateRules(rules, combined, targets)
+		PrintRuleResults(results, cfg.BucketLayout.location())
+		for _, r := range results {
+			if r.Violated {
+				violations++
+			}
 		}
-		endTime = &t
 	}
 
-	// Show time filter info
-	if startTime != nil || endTime != nil {
-		fmt.Print("Time filter: ")
-		if startTime != nil {
-			fmt.Printf("from %s ", startTime.Format("2006-01-02 15:04:05"))
+	PrintFetchLoad(throttle.Load())
+
+	if violations > 0 {
+		return &RuleViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// exportCSV writes the histograms of the streams into one CSV file, skipping the streams
+// without a histogram
+func exportCSV(filename string, names []string, histogram func(name string) *RateHistogram) error {
+	written := 0
+	for _, name := range names {
+		hist := histogram(name)
+		if hist == nil {
+			continue
 		}
-		if endTime != nil {
-			fmt.Printf("to %s", endTime.Format("2006-01-02 15:04:05"))
+		write := AppendCSV
+		if written == 0 {
+			write = WriteCSV
 		}
-		fmt.Println()
+		if err := write(filename, hist, name); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+		written++
 	}
+	if written > 0 {
+		fmt.Printf("CSV data exported to %s\n", filename)
+	}
+	return nil
+}
 
-	// Collect all messages for combined analysis
-	var allMessages []MessageData
+// findAdvisoryStream returns the advisory stream and the other streams to analyse, looking
+// the advisory stream up when the stream filters left it out
+func findAdvisoryStream(ctx context.Context, js jetstream.JetStream, name string, streams []StreamInfo) (*StreamInfo, []StreamInfo, error) {
+	for i, si := range streams {
+		if si.Name == name {
+			return &si, slices.Delete(slices.Clone(streams), i, i+1), nil
+		}
+	}
+	found, err := GetLimitsStreams(ctx, js, []string{name}, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get advisory stream %s: %w", name, err)
+	}
+	if len(found) == 0 {
+		return nil, nil, fmt.Errorf("advisory stream %s not found, empty or not a limits stream", name)
+	}
+	return &found[0], streams, nil
+}
 
-	// First pass: fetch all messages from all streams
+// printAnalyses prints the optional analyses of a combined or per-stream histogram
+func printAnalyses(hist *RateHistogram, cfg Config) {
+	if cfg.Seasonality {
+		PrintSeasonality(BuildSeasonality(hist), hist.Layout)
+	}
+	if cfg.Bursts {
+		PrintBursts(DetectBursts(hist, cfg.BurstOptions))
+	}
+	if cfg.Anomalies {
+		PrintAnomalies(DetectAnomalies(hist, cfg.AnomalyOptions), cfg.AnomalyOptions)
+	}
+	if cfg.Sizes {
+		PrintSizeDistribution(hist)
+	}
+	if cfg.Forecast {
+		PrintForecast(BuildForecast(hist, cfg.ForecastOptions), cfg.ForecastOptions, hist.Layout.location())
+	}
+}
+
+// fetchMessages fetches the messages of all streams, sorted by timestamp per stream and
+// all together
+func fetchMessages(ctx context.Context, source MessageSource, streams []StreamInfo, fetchOpts FetchOptions, cfg Config) (map[string][]MessageData, []MessageData, []FetchCompleteness) {
+	var allMessages []MessageData
 	streamMessages := make(map[string][]MessageData)
+	var completeness []FetchCompleteness
 	for _, streamInfo := range streams {
 		if cfg.ShowProgress {
 			fmt.Printf("Fetching messages from stream: %s (up to %d messages)\n", streamInfo.Name, streamInfo.MsgCount)
 		}
 
-		var messages []MessageData
-
+		fetchStart := time.Now()
+		messages, fc, err := source(ctx, streamInfo, fetchOpts)
 		if cfg.ShowProgress {
-			messages, err = FetchStreamMessages(ctx, js, streamInfo, cfg.BatchSize, cfg.Limit, startTime, endTime, PrintProgress)
 			ClearProgress()
-
-		} else {
-			messages, err = FetchStreamMessages(ctx, js, streamInfo, cfg.BatchSize, cfg.Limit, startTime, endTime, nil)
 		}
+		completeness = append(completeness, fc)
 		if err != nil {
-			fmt.Printf("Warning: failed to fetch messages from %s: %v\n", streamInfo.Name, err)
-			continue
+			// Keep whatever could be fetched, the report flags the stream as partial
+			fmt.Printf("Warning: failed to fetch all messages from %s (%d fetched, %d missing): %v\n", streamInfo.Name, fc.Fetched, fc.Missing, err)
 		}
 
 		if len(messages) == 0 {
 			if cfg.ShowProgress {
-				if startTime != nil || endTime != nil {
+				if fetchOpts.StartTime != nil || fetchOpts.EndTime != nil {
 					fmt.Printf("Stream %s has no messages in the specified time range\n", streamInfo.Name)
 				} else {
 					fmt.Printf("Stream %s has no messages to analyze\n\n", streamInfo.Name)
@@ -267,6 +602,10 @@ func run(cfg Config) error {
 			continue
 		}
 
+		if cfg.ShowProgress {
+			fmt.Printf("Fetched %d messages from %s in %s\n", len(messages), streamInfo.Name, formatDuration(time.Since(fetchStart)))
+		}
+
 		// Sort messages by timestamp for proper analysis
 		sort.Slice(messages, func(i, j int) bool {
 			return messages[i].Timestamp.Before(messages[j].Timestamp)
@@ -281,32 +620,229 @@ func run(cfg Config) error {
 		return allMessages[i].Timestamp.Before(allMessages[j].Timestamp)
 	})
 
-	// Build report summary and combined histogram
+	return streamMessages, allMessages, completeness
+}
+
+// buildCombinedAnalysis builds the report summary and the combined histogram, with the
+// per-stream breakdown, of messages sorted by timestamp
+func buildCombinedAnalysis(allMessages []MessageData, streams []StreamInfo, completeness []FetchCompleteness, histOpts HistogramOptions) (ReportSummary, *RateHistogram) {
 	summary := BuildReportSummary(allMessages, len(streams))
+	summary.StartTime = summary.StartTime.In(histOpts.Layout.location())
+	summary.EndTime = summary.EndTime.In(histOpts.Layout.location())
+	summary.Layout = histOpts.Layout
+	summary.Fetch = completeness
+
 	var combinedHist *RateHistogram
 	if len(allMessages) > 0 {
-		combinedHist = BuildRateHistogram("combined", allMessages, cfg.RateGranularity, cfg.ShowProgress, true)
+		combinedOpts := histOpts
+		combinedOpts.TrackPerStream = true
+		combinedHist = BuildRateHistogram("combined", allMessages, combinedOpts)
+		summary.Deletes = combinedHist.Deletes
+		summary.PurgeGaps = histOpts.Gaps.PurgeMode
+		summary.Interpolation = histOpts.Interpolation
 	}
 
-	// GUI mode: start web server (uses combined histogram only, derives per-stream data on-demand)
-	if cfg.GUI {
-		// Clear message data to free memory - GUI derives per-stream data from combined histogram
-		allMessages = nil
-		streamMessages = nil
-		return StartGUIServer(cfg.GUIPort, cfg.GUIBrowser, combinedHist, nil, &summary)
+	return summary, combinedHist
+}
+
+// loadBaseline loads the baseline of a comparison: a snapshot, or the messages of an
+// earlier window of the same length as the current one
+func loadBaseline(ctx context.Context, source MessageSource, streams []StreamInfo, fetchOpts FetchOptions, histOpts HistogramOptions, cfg Config, current ComparisonSide) (ComparisonSide, error) {
+	if len(cfg.CompareSnaps) > 0 {
+		baseline, layout, err := LoadSnapshot(cfg.CompareSnaps[0])
+		if err != nil {
+			return baseline, err
+		}
+		if !sameLayout(layout, cfg.BucketLayout) {
+			return baseline, fmt.Errorf("snapshot %s has %s buckets, the current analysis %s", cfg.CompareSnaps[0], layout, cfg.BucketLayout)
+		}
+		return baseline, nil
 	}
 
-	// Build per-stream histograms for CLI mode (no per-stream tracking needed since each is a single stream)
-	streamHistograms := make(map[string]*RateHistogram)
-	for _, streamInfo := range streams {
-		messages, ok := streamMessages[streamInfo.Name]
-		if !ok || len(messages) == 0 {
+	baseline := ComparisonSide{Label: cfg.sourceLabel()}
+	length := current.WindowEnd.Sub(current.WindowStart)
+	if cfg.CompareShift > 0 {
+		baseline.Label = fmt.Sprintf("%s, %s earlier", cfg.sourceLabel(), shortDuration(cfg.CompareShift))
+		baseline.WindowStart = current.WindowStart.Add(-cfg.CompareShift)
+		baseline.WindowEnd = current.WindowEnd.Add(-cfg.CompareShift)
+	} else {
+		t, err := parseTimestamp(cfg.CompareStart, cfg.BucketLayout.location())
+		if err != nil {
+			return baseline, err
+		}
+		baseline.WindowStart = t
+		baseline.WindowEnd = t.Add(length)
+		if cfg.CompareEnd != "" {
+			if baseline.WindowEnd, err = parseTimestamp(cfg.CompareEnd, cfg.BucketLayout.location()); err != nil {
+				return baseline, err
+			}
+		}
+	}
+	if !baseline.WindowEnd.After(baseline.WindowStart) {
+		return baseline, fmt.Errorf("the baseline window must end after it starts")
+	}
+
+	fmt.Printf("Baseline window: from %s to %s\n",
+		baseline.WindowStart.In(cfg.BucketLayout.location()).Format("2006-01-02 15:04:05"),
+		baseline.WindowEnd.In(cfg.BucketLayout.location()).Format("2006-01-02 15:04:05"))
+
+	// The baseline is a time window, the sequences selected for the current one do not apply
+	fetchOpts.StartTime = &baseline.WindowStart
+	fetchOpts.EndTime = &baseline.WindowEnd
+	fetchOpts.Selections = nil
+	_, allMessages, completeness := fetchMessages(ctx, source, streams, fetchOpts, cfg)
+	baseline.Summary, baseline.Histogram = buildCombinedAnalysis(allMessages, streams, completeness, histOpts)
+
+	return baseline, nil
+}
+
+// timeFilter returns the start and end of the time window to analyze, nil when open
+// --since is relative to the newest message rather than now, so that old data and
+// backups can be analyzed the same way as live streams.
+func timeFilter(cfg Config, newest time.Time) (start, end *time.Time, err error) {
+	loc := cfg.BucketLayout.location()
+	now := time.Now()
+	if cfg.Window != "" {
+		s, e, err := parseTimeRangeAt(cfg.Window, loc, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &s, &e, nil
+	}
+
+	if cfg.Since > 0 {
+		t := newest.Add(-cfg.Since)
+		start = &t
+	} else if cfg.StartTime != "" {
+		t, err := parseTimestampAt(cfg.StartTime, loc, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		start = &t
+	}
+	if cfg.EndTime != "" {
+		t, err := parseTimestampAt(cfg.EndTime, loc, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		end = &t
+	}
+	if start != nil && end != nil && !end.After(*start) {
+		return nil, nil, fmt.Errorf("the time window must end after it starts")
+	}
+	return start, end, nil
+}
+
+// idleWindow returns the bounds idle time is measured within, zero when open. An open
+// end is now, except for backups as they were taken earlier.
+func idleWindow(startTime, endTime *time.Time, cfg Config) (start, end time.Time) {
+	if startTime != nil {
+		start = *startTime
+	}
+	now := time.Now()
+	switch {
+	case endTime != nil && endTime.Before(now):
+		end = *endTime
+	case endTime != nil || len(cfg.Backups) == 0:
+		end = now
+	}
+	return start, end
+}
+
+// readBackups reads the streams of all backups, keeping those matching the stream filters
+func readBackups(cfg Config) ([]*Backup, error) {
+	var backups []*Backup
+	for _, p := range cfg.Backups {
+		if cfg.ShowProgress {
+			fmt.Printf("Reading backup %s...\n", p)
+		}
+		b, err := ReadBackup(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(cfg.StreamNames) > 0 && !slices.Contains(cfg.StreamNames, b.Info.Name) {
 			continue
 		}
-		streamHistograms[streamInfo.Name] = BuildRateHistogram(streamInfo.Name, messages, cfg.RateGranularity, cfg.ShowProgress, false)
+		if slices.ContainsFunc(backups, func(o *Backup) bool { return o.Info.Name == b.Info.Name }) {
+			return nil, fmt.Errorf("stream %s is in more than one backup", b.Info.Name)
+		}
+		if cfg.ShowProgress {
+			fmt.Printf("Read %s messages of stream %s from a %s\n", humanize.Comma(int64(len(b.Messages))), b.Info.Name, b.Format)
+		}
+		if len(b.Messages) == 0 {
+			fmt.Printf("Backup %s of stream %s has no messages\n", p, b.Info.Name)
+			continue
+		}
+		backups = append(backups, b)
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("no backup with messages of the requested streams")
+	}
+	return backups, nil
+}
+
+// runSnapshotComparison compares two saved snapshots, the first as baseline
+func runSnapshotComparison(cfg Config) error {
+	baseline, baseLayout, err := LoadSnapshot(cfg.CompareSnaps[0])
+	if err != nil {
+		return err
+	}
+	current, layout, err := LoadSnapshot(cfg.CompareSnaps[1])
+	if err != nil {
+		return err
+	}
+	if !sameLayout(baseLayout, layout) {
+		return fmt.Errorf("snapshot %s has %s buckets, snapshot %s %s", cfg.CompareSnaps[0], baseLayout, cfg.CompareSnaps[1], layout)
+	}
+
+	comparison := NewComparison(baseline, current)
+	if cfg.GUI {
+		opts := cfg.guiOptions(current.Histogram, &current.Summary)
+		opts.Comparison = comparison
+		return StartGUIServer(opts)
+	}
+	PrintComparison(comparison, cfg.PerStream, layout.location())
+	return nil
+}
+
+// runJSZ samples the JetStream details of all servers and shows the traffic derived from
+// them, with the stored messages and bytes per server and replica
+func runJSZ(ctx context.Context, cfg Config) error {
+	nc, _, err := ConnectNATS(cfg.JSZOptions.Context)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	defer nc.Close()
+
+	if cfg.ShowProgress {
+		fmt.Printf("Sampling %s every %s for %s...\n", jszPingSubject, cfg.JSZOptions.Interval, cfg.JSZOptions.Duration)
+	}
+	rounds, err := CollectJSZ(ctx, nc, cfg.JSZOptions, cfg.ShowProgress)
+	if err != nil {
+		return err
+	}
+
+	layout := BucketLayout{Duration: cfg.JSZOptions.Interval, Location: cfg.BucketLayout.Location}
+	analysis, err := BuildJSZAnalysis(rounds, cfg.StreamNames, layout)
+	if err != nil {
+		return err
+	}
+	hist := analysis.Histogram
+
+	if cfg.GUI {
+		return StartGUIServer(cfg.guiOptions(hist, &analysis.Summary))
+	}
+
+	if cfg.Command == cmdExport {
+		names := make([]string, 0, len(analysis.Summary.Streams))
+		for _, stream := range analysis.Summary.Streams {
+			names = append(names, stream.Name)
+		}
+		return exportCSV(cfg.CSVFile, names, func(name string) *RateHistogram {
+			return extractStreamHistogram(hist, name)
+		})
 	}
 
-	// CLI mode: print to terminal
 	graphOpts := GraphOptions{
 		ShowGraph:      cfg.ShowGraph,
 		ShowRate:       cfg.ShowRate,
@@ -314,44 +850,22 @@ func run(cfg Config) error {
 		MinRatePct:     cfg.MinRatePct,
 	}
 
-	// Print report summary with stats
-	if combinedHist != nil {
-		PrintReportSummary(summary, &combinedHist.Stats, cfg.Distribution)
-	} else {
-		PrintReportSummary(summary, nil, cfg.Distribution)
+	PrintReportSummary(analysis.Summary, &hist.Stats, cfg.Distribution)
+	printAnalyses(hist, cfg)
+	if cfg.Correlation {
+		PrintCorrelation(BuildCorrelation(hist, cfg.CorrelationOpts), cfg.CorrelationOpts, cfg.TopN)
 	}
+	PrintJSZReplicas(analysis)
 
-	// Show per-stream analysis if requested
 	if cfg.PerStream {
-		csvFirstWrite := true
-		for _, streamInfo := range streams {
-			hist, ok := streamHistograms[streamInfo.Name]
-			if !ok {
+		for _, stream := range analysis.Summary.Streams {
+			streamHist := extractStreamHistogram(hist, stream.Name)
+			if streamHist == nil {
 				continue
 			}
-
-			messages := streamMessages[streamInfo.Name]
-			PrintStreamHeader(streamInfo.Name, len(messages))
-			PrintRateHistogram(hist, graphOpts)
-
-			// Write per-stream data to CSV if requested
-			if cfg.CSVFile != "" {
-				if csvFirstWrite {
-					if err := WriteCSV(cfg.CSVFile, hist, streamInfo.Name); err != nil {
-						return fmt.Errorf("failed to write CSV: %w", err)
-					}
-					csvFirstWrite = false
-				} else {
-					if err := AppendCSV(cfg.CSVFile, hist, streamInfo.Name); err != nil {
-						return fmt.Errorf("failed to append to CSV: %w", err)
-					}
-				}
-			}
-
-			fmt.Println()
-		}
-		if cfg.CSVFile != "" && !csvFirstWrite {
-			fmt.Printf("CSV data exported to %s\n", cfg.CSVFile)
+			PrintStreamHeader(stream.Name, stream.Messages)
+			PrintRateHistogram(streamHist, graphOpts)
+			printAnalyses(streamHist, cfg)
 		}
 	}
 
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// publishSchemaVersion is the version of the published JSON records, raised on incompatible
+// changes. Consumers should check the schema and version before reading a record.
+const publishSchemaVersion = 1
+
+const (
+	// publishReportSchema identifies the record of all streams combined
+	publishReportSchema = "js-traffic-history.report"
+	// publishStreamSchema identifies the record of one stream
+	publishStreamSchema = "js-traffic-history.stream"
+)
+
+// PublishOptions controls where the analysis is published
+type PublishOptions struct {
+	Stream     string // JetStream stream to publish into, created if missing, empty for none
+	KV         string // KV bucket to put into, created if missing, empty for none
+	Prefix     string // subject prefix, records go to <prefix>.summary and <prefix>.stream.<name>
+	MaxBuckets int    // bucket series are averaged down to at most this many buckets
+}
+
+// PublishedReport is the record of all streams combined, on <prefix>.summary or key summary
+type PublishedReport struct {
+	Schema      string        `json:"schema"`
+	Version     int           `json:"version"`
+	Created     time.Time     `json:"created"`
+	WindowStart time.Time     `json:"window_start"`
+	WindowEnd   time.Time     `json:"window_end"`
+	Summary     JSONSummary   `json:"summary"`
+	Histogram   JSONHistogram `json:"histogram"` // without the per-stream breakdown
+}
+
+// PublishedStream is the record of one stream, on <prefix>.stream.<name> or key stream.<name>
+type PublishedStream struct {
+	Schema      string            `json:"schema"`
+	Version     int               `json:"version"`
+	Created     time.Time         `json:"created"`
+	WindowStart time.Time         `json:"window_start"`
+	WindowEnd   time.Time         `json:"window_end"`
+	Granularity string            `json:"granularity"`
+	Timezone    string            `json:"timezone"`
+	Stream      JSONStreamSummary `json:"stream"`
+	Histogram   JSONHistogram     `json:"histogram"`
+}
+
+// publishRecord is an encoded record with the subject token it is published under
+type publishRecord struct {
+	Key  string // summary or stream.<name>, appended to the prefix for subjects
+	Data []byte
+}
+
+// PublishAnalysis publishes the report summary and the statistics and bucket series of
+// every stream as JSON records into a JetStream stream, a KV bucket or both
+func PublishAnalysis(ctx context.Context, js jetstream.JetStream, opts PublishOptions, side ComparisonSide) error {
+	records, err := encodePublishRecords(side, opts.MaxBuckets)
+	if err != nil {
+		return err
+	}
+
+	maxPayload := js.Conn().MaxPayload()
+	for _, r := range records {
+		if int64(len(r.Data)) > maxPayload {
+			return fmt.Errorf("record %s is %s, above the server's max payload of %s, lower --publish-max-buckets",
+				r.Key, formatBytes(int64(len(r.Data))), formatBytes(maxPayload))
+		}
+	}
+
+	if opts.Stream != "" {
+		if err := ensurePublishStream(ctx, js, opts); err != nil {
+			return err
+		}
+		for _, r := range records {
+			subject := opts.Prefix + "." + r.Key
+			if _, err := js.Publish(ctx, subject, r.Data); err != nil {
+				return fmt.Errorf("failed to publish %s: %w", subject, err)
+			}
+		}
+	}
+
+	if opts.KV != "" {
+		kv, err := js.KeyValue(ctx, opts.KV)
+		if errors.Is(err, jetstream.ErrBucketNotFound) {
+			kv, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{
+				Bucket:      opts.KV,
+				Description: "js-traffic-history analyses",
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open KV bucket %s: %w", opts.KV, err)
+		}
+		for _, r := range records {
+			if _, err := kv.Put(ctx, r.Key, r.Data); err != nil {
+				return fmt.Errorf("failed to put %s into %s: %w", r.Key, opts.KV, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ensurePublishStream creates the stream to publish into if it does not exist. An existing
+// stream must already listen on the prefix.
+func ensurePublishStream(ctx context.Context, js jetstream.JetStream, opts PublishOptions) error {
+	_, err := js.Stream(ctx, opts.Stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:        opts.Stream,
+			Description: "js-traffic-history analyses",
+			Subjects:    []string{opts.Prefix + ".>"},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open stream %s: %w", opts.Stream, err)
+	}
+	return nil
+}
+
+// encodePublishRecords encodes the combined record and one record per stream, with the
+// bucket series averaged down to at most maxBuckets
+func encodePublishRecords(side ComparisonSide, maxBuckets int) ([]publishRecord, error) {
+	created := time.Now().UTC()
+	summary := convertSummary(&side.Summary)
+
+	combined := convertHistogram(downsampleHistogram(side.Histogram, maxBuckets, true))
+	for i := range combined.Buckets {
+		combined.Buckets[i].PerStream = nil
+	}
+	report := PublishedReport{
+		Schema:      publishReportSchema,
+		Version:     publishSchemaVersion,
+		Created:     created,
+		WindowStart: side.WindowStart,
+		WindowEnd:   side.WindowEnd,
+		Summary:     summary,
+		Histogram:   combined,
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report: %w", err)
+	}
+	records := []publishRecord{{Key: "summary", Data: data}}
+
+	for _, stream := range summary.Streams {
+		hist := extractStreamHistogram(side.Histogram, stream.Name)
+		if hist == nil {
+			continue
+		}
+		record := PublishedStream{
+			Schema:      publishStreamSchema,
+			Version:     publishSchemaVersion,
+			Created:     created,
+			WindowStart: side.WindowStart,
+			WindowEnd:   side.WindowEnd,
+			Granularity: summary.Granularity,
+			Timezone:    summary.Timezone,
+			Stream:      stream,
+			Histogram:   convertHistogram(downsampleHistogram(hist, maxBuckets, true)),
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode stream %s: %w", stream.Name, err)
+		}
+		records = append(records, publishRecord{Key: "stream." + stream.Name, Data: data})
+	}
+
+	return records, nil
+}
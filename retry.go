@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/orbit.go/jetstreamext"
+)
+
+// FetchErrorClass categorizes errors encountered while fetching messages
+type FetchErrorClass string
+
+const (
+	ErrClassTimeout      FetchErrorClass = "timeout"
+	ErrClassNoResponders FetchErrorClass = "no responders"
+	ErrClassReconnecting FetchErrorClass = "reconnecting"
+	ErrClassNoMessages   FetchErrorClass = "no messages"
+	ErrClassStreamGone   FetchErrorClass = "stream gone"
+	ErrClassCanceled     FetchErrorClass = "canceled"
+	ErrClassOther        FetchErrorClass = "other"
+)
+
+// errBatchTimeout is reported when a batch request ends without any response,
+// the batch iterator silently stops on timeouts instead of returning an error
+var errBatchTimeout = errors.New("batch request timed out without a response")
+
+// classifyFetchError maps an error returned by GetBatch (or its iterator) to a class
+func classifyFetchError(err error) FetchErrorClass {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrClassCanceled
+	case errors.Is(err, errBatchTimeout), errors.Is(err, nats.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrClassTimeout
+	case errors.Is(err, jetstreamext.ErrNoMessages), errors.Is(err, jetstream.ErrMsgNotFound):
+		return ErrClassNoMessages
+	case errors.Is(err, jetstream.ErrStreamNotFound):
+		return ErrClassStreamGone
+	case errors.Is(err, nats.ErrNoResponders), errors.Is(err, jetstreamext.ErrBatchUnsupported):
+		// A no responders status reply has no Nats-Num-Pending header, so the batch
+		// iterator reports it as unsupported batch get
+		return ErrClassNoResponders
+	case errors.Is(err, nats.ErrConnectionReconnecting), errors.Is(err, nats.ErrSlowConsumer):
+		return ErrClassReconnecting
+	default:
+		return ErrClassOther
+	}
+}
+
+// transient reports whether errors of this class are worth retrying, unknown errors such as
+// invalid options or responses are not
+func (c FetchErrorClass) transient() bool {
+	return c == ErrClassTimeout || c == ErrClassNoResponders || c == ErrClassReconnecting
+}
+
+// RetryOptions controls how failed batch requests are retried
+type RetryOptions struct {
+	MaxRetries int           // retries per request before giving up on the rest of the range
+	Backoff    time.Duration // initial backoff, doubled on every retry
+	MaxBackoff time.Duration // upper bound for the backoff
+}
+
+// backoff returns the delay before the given retry attempt (0-based)
+func (o RetryOptions) backoff(attempt int) time.Duration {
+	d := o.Backoff
+	for i := 0; i < attempt && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if o.MaxBackoff > 0 && d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+// FetchCompleteness records how completely a stream's requested sequence range was fetched,
+// distinguishing gaps caused by fetch errors from genuinely deleted messages
+type FetchCompleteness struct {
+	StreamName string
+	FirstSeq   uint64 // first sequence of the requested range
+	LastSeq    uint64 // last sequence of the requested range
+	Fetched    int    // messages fetched
+	Deleted    uint64 // sequences between fetched messages with no stored message (genuine deletes)
+	ErrorGaps  []seqRange
+	Missing    uint64 // sequences not fetched because of errors
+	Retries    int
+	Errors     map[FetchErrorClass]int
+	Fatal      string // error that stopped the fetch, if any
+}
+
+// Complete reports whether the whole requested range was fetched
+func (c FetchCompleteness) Complete() bool {
+	return len(c.ErrorGaps) == 0 && c.Fatal == ""
+}
+
+// fetchTracker accumulates retries, errors and error gaps from concurrent chunk fetchers
+type fetchTracker struct {
+	js         jetstream.JetStream
+	streamName string
+	retry      RetryOptions
+
+	mu         sync.Mutex
+	retries    int
+	errors     map[FetchErrorClass]int
+	errorGaps  []seqRange
+	fatal      error
+	streamGone bool
+}
+
+// newFetchTracker creates a tracker for a stream fetch
+func newFetchTracker(js jetstream.JetStream, streamName string, retry RetryOptions) *fetchTracker {
+	return &fetchTracker{
+		js:         js,
+		streamName: streamName,
+		retry:      retry,
+		errors:     make(map[FetchErrorClass]int),
+	}
+}
+
+// shouldRetry records a failed request and decides whether to retry it.
+// When it returns true it has already waited for the backoff delay.
+func (t *fetchTracker) shouldRetry(ctx context.Context, err error, attempt int) bool {
+	class := classifyFetchError(err)
+
+	// No responders can mean the stream is gone, or just that it is electing a leader
+	if class == ErrClassNoResponders {
+		if _, serr := t.js.Stream(ctx, t.streamName); errors.Is(serr, jetstream.ErrStreamNotFound) {
+			class = ErrClassStreamGone
+		}
+	}
+
+	t.mu.Lock()
+	if class == ErrClassStreamGone {
+		t.streamGone = true
+	}
+	t.errors[class]++
+	retry := class.transient() && attempt < t.retry.MaxRetries
+	if retry {
+		t.retries++
+	}
+	t.mu.Unlock()
+
+	if !retry {
+		return false
+	}
+
+	timer := time.NewTimer(t.retry.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// giveUp records the range that could not be fetched and the error that caused it
+func (t *fetchTracker) giveUp(r seqRange, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r.First <= r.Last {
+		t.errorGaps = append(t.errorGaps, r)
+	}
+	if t.fatal == nil && !errors.Is(err, context.Canceled) {
+		t.fatal = err
+	}
+}
+
+// completeness builds the completeness record once all chunks are done.
+// messages must be sorted by sequence.
+func (t *fetchTracker) completeness(requested seqRange, messages []MessageData) FetchCompleteness {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := FetchCompleteness{
+		StreamName: t.streamName,
+		FirstSeq:   requested.First,
+		LastSeq:    requested.Last,
+		Fetched:    len(messages),
+		Retries:    t.retries,
+		Errors:     t.errors,
+	}
+	if t.fatal != nil {
+		class := classifyFetchError(t.fatal)
+		if t.streamGone {
+			class = ErrClassStreamGone
+		}
+		c.Fatal = fmt.Sprintf("%s: %v", class, t.fatal)
+	}
+
+	gaps := append([]seqRange(nil), t.errorGaps...)
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].First < gaps[j].First })
+	c.ErrorGaps = gaps
+	for _, g := range gaps {
+		c.Missing += g.Last - g.First + 1
+	}
+
+	// Sequences between the first and last fetched message that are neither stored
+	// nor part of an error gap were genuinely deleted
+	if len(messages) > 0 {
+		first := messages[0].Sequence
+		last := messages[len(messages)-1].Sequence
+		span := last - first + 1
+		var missingInSpan uint64
+		for _, g := range gaps {
+			lo := max(g.First, first)
+			hi := min(g.Last, last)
+			if lo <= hi {
+				missingInSpan += hi - lo + 1
+			}
+		}
+		if stored := uint64(len(messages)) + missingInSpan; span > stored {
+			c.Deleted = span - stored
+		}
+	}
+
+	return c
+}
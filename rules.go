@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"gopkg.in/yaml.v3"
+)
+
+// RuleSet is a rules file. Being YAML, it may also be written as JSON:
+//
+//	rules:
+//	  - name: orders-p99
+//	    stream: ORDERS
+//	    metric: rate_p99
+//	    op: ">"
+//	    value: 500
+//	  - metric: throughput_average
+//	    op: ">"
+//	    value: 5MB/s
+//	  - stream: "*"
+//	    metric: idle_gap
+//	    op: ">"
+//	    value: 10m
+type RuleSet struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is a condition on a statistic that is a violation when it holds
+type Rule struct {
+	Name string `yaml:"name"` // defaults to the condition
+	// Stream selects the streams checked: empty for all streams combined, a name, or a
+	// pattern such as "*" or "ORDERS_*" to check each matching stream on its own
+	Stream string `yaml:"stream"`
+	Metric string `yaml:"metric"`
+	Op     string `yaml:"op"`    // >, >=, <, <=, == or !=
+	Value  string `yaml:"value"` // in the metric's unit, e.g. 500, 5MB/s, 10m
+
+	unit  StatUnit
+	limit float64
+}
+
+// ruleOps are the comparison operators of a rule
+var ruleOps = map[string]func(v, limit float64) bool{
+	">":  func(v, limit float64) bool { return v > limit },
+	">=": func(v, limit float64) bool { return v >= limit },
+	"<":  func(v, limit float64) bool { return v < limit },
+	"<=": func(v, limit float64) bool { return v <= limit },
+	"==": func(v, limit float64) bool { return v == limit },
+	"!=": func(v, limit float64) bool { return v != limit },
+}
+
+// RuleTarget is what a rule is checked against: all streams combined or one stream
+type RuleTarget struct {
+	Name     string // stream name, empty for all streams combined
+	Stats    RateStatistics
+	Messages []MessageData // stored messages sorted by timestamp, for idle gaps
+	// WindowStart and WindowEnd bound the idle gaps, zero when open
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+// ruleMetric reads one metric of a target, false if the target has no value for it
+type ruleMetric struct {
+	Unit  StatUnit
+	Value func(t RuleTarget) (float64, bool)
+}
+
+// ruleMetrics returns the metrics rules can check: every field of RateStatistics, keyed like
+// rate_p99 or throughput_average, and idle_gap, the longest time between stored messages or
+// between a window bound and the nearest stored message
+func ruleMetrics() map[string]ruleMetric {
+	metrics := make(map[string]ruleMetric, len(rateStatFields)+1)
+	for _, field := range rateStatFields {
+		value := field.Value
+		metrics[metricKey(field.Name)] = ruleMetric{
+			Unit: field.Unit,
+			Value: func(t RuleTarget) (float64, bool) {
+				return value(t.Stats), t.Stats.TotalMessages > 0
+			},
+		}
+	}
+	metrics["idle_gap"] = ruleMetric{
+		Unit: UnitDuration,
+		Value: func(t RuleTarget) (float64, bool) {
+			if len(t.Messages) == 0 {
+				// Idle for the whole window, if it is bounded
+				if t.WindowStart.IsZero() || t.WindowEnd.IsZero() {
+					return 0, false
+				}
+				return float64(t.WindowEnd.Sub(t.WindowStart)), true
+			}
+			var longest time.Duration
+			for i := 1; i < len(t.Messages); i++ {
+				longest = max(longest, t.Messages[i].Timestamp.Sub(t.Messages[i-1].Timestamp))
+			}
+			for _, gap := range edgeGaps(t.Messages, t.WindowStart, t.WindowEnd) {
+				longest = max(longest, gap.Duration())
+			}
+			if len(t.Messages) < 2 && longest == 0 {
+				return 0, false
+			}
+			return float64(longest), true
+		},
+	}
+	return metrics
+}
+
+// metricKey turns a statistic name like "Rate P99.9" into its rule metric, rate_p999
+func metricKey(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ToLower(name), " ", "_"), ".", "")
+}
+
+// LoadRules reads and validates a rules file. Points in time are taken to be in loc
+// unless they carry a UTC offset.
+func LoadRules(filename string, loc *time.Location) ([]Rule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var set RuleSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", filename, err)
+	}
+	if len(set.Rules) == 0 {
+		return nil, fmt.Errorf("rules file %s has no rules", filename)
+	}
+
+	metrics := ruleMetrics()
+	for i := range set.Rules {
+		r := &set.Rules[i]
+		metric, ok := metrics[r.Metric]
+		if !ok {
+			names := make([]string, 0, len(metrics))
+			for name := range metrics {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("rule %d: unknown metric %q, expected one of %s", i+1, r.Metric, strings.Join(names, ", "))
+		}
+		if _, ok := ruleOps[r.Op]; !ok {
+			return nil, fmt.Errorf("rule %d: unknown operator %q, expected >, >=, <, <=, == or !=", i+1, r.Op)
+		}
+		if _, err := path.Match(r.Stream, ""); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid stream pattern %q", i+1, r.Stream)
+		}
+		r.unit = metric.Unit
+		r.limit, err = parseRuleValue(r.Value, r.unit, loc)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid value %q for %s: %w", i+1, r.Value, r.Metric, err)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%s %s %s", r.Metric, r.Op, r.Value)
+		}
+	}
+
+	return set.Rules, nil
+}
+
+// parseRuleValue parses a rule value in the unit of its metric. Rates may end in /s or
+// msg/s, byte sizes and throughputs take units like 5MB or 5MB/s.
+func parseRuleValue(s string, unit StatUnit, loc *time.Location) (float64, error) {
+	s = strings.TrimSpace(s)
+	switch unit {
+	case UnitRate:
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "msg"))
+		return strconv.ParseFloat(s, 64)
+	case UnitBytes, UnitThroughput:
+		s = strings.TrimSuffix(s, "/s")
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v, nil
+		}
+		v, err := humanize.ParseBytes(s)
+		return float64(v), err
+	case UnitDuration:
+		d, err := time.ParseDuration(s)
+		return float64(d), err
+	case UnitTime:
+		t, err := parseTimestamp(s, loc)
+		return float64(t.UnixNano()), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// RuleResult is the outcome of checking a rule against one target
+type RuleResult struct {
+	Rule     *Rule
+	Stream   string // empty for all streams combined
+	Value    float64
+	NoData   bool // the target has no value for the metric, or the stream was not found
+	Violated bool
+}
+
+// EvaluateRules checks every rule against the combined target or the matching streams
+func EvaluateRules(rules []Rule, combined RuleTarget, streams []RuleTarget) []RuleResult {
+	metrics := ruleMetrics()
+	var results []RuleResult
+	for i := range rules {
+		r := &rules[i]
+
+		var targets []RuleTarget
+		switch {
+		case r.Stream == "":
+			targets = []RuleTarget{combined}
+		default:
+			for _, t := range streams {
+				if ok, _ := path.Match(r.Stream, t.Name); ok {
+					targets = append(targets, t)
+				}
+			}
+			if len(targets) == 0 {
+				results = append(results, RuleResult{Rule: r, Stream: r.Stream, NoData: true})
+				continue
+			}
+		}
+
+		for _, t := range targets {
+			v, ok := metrics[r.Metric].Value(t)
+			results = append(results, RuleResult{
+				Rule:     r,
+				Stream:   t.Name,
+				Value:    v,
+				NoData:   !ok,
+				Violated: ok && ruleOps[r.Op](v, r.limit),
+			})
+		}
+	}
+	return results
+}
+
+// RuleViolationError reports that rules were violated, so the run exits with a distinct status
+type RuleViolationError struct {
+	Violations int
+}
+
+func (e *RuleViolationError) Error() string {
+	if e.Violations == 1 {
+		return "1 rule violation"
+	}
+	return fmt.Sprintf("%d rule violations", e.Violations)
+}
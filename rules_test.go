@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRules = `rules:
+  - name: orders-p99
+    stream: "ORDERS_*"
+    metric: rate_p99
+    op: ">"
+    value: 500
+  - metric: throughput_average
+    op: ">="
+    value: 5MB/s
+  - stream: "*"
+    metric: idle_gap
+    op: ">"
+    value: 10m
+  - stream: MISSING
+    metric: rate_average
+    op: "<"
+    value: 1 msg/s
+  - stream: EVENTS
+    metric: end_time
+    op: "<"
+    value: "2026-10-18T12:30:00Z"
+`
+
+// writeRules writes a rules file and loads it
+func writeRules(t *testing.T, rules string) ([]Rule, error) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(filename, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadRules(filename, time.UTC)
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := writeRules(t, testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name  string
+		unit  StatUnit
+		limit float64
+	}{
+		{"orders-p99", UnitRate, 500},
+		{"throughput_average >= 5MB/s", UnitThroughput, 5e6},
+		{"idle_gap > 10m", UnitDuration, float64(10 * time.Minute)},
+		{"rate_average < 1 msg/s", UnitRate, 1},
+		{"end_time < 2026-10-18T12:30:00Z", UnitTime, float64(time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC).UnixNano())},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("%d rules, want %d", len(rules), len(want))
+	}
+	for i, r := range rules {
+		if r.Name != want[i].name || r.unit != want[i].unit || r.limit != want[i].limit {
+			t.Errorf("rule %d = %q in %v limited to %v, want %q in %v limited to %v", i+1, r.Name, r.unit, r.limit, want[i].name, want[i].unit, want[i].limit)
+		}
+	}
+}
+
+func TestLoadRulesInvalid(t *testing.T) {
+	tests := []struct {
+		rules string
+		err   string
+	}{
+		{"rules: []", "has no rules"},
+		{"rules: [{metric: rate_p42, op: '>', value: 1}]", `unknown metric "rate_p42"`},
+		{"rules: [{metric: rate_p99, op: '=>', value: 1}]", `unknown operator "=>"`},
+		{"rules: [{stream: 'ORDERS_[', metric: rate_p99, op: '>', value: 1}]", "invalid stream pattern"},
+		{"rules: [{metric: rate_p99, op: '>', value: 5MB/s}]", "invalid value"},
+		{"rules: [{metric: idle_gap, op: '>', value: 10}]", "invalid value"},
+		{"rules: {metric: rate_p99}", "invalid rules file"},
+	}
+
+	for _, tt := range tests {
+		if _, err := writeRules(t, tt.rules); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("LoadRules(%s) error %v, want %q", tt.rules, err, tt.err)
+		}
+	}
+}
+
+// ruleMessages returns stored messages at the given minutes past noon
+func ruleMessages(minutes ...int) []MessageData {
+	noon := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	messages := make([]MessageData, len(minutes))
+	for i, m := range minutes {
+		messages[i] = MessageData{Sequence: uint64(i + 1), Timestamp: noon.Add(time.Duration(m) * time.Minute)}
+	}
+	return messages
+}
+
+func TestEvaluateRules(t *testing.T) {
+	rules, err := writeRules(t, testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	windowStart := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	windowEnd := windowStart.Add(time.Hour)
+	target := func(name string, stats RateStatistics, messages []MessageData) RuleTarget {
+		return RuleTarget{Name: name, Stats: stats, Messages: messages, WindowStart: windowStart, WindowEnd: windowEnd}
+	}
+	combined := target("", RateStatistics{TotalMessages: 14, AvgThroughput: 6e6}, nil)
+	streams := []RuleTarget{
+		// Every five minutes for the whole hour
+		target("ORDERS_EU", RateStatistics{TotalMessages: 12, P99Rate: 600}, ruleMessages(0, 5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 55)),
+		// Idle for the last half hour of the window
+		target("ORDERS_US", RateStatistics{TotalMessages: 2, P99Rate: 400}, ruleMessages(20, 30)),
+		target("EVENTS", RateStatistics{}, nil),
+	}
+
+	want := []struct {
+		rule     string
+		stream   string
+		value    float64
+		noData   bool
+		violated bool
+	}{
+		{"orders-p99", "ORDERS_EU", 600, false, true},
+		{"orders-p99", "ORDERS_US", 400, false, false},
+		{"throughput_average >= 5MB/s", "", 6e6, false, true},
+		{"idle_gap > 10m", "ORDERS_EU", float64(5 * time.Minute), false, false},
+		{"idle_gap > 10m", "ORDERS_US", float64(30 * time.Minute), false, true},
+		{"idle_gap > 10m", "EVENTS", float64(time.Hour), false, true},
+		// The value is meaningless without data
+		{"rate_average < 1 msg/s", "MISSING", 0, true, false},
+		{"end_time < 2026-10-18T12:30:00Z", "EVENTS", 0, true, false},
+	}
+
+	results := EvaluateRules(rules, combined, streams)
+	if len(results) != len(want) {
+		t.Fatalf("%d results, want %d", len(results), len(want))
+	}
+	violations := 0
+	for i, r := range results {
+		w := want[i]
+		if r.Rule.Name != w.rule || r.Stream != w.stream || (!w.noData && r.Value != w.value) || r.NoData != w.noData || r.Violated != w.violated {
+			t.Errorf("result %d = %q on %q: %v, no data %v, violated %v, want %q on %q: %v, no data %v, violated %v",
+				i, r.Rule.Name, r.Stream, r.Value, r.NoData, r.Violated, w.rule, w.stream, w.value, w.noData, w.violated)
+		}
+		if r.Violated {
+			violations++
+		}
+	}
+	if violations != 4 {
+		t.Errorf("%d violations, want 4", violations)
+	}
+
+	// Without a window a single message has no idle gap and an empty stream no idle time
+	idle := rules[2:3]
+	open := []RuleTarget{{Name: "ONE", Messages: ruleMessages(30)}, {Name: "NONE"}}
+	for _, r := range EvaluateRules(idle, RuleTarget{}, open) {
+		if !r.NoData || r.Violated {
+			t.Errorf("idle gap of %s without a window: %v, no data %v, violated %v", r.Stream, r.Value, r.NoData, r.Violated)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{&RuleViolationError{Violations: 3}, 2},
+		{fmt.Errorf("checking rules: %w", &RuleViolationError{Violations: 1}), 2},
+		{errors.New("no streams found"), 1},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ProfileSlot holds the rate statistics of all buckets falling in one recurring time slot
+type ProfileSlot struct {
+	Label    string
+	Buckets  int
+	MeanRate float64 // stored messages per second
+	P50Rate  float64
+	P99Rate  float64
+}
+
+// SeasonalityProfile folds a histogram's timeline into recurring hour-of-day and day-of-week slots
+type SeasonalityProfile struct {
+	HourOfDay []ProfileSlot // 24 slots, nil if the buckets are longer than an hour
+	DayOfWeek []ProfileSlot // 7 slots starting on Monday, nil if the buckets are longer than a day
+	// Heatmap holds the mean rate per day of week (Monday first) and hour of day
+	// nil if the buckets are longer than an hour
+	Heatmap        [][]float64
+	HeatmapBuckets [][]int // buckets per heatmap cell, 0 means no data
+}
+
+// weekdayLabels are the day-of-week slot labels, Monday first
+var weekdayLabels = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+// mondayFirst returns the day of week index with Monday as 0
+func mondayFirst(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+// BuildSeasonality computes the hour-of-day and day-of-week profiles of a histogram
+// Slots are taken in the timezone of the histogram's bucket layout. Empty buckets count
+// as zero rate, so quiet hours pull down the mean like they should.
+func BuildSeasonality(hist *RateHistogram) *SeasonalityProfile {
+	if hist == nil || len(hist.Buckets) == 0 {
+		return nil
+	}
+
+	bucketLen := hist.Layout.Nominal()
+	byHour := bucketLen <= time.Hour && !hist.Layout.Calendar()
+	byDay := bucketLen <= 24*time.Hour
+
+	profile := &SeasonalityProfile{}
+	if !byHour && !byDay {
+		return profile
+	}
+
+	hourRates := make([][]float64, 24)
+	dayRates := make([][]float64, 7)
+	var heatSum [7][24]float64
+	var heatCount [7][24]int
+
+	loc := hist.Layout.location()
+	for _, b := range hist.Buckets {
+		start := b.Start.In(loc)
+		hour := start.Hour()
+		day := mondayFirst(start.Weekday())
+
+		if byHour {
+			hourRates[hour] = append(hourRates[hour], b.Rate)
+			heatSum[day][hour] += b.Rate
+			heatCount[day][hour]++
+		}
+		dayRates[day] = append(dayRates[day], b.Rate)
+	}
+
+	if byHour {
+		profile.HourOfDay = make([]ProfileSlot, 24)
+		for h := range 24 {
+			profile.HourOfDay[h] = profileSlot(fmt.Sprintf("%02d:00", h), hourRates[h])
+		}
+
+		profile.Heatmap = make([][]float64, 7)
+		profile.HeatmapBuckets = make([][]int, 7)
+		for d := range 7 {
+			profile.Heatmap[d] = make([]float64, 24)
+			profile.HeatmapBuckets[d] = heatCount[d][:]
+			for h := range 24 {
+				if heatCount[d][h] > 0 {
+					profile.Heatmap[d][h] = heatSum[d][h] / float64(heatCount[d][h])
+				}
+			}
+		}
+	}
+
+	if byDay {
+		profile.DayOfWeek = make([]ProfileSlot, 7)
+		for d := range 7 {
+			profile.DayOfWeek[d] = profileSlot(weekdayLabels[d], dayRates[d])
+		}
+	}
+
+	return profile
+}
+
+// profileSlot calculates the statistics of a slot from the rates of its buckets
+func profileSlot(label string, rates []float64) ProfileSlot {
+	slot := ProfileSlot{Label: label, Buckets: len(rates)}
+	if len(rates) == 0 {
+		return slot
+	}
+
+	var sum float64
+	for _, r := range rates {
+		sum += r
+	}
+	slot.MeanRate = sum / float64(len(rates))
+
+	sort.Float64s(rates)
+	slot.P50Rate = percentileFloat64(rates, 0.50)
+	slot.P99Rate = percentileFloat64(rates, 0.99)
+
+	return slot
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// SizeHistogram counts messages and bytes in log2 size bins: bin 0 holds empty messages
+// and bin b holds sizes from 2^(b-1) up to 2^b. It is derived from a SizeSketch, whose bins
+// split the log2 bins exactly, so the counts are exact and the bytes within 1%.
+type SizeHistogram struct {
+	Counts []int // per bin, up to the highest used bin
+	Bytes  []int64
+}
+
+// sizeBin returns the bin of a message size
+func sizeBin(size int) int {
+	return bits.Len(uint(max(size, 0)))
+}
+
+// sizeBinBounds returns the smallest size of a bin and the smallest size of the next one
+func sizeBinBounds(bin int) (int, int) {
+	if bin == 0 {
+		return 0, 1
+	}
+	return 1 << (bin - 1), 1 << bin
+}
+
+// sizeBinLabel describes a bin, e.g. "1 KiB-2 KiB"
+func sizeBinLabel(bin int) string {
+	if bin == 0 {
+		return "0 B"
+	}
+	lower, upper := sizeBinBounds(bin)
+	return formatSizeBound(lower) + "-" + formatSizeBound(upper)
+}
+
+// formatSizeBound formats a power of two size compactly, e.g. 64 KiB
+func formatSizeBound(size int) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	unit := 0
+	for size >= 1024 && size%1024 == 0 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	return strconv.Itoa(size) + " " + units[unit]
+}
+
+// Log2Histogram returns the log2 size histogram of the sketch, nil for a nil sketch. The
+// bytes of each sketch bin are estimated from its representative size.
+func (s *SizeSketch) Log2Histogram() *SizeHistogram {
+	if s == nil {
+		return nil
+	}
+	h := &SizeHistogram{}
+	if s.Zeros > 0 {
+		h.grow(1)
+		h.Counts[0] = s.Zeros
+	}
+	for i, count := range s.Counts {
+		if count == 0 {
+			continue
+		}
+		bin := s.Offset + i
+		size := min(max(sketchBinValue(bin), float64(s.Min)), float64(s.Max))
+		log2 := sketchBinLog2(bin)
+		h.grow(log2 + 1)
+		h.Counts[log2] += count
+		h.Bytes[log2] += int64(math.Round(size * float64(count)))
+	}
+	return h
+}
+
+func (h *SizeHistogram) grow(bins int) {
+	for len(h.Counts) < bins {
+		h.Counts = append(h.Counts, 0)
+		h.Bytes = append(h.Bytes, 0)
+	}
+}
+
+// Total returns the number of messages counted
+func (h *SizeHistogram) Total() int {
+	if h == nil {
+		return 0
+	}
+	total := 0
+	for _, count := range h.Counts {
+		total += count
+	}
+	return total
+}
+
+// SizeClass is a range of message sizes reported together
+type SizeClass struct {
+	Label string
+	Min   int // smallest size in the class
+	Max   int // first size beyond the class, 0 for no limit
+}
+
+// sizeClasses are the reported size classes, their bounds are powers of two so the log2
+// histogram splits them exactly
+var sizeClasses = []SizeClass{
+	{Label: "< 1 KiB", Min: 0, Max: 1 << 10},
+	{Label: "1-64 KiB", Min: 1 << 10, Max: 1 << 16},
+	{Label: ">= 64 KiB", Min: 1 << 16},
+}
+
+// SizeClassVolume counts the messages and bytes of a size class
+type SizeClassVolume struct {
+	Messages int
+	Bytes    int64
+}
+
+// Classes returns the volume of each size class, in the order of sizeClasses
+func (h *SizeHistogram) Classes() []SizeClassVolume {
+	volumes := make([]SizeClassVolume, len(sizeClasses))
+	if h == nil {
+		return volumes
+	}
+	for bin, count := range h.Counts {
+		lower, _ := sizeBinBounds(bin)
+		for i, class := range sizeClasses {
+			if lower >= class.Min && (class.Max == 0 || lower < class.Max) {
+				volumes[i].Messages += count
+				volumes[i].Bytes += h.Bytes[bin]
+				break
+			}
+		}
+	}
+	return volumes
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+// sketchBinsPerOctave splits every power of two into bins of the same relative width,
+// (gamma-1)/(gamma+1) < 1% for the quantiles of a SizeSketch. Bins never straddle a power
+// of two, so they also give the exact log2 size histogram.
+const sketchBinsPerOctave = 35
+
+var (
+	sketchGamma    = math.Pow(2, 1.0/sketchBinsPerOctave)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// SizeSketch is a DDSketch of message sizes: sizes are counted in logarithmic bins narrow
+// enough that any quantile is within 1% of the true size. Sketches merge
+// exactly, so a range of buckets, a downsampled bucket or a stream's buckets give the
+// same quantiles as a sketch of their messages, at a few hundred counters at most.
+type SizeSketch struct {
+	Count      int
+	Zeros      int   // empty messages, which have no bin
+	Offset     int   // bin of Counts[0]
+	Counts     []int // per bin, from the lowest to the highest used bin
+	Min        int
+	Max        int
+	SumSquares float64 // sum of squared sizes for the standard deviation
+}
+
+// sketchBin returns the bin of a size above zero, bin b holds the sizes from gamma^b up
+// to gamma^(b+1)
+func sketchBin(size int) int {
+	octave := bits.Len(uint(size)) - 1
+	within := math.Log(float64(size)/float64(uint(1)<<octave)) / sketchLogGamma
+	return octave*sketchBinsPerOctave + min(int(within), sketchBinsPerOctave-1)
+}
+
+// sketchBinValue returns the size representing a bin, within 1% of all its sizes
+func sketchBinValue(bin int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(bin+1)) / (sketchGamma + 1)
+}
+
+// sketchBinLog2 returns the log2 size bin, see sizeBin, holding the sizes of a sketch bin
+func sketchBinLog2(bin int) int {
+	return bin/sketchBinsPerOctave + 1
+}
+
+// Add counts one message
+func (s *SizeSketch) Add(size int) {
+	s.AddN(size, 1)
+}
+
+// AddN counts n messages of the same size
+func (s *SizeSketch) AddN(size, n int) {
+	size = max(size, 0)
+	if s.Count == 0 {
+		s.Min, s.Max = size, size
+	}
+	s.Min = min(s.Min, size)
+	s.Max = max(s.Max, size)
+	s.Count += n
+	s.SumSquares += float64(n) * float64(size) * float64(size)
+
+	if size == 0 {
+		s.Zeros += n
+		return
+	}
+	s.addBin(sketchBin(size), n)
+}
+
+// Merge adds the counts of another sketch, which may be nil
+func (s *SizeSketch) Merge(other *SizeSketch) {
+	if other == nil || other.Count == 0 {
+		return
+	}
+	if s.Count == 0 {
+		s.Min, s.Max = other.Min, other.Max
+	}
+	s.Min = min(s.Min, other.Min)
+	s.Max = max(s.Max, other.Max)
+	s.Count += other.Count
+	s.Zeros += other.Zeros
+	s.SumSquares += other.SumSquares
+
+	for i, count := range other.Counts {
+		if count > 0 {
+			s.addBin(other.Offset+i, count)
+		}
+	}
+}
+
+// addBin adds count to a bin, extending the bin range as needed
+func (s *SizeSketch) addBin(bin int, count int) {
+	switch {
+	case len(s.Counts) == 0:
+		s.Offset = bin
+		s.Counts = []int{0}
+	case bin < s.Offset:
+		s.Counts = append(make([]int, s.Offset-bin, s.Offset-bin+len(s.Counts)), s.Counts...)
+		s.Offset = bin
+	}
+	for bin-s.Offset >= len(s.Counts) {
+		s.Counts = append(s.Counts, 0)
+	}
+	s.Counts[bin-s.Offset] += count
+}
+
+// Quantile returns the q-th quantile of the sizes, within 1% of the exact value
+func (s *SizeSketch) Quantile(q float64) float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+
+	rank := q * float64(s.Count-1)
+	seen := s.Zeros
+	if float64(seen) > rank {
+		return 0
+	}
+	for i, count := range s.Counts {
+		seen += count
+		if float64(seen) > rank {
+			value := sketchBinValue(s.Offset + i)
+			return min(max(value, float64(s.Min)), float64(s.Max))
+		}
+	}
+	return float64(s.Max)
+}
+
+// StdDev returns the standard deviation of the sizes given their mean
+func (s *SizeSketch) StdDev(mean float64) float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+	return math.Sqrt(max(s.SumSquares/float64(s.Count)-mean*mean, 0))
+}
+
+// mergeBucketSketches returns the size sketch of all the buckets together
+func mergeBucketSketches(buckets []RateBucket) *SizeSketch {
+	merged := &SizeSketch{}
+	for _, b := range buckets {
+		merged.Merge(b.SizeSketch)
+	}
+	return merged
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// sketchSizes returns log-normally distributed sizes around 1 KiB with some empty messages
+func sketchSizes(n int) []int {
+	rng := rand.New(rand.NewPCG(1, 2))
+	sizes := make([]int, n)
+	for i := range sizes {
+		if i%50 == 0 {
+			continue
+		}
+		sizes[i] = min(int(math.Exp(7+1.5*rng.NormFloat64())), 1<<16)
+	}
+	return sizes
+}
+
+func TestSizeSketchQuantile(t *testing.T) {
+	sizes := sketchSizes(20000)
+	s := &SizeSketch{}
+	for _, size := range sizes {
+		s.Add(size)
+	}
+	sorted := slices.Sorted(slices.Values(sizes))
+
+	for _, q := range []float64{0, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 1} {
+		exact := float64(sorted[int(q*float64(len(sorted)-1))])
+		got := s.Quantile(q)
+		if math.Abs(got-exact) > 0.01*exact {
+			t.Errorf("Quantile(%v) = %.1f, want %.0f within 1%%", q, got, exact)
+		}
+	}
+	if s.Count != len(sizes) || s.Min != sorted[0] || s.Max != sorted[len(sorted)-1] {
+		t.Errorf("count %d from %d to %d, want %d from %d to %d", s.Count, s.Min, s.Max, len(sizes), sorted[0], sorted[len(sorted)-1])
+	}
+}
+
+func TestSizeSketchMerge(t *testing.T) {
+	sizes := sketchSizes(5000)
+
+	// The halves cover different bin ranges, so merging extends the bins on both sides
+	slices.Sort(sizes[:2500])
+	all, low, high := &SizeSketch{}, &SizeSketch{}, &SizeSketch{}
+	for i, size := range sizes {
+		all.Add(size)
+		if i < 1000 || i >= 2000 && i < 2500 {
+			low.Add(size)
+		} else {
+			high.Add(size)
+		}
+	}
+
+	merged := &SizeSketch{}
+	merged.Merge(high)
+	merged.Merge(nil)
+	merged.Merge(low)
+	merged.Merge(&SizeSketch{})
+	if !reflect.DeepEqual(merged, all) {
+		t.Errorf("merged sketch %+v, want %+v", merged, all)
+	}
+}
+
+func TestSizeSketchLog2Histogram(t *testing.T) {
+	sizes := sketchSizes(5000)
+	// The sizes on both sides of every power of two
+	for shift := range 31 {
+		sizes = append(sizes, 1<<shift-1, 1<<shift, 1<<shift+1)
+	}
+
+	s := &SizeSketch{}
+	var want SizeHistogram
+	for _, size := range sizes {
+		s.Add(size)
+		bin := sizeBin(size)
+		want.grow(bin + 1)
+		want.Counts[bin]++
+		want.Bytes[bin] += int64(size)
+	}
+
+	got := s.Log2Histogram()
+	if !slices.Equal(got.Counts, want.Counts) {
+		t.Fatalf("log2 counts %v, want %v", got.Counts, want.Counts)
+	}
+	for bin, bytes := range want.Bytes {
+		if math.Abs(float64(got.Bytes[bin]-bytes)) > 0.01*float64(bytes) {
+			t.Errorf("bin %s has %d bytes, want %d within 1%%", sizeBinLabel(bin), got.Bytes[bin], bytes)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// snapshotVersion is the format version of saved snapshots, raised on incompatible changes
+const snapshotVersion = 2
+
+// Snapshot is a saved analysis: the report summary and the combined histogram with its
+// per-stream breakdown, so it can be compared with a later run without the messages
+type Snapshot struct {
+	Version     int                `json:"version"`
+	Created     time.Time          `json:"created"`
+	Granularity string             `json:"granularity"`
+	Timezone    string             `json:"timezone"`
+	WindowStart time.Time          `json:"window_start"`
+	WindowEnd   time.Time          `json:"window_end"`
+	Summary     JSONSummary        `json:"summary"`
+	Histogram   *SnapshotHistogram `json:"histogram,omitempty"`
+}
+
+// SnapshotHistogram is the saved combined histogram, its deletes are in the summary
+type SnapshotHistogram struct {
+	Buckets       []SnapshotBucket `json:"buckets"`
+	Stats         JSONStats        `json:"stats"`
+	Gaps          []SnapshotGap    `json:"gaps,omitempty"` // to re-interpolate with another strategy
+	Interpolation string           `json:"interpolation"`
+}
+
+// SnapshotBucket is a saved bucket, the rates follow from its counts and bounds
+type SnapshotBucket struct {
+	Start           time.Time                     `json:"start"`
+	End             time.Time                     `json:"end"`
+	Count           int                           `json:"count"`
+	SeqCount        int                           `json:"seq_count"`
+	Bytes           int64                         `json:"bytes"`
+	MinMsgSize      int                           `json:"min_msg_size"`
+	MaxMsgSize      int                           `json:"max_msg_size"`
+	SumMsgSize      int64                         `json:"sum_msg_size"`
+	Sizes           *SnapshotSketch               `json:"sizes,omitempty"`
+	InBucketDeletes int                           `json:"in_bucket_deletes,omitempty"`
+	PerStream       map[string]SnapshotStreamData `json:"per_stream,omitempty"`
+}
+
+// SnapshotStreamData is the saved data of one stream in a bucket
+type SnapshotStreamData struct {
+	Count           int             `json:"count"`
+	SeqCount        int             `json:"seq_count"`
+	Bytes           int64           `json:"bytes"`
+	Sizes           *SnapshotSketch `json:"sizes,omitempty"`
+	InBucketDeletes int             `json:"in_bucket_deletes,omitempty"`
+}
+
+// SnapshotSketch is a saved SizeSketch
+type SnapshotSketch struct {
+	Count      int     `json:"count"`
+	Zeros      int     `json:"zeros,omitempty"`
+	Offset     int     `json:"offset"`
+	Counts     []int   `json:"counts"`
+	Min        int     `json:"min"`
+	Max        int     `json:"max"`
+	SumSquares float64 `json:"sum_squares"`
+}
+
+// SnapshotGap is a saved DeleteGap spanning several buckets
+type SnapshotGap struct {
+	Stream   string    `json:"stream"`
+	PrevSeq  uint64    `json:"prev_seq"`
+	PrevTime time.Time `json:"prev_time"`
+	NextTime time.Time `json:"next_time"`
+	Count    int       `json:"count"`
+	Cause    string    `json:"cause"`
+}
+
+// SaveSnapshot writes an analysis to a snapshot file
+func SaveSnapshot(filename string, cfg Config, side ComparisonSide) error {
+	snapshot := Snapshot{
+		Version:     snapshotVersion,
+		Created:     time.Now().UTC(),
+		Granularity: cfg.RateGranularity,
+		Timezone:    cfg.BucketLayout.location().String(),
+		WindowStart: side.WindowStart,
+		WindowEnd:   side.WindowEnd,
+		Summary:     convertSummary(&side.Summary),
+		Histogram:   snapshotHistogram(side.Histogram),
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// LoadSnapshot reads a snapshot file as one side of a comparison. The bucket layout of the
+// snapshot is restored from its granularity and timezone.
+func LoadSnapshot(filename string) (ComparisonSide, BucketLayout, error) {
+	var side ComparisonSide
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return side, BucketLayout{}, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return side, BucketLayout{}, fmt.Errorf("invalid snapshot %s: %w", filename, err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return side, BucketLayout{}, fmt.Errorf("snapshot %s has version %d, expected %d, save it again with this version", filename, snapshot.Version, snapshotVersion)
+	}
+
+	layout, err := ParseBucketLayout(snapshot.Granularity, snapshot.Timezone)
+	if err != nil {
+		return side, BucketLayout{}, fmt.Errorf("snapshot %s: %w", filename, err)
+	}
+
+	side = ComparisonSide{
+		Label:       filename,
+		WindowStart: snapshot.WindowStart,
+		WindowEnd:   snapshot.WindowEnd,
+		Summary:     snapshot.Summary.reportSummary(layout),
+	}
+	if snapshot.Histogram != nil {
+		side.Histogram = snapshot.Histogram.rateHistogram(layout)
+		side.Histogram.Deletes = side.Summary.Deletes
+	}
+	return side, layout, nil
+}
+
+// snapshotHistogram converts a histogram to its saved form, nil for a nil histogram
+func snapshotHistogram(h *RateHistogram) *SnapshotHistogram {
+	if h == nil {
+		return nil
+	}
+
+	sh := &SnapshotHistogram{
+		Buckets:       make([]SnapshotBucket, len(h.Buckets)),
+		Stats:         convertStats(h.Stats),
+		Interpolation: string(h.Interpolation),
+	}
+	for i, b := range h.Buckets {
+		sb := SnapshotBucket{
+			Start:           b.Start,
+			End:             b.End,
+			Count:           b.Count,
+			SeqCount:        b.SeqCount,
+			Bytes:           b.Bytes,
+			MinMsgSize:      b.MinMsgSize,
+			MaxMsgSize:      b.MaxMsgSize,
+			SumMsgSize:      b.SumMsgSize,
+			Sizes:           snapshotSketch(b.SizeSketch),
+			InBucketDeletes: b.InBucketDeletes,
+		}
+		if len(b.PerStream) > 0 {
+			sb.PerStream = make(map[string]SnapshotStreamData, len(b.PerStream))
+			for name, data := range b.PerStream {
+				sb.PerStream[name] = SnapshotStreamData{
+					Count:           data.Count,
+					SeqCount:        data.SeqCount,
+					Bytes:           data.Bytes,
+					Sizes:           snapshotSketch(data.SizeSketch),
+					InBucketDeletes: data.InBucketDeletes,
+				}
+			}
+		}
+		sh.Buckets[i] = sb
+	}
+	for _, gap := range h.Gaps {
+		sh.Gaps = append(sh.Gaps, SnapshotGap{
+			Stream:   gap.StreamName,
+			PrevSeq:  gap.PrevSeq,
+			PrevTime: gap.PrevTime,
+			NextTime: gap.NextTime,
+			Count:    gap.Count,
+			Cause:    string(gap.Cause),
+		})
+	}
+	return sh
+}
+
+// rateHistogram restores a saved histogram with the given bucket layout
+func (sh *SnapshotHistogram) rateHistogram(layout BucketLayout) *RateHistogram {
+	h := &RateHistogram{
+		Buckets:       make([]RateBucket, len(sh.Buckets)),
+		Granularity:   layout.Nominal(),
+		Layout:        layout,
+		Stats:         sh.Stats.rateStatistics(),
+		Interpolation: InterpolationStrategy(sh.Interpolation),
+	}
+	for i, sb := range sh.Buckets {
+		b := RateBucket{
+			Start:           sb.Start,
+			End:             sb.End,
+			Count:           sb.Count,
+			SeqCount:        sb.SeqCount,
+			Bytes:           sb.Bytes,
+			MinMsgSize:      sb.MinMsgSize,
+			MaxMsgSize:      sb.MaxMsgSize,
+			SumMsgSize:      sb.SumMsgSize,
+			SizeSketch:      sb.Sizes.sizeSketch(),
+			InBucketDeletes: sb.InBucketDeletes,
+		}
+		if len(sb.PerStream) > 0 {
+			b.PerStream = make(map[string]*StreamBucketData, len(sb.PerStream))
+			for name, data := range sb.PerStream {
+				b.PerStream[name] = &StreamBucketData{
+					Count:           data.Count,
+					SeqCount:        data.SeqCount,
+					Bytes:           data.Bytes,
+					SizeSketch:      data.Sizes.sizeSketch(),
+					InBucketDeletes: data.InBucketDeletes,
+				}
+			}
+		}
+		h.Buckets[i] = b
+	}
+	computeBucketRates(h.Buckets)
+	for _, gap := range sh.Gaps {
+		h.Gaps = append(h.Gaps, DeleteGap{
+			StreamName: gap.Stream,
+			PrevSeq:    gap.PrevSeq,
+			PrevTime:   gap.PrevTime,
+			NextTime:   gap.NextTime,
+			Count:      gap.Count,
+			Cause:      GapCause(gap.Cause),
+		})
+	}
+	return h
+}
+
+// snapshotSketch converts a size sketch to its saved form, nil for a nil sketch
+func snapshotSketch(s *SizeSketch) *SnapshotSketch {
+	if s == nil {
+		return nil
+	}
+	return &SnapshotSketch{
+		Count:      s.Count,
+		Zeros:      s.Zeros,
+		Offset:     s.Offset,
+		Counts:     s.Counts,
+		Min:        s.Min,
+		Max:        s.Max,
+		SumSquares: s.SumSquares,
+	}
+}
+
+// sizeSketch restores a saved size sketch, nil for a nil one
+func (s *SnapshotSketch) sizeSketch() *SizeSketch {
+	if s == nil {
+		return nil
+	}
+	return &SizeSketch{
+		Count:      s.Count,
+		Zeros:      s.Zeros,
+		Offset:     s.Offset,
+		Counts:     s.Counts,
+		Min:        s.Min,
+		Max:        s.Max,
+		SumSquares: s.SumSquares,
+	}
+}
+
+// reportSummary restores a saved summary with the given bucket layout. Inter-arrival
+// statistics are not saved.
+func (s JSONSummary) reportSummary(layout BucketLayout) ReportSummary {
+	summary := ReportSummary{
+		StartTime:     s.StartTime,
+		EndTime:       s.EndTime,
+		Duration:      time.Duration(s.DurationNs),
+		WindowStart:   s.WindowStart,
+		WindowEnd:     s.WindowEnd,
+		StreamCount:   s.StreamCount,
+		TotalMsgs:     s.TotalMsgs,
+		TotalBytes:    s.TotalBytes,
+		TotalSeqs:     s.TotalSeqs,
+		SeqRate:       s.SeqRate,
+		Layout:        layout,
+		PurgeGaps:     PurgeGapMode(s.PurgeGaps),
+		Interpolation: InterpolationStrategy(s.Interpolation),
+	}
+	for _, st := range s.Streams {
+		summary.Streams = append(summary.Streams, StreamSummary{
+			Name:     st.Name,
+			Messages: st.Messages,
+			Bytes:    st.Bytes,
+			FirstSeq: st.FirstSeq,
+			LastSeq:  st.LastSeq,
+			SeqRate:  st.SeqRate,
+		})
+	}
+	for _, status := range s.Fetch {
+		fc := FetchCompleteness{
+			StreamName: status.Stream,
+			FirstSeq:   status.FirstSeq,
+			LastSeq:    status.LastSeq,
+			Fetched:    status.Fetched,
+			Deleted:    status.Deleted,
+			Missing:    status.Missing,
+			Retries:    status.Retries,
+			Fatal:      status.Fatal,
+		}
+		for _, gap := range status.ErrorGaps {
+			fc.ErrorGaps = append(fc.ErrorGaps, seqRange{First: gap[0], Last: gap[1]})
+		}
+		if len(status.Errors) > 0 {
+			fc.Errors = make(map[FetchErrorClass]int, len(status.Errors))
+			for class, n := range status.Errors {
+				fc.Errors[FetchErrorClass(class)] = n
+			}
+		}
+		summary.Fetch = append(summary.Fetch, fc)
+	}
+	for _, jb := range s.Deletes {
+		b := GapBreakdown{
+			StreamName:   jb.Stream,
+			StateDeleted: jb.StateDeleted,
+			ByCause:      make(map[GapCause]GapVolume, len(jb.ByCause)),
+		}
+		for cause, v := range jb.ByCause {
+			b.ByCause[GapCause(cause)] = GapVolume{Gaps: v.Gaps, Messages: v.Messages}
+		}
+		summary.Deletes = append(summary.Deletes, b)
+	}
+	return summary
+}
+
+// rateStatistics restores saved statistics
+func (s JSONStats) rateStatistics() RateStatistics {
+	return RateStatistics{
+		TotalMessages:  s.TotalMessages,
+		TotalBytes:     s.TotalBytes,
+		StartTime:      s.StartTime,
+		EndTime:        s.EndTime,
+		TotalDuration:  time.Duration(s.TotalDurationNs),
+		AvgRate:        s.AvgRate,
+		P50Rate:        s.P50Rate,
+		P90Rate:        s.P90Rate,
+		P99Rate:        s.P99Rate,
+		P999Rate:       s.P999Rate,
+		MinRate:        s.MinRate,
+		MaxRate:        s.MaxRate,
+		StdDevRate:     s.StdDevRate,
+		AvgSeqRate:     s.AvgSeqRate,
+		P50SeqRate:     s.P50SeqRate,
+		P90SeqRate:     s.P90SeqRate,
+		P99SeqRate:     s.P99SeqRate,
+		P999SeqRate:    s.P999SeqRate,
+		MinSeqRate:     s.MinSeqRate,
+		MaxSeqRate:     s.MaxSeqRate,
+		StdDevSeqRate:  s.StdDevSeqRate,
+		AvgThroughput:  s.AvgThroughput,
+		P50Throughput:  s.P50Throughput,
+		P90Throughput:  s.P90Throughput,
+		P99Throughput:  s.P99Throughput,
+		P999Throughput: s.P999Throughput,
+		MinThroughput:  s.MinThroughput,
+		MaxThroughput:  s.MaxThroughput,
+		StdDevTput:     s.StdDevThroughput,
+		AvgMsgSize:     s.AvgMsgSize,
+		P50MsgSize:     s.P50MsgSize,
+		P90MsgSize:     s.P90MsgSize,
+		P99MsgSize:     s.P99MsgSize,
+		P999MsgSize:    s.P999MsgSize,
+		MinMsgSize:     s.MinMsgSize,
+		MaxMsgSize:     s.MaxMsgSize,
+		StdDevMsgSize:  s.StdDevMsgSize,
+		FirstSeq:       s.FirstSeq,
+		LastSeq:        s.LastSeq,
+		SeqRate:        s.SeqRate,
+		ActiveBuckets:  s.ActiveBuckets,
+		TotalBuckets:   s.TotalBuckets,
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotSide analyzes 20 minutes of two streams, ORDERS with every tenth message deleted
+func snapshotSide(t *testing.T, layout BucketLayout) ComparisonSide {
+	t.Helper()
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	streams := []StreamInfo{{Name: "ORDERS", FirstSeq: 1, LastSeq: 1200}, {Name: "EVENTS", FirstSeq: 1, LastSeq: 600}}
+
+	var messages []MessageData
+	for seq := uint64(1); seq <= 1200; seq++ {
+		ts := start.Add(time.Duration(seq) * time.Second)
+		if seq%10 != 0 {
+			messages = append(messages, MessageData{StreamName: "ORDERS", Subject: "orders.new", Sequence: seq, Timestamp: ts, Size: int(seq%97) * 13})
+		}
+		if seq%2 == 0 {
+			messages = append(messages, MessageData{StreamName: "EVENTS", Subject: "events.x", Sequence: seq / 2, Timestamp: ts, Size: 1 << (seq % 11)})
+		}
+	}
+
+	summary, hist := buildCombinedAnalysis(messages, streams, nil, HistogramOptions{
+		Layout:        layout,
+		Gaps:          NewGapOptions(streams, 0, PurgeGapsInterpolate),
+		Interpolation: InterpolateProportional,
+	})
+	return ComparisonSide{
+		WindowStart: start,
+		WindowEnd:   start.Add(20 * time.Minute),
+		Summary:     summary,
+		Histogram:   hist,
+	}
+}
+
+// jsonEqual compares the JSON encodings of two values, so times compare by instant and offset
+func jsonEqual(t *testing.T, a, b any) bool {
+	t.Helper()
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ja) == string(jb)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	cfg := Config{RateGranularity: "5m"}
+	var err error
+	if cfg.BucketLayout, err = ParseBucketLayout(cfg.RateGranularity, "Europe/Amsterdam"); err != nil {
+		t.Fatal(err)
+	}
+	side := snapshotSide(t, cfg.BucketLayout)
+
+	filename := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := SaveSnapshot(filename, cfg, side); err != nil {
+		t.Fatal(err)
+	}
+	loaded, layout, err := LoadSnapshot(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameLayout(layout, cfg.BucketLayout) {
+		t.Errorf("layout %v, want %v", layout, cfg.BucketLayout)
+	}
+	if !loaded.WindowStart.Equal(side.WindowStart) || !loaded.WindowEnd.Equal(side.WindowEnd) {
+		t.Errorf("window %v to %v, want %v to %v", loaded.WindowStart, loaded.WindowEnd, side.WindowStart, side.WindowEnd)
+	}
+	if !jsonEqual(t, convertSummary(&loaded.Summary), convertSummary(&side.Summary)) {
+		t.Errorf("summary changed in the round trip")
+	}
+
+	h, want := loaded.Histogram, side.Histogram
+	if h == nil {
+		t.Fatal("histogram not loaded")
+	}
+	if !sameLayout(h.Layout, want.Layout) || h.Interpolation != want.Interpolation {
+		t.Errorf("histogram layout %v with %s interpolation, want %v with %s", h.Layout, h.Interpolation, want.Layout, want.Interpolation)
+	}
+	if h.Stats.TotalMessages != want.Stats.TotalMessages || h.Stats.P99Rate != want.Stats.P99Rate || !jsonEqual(t, convertStats(h.Stats), convertStats(want.Stats)) {
+		t.Errorf("stats %+v, want %+v", h.Stats, want.Stats)
+	}
+	if !reflect.DeepEqual(h.Deletes, want.Deletes) || len(h.Gaps) != len(want.Gaps) {
+		t.Errorf("deletes %+v with %d gaps, want %+v with %d", h.Deletes, len(h.Gaps), want.Deletes, len(want.Gaps))
+	}
+
+	if len(h.Buckets) != len(want.Buckets) {
+		t.Fatalf("%d buckets, want %d", len(h.Buckets), len(want.Buckets))
+	}
+	for i, b := range h.Buckets {
+		w := want.Buckets[i]
+		if !b.Start.Equal(w.Start) || !b.End.Equal(w.End) || b.Count != w.Count || b.SeqCount != w.SeqCount || b.Rate != w.Rate || b.SeqRate != w.SeqRate || b.Throughput != w.Throughput {
+			t.Errorf("bucket %d = %+v, want %+v", i, b, w)
+		}
+		if !reflect.DeepEqual(b.SizeSketch, w.SizeSketch) {
+			t.Errorf("bucket %d size sketch %+v, want %+v", i, b.SizeSketch, w.SizeSketch)
+		}
+		if len(b.PerStream) != len(w.PerStream) {
+			t.Errorf("bucket %d has %d streams, want %d", i, len(b.PerStream), len(w.PerStream))
+		}
+		for name, data := range w.PerStream {
+			got := b.PerStream[name]
+			if got == nil || got.Count != data.Count || got.SeqCount != data.SeqCount || !reflect.DeepEqual(got.SizeSketch, data.SizeSketch) {
+				t.Errorf("bucket %d stream %s = %+v, want %+v", i, name, got, data)
+			}
+		}
+	}
+}
+
+func TestLoadSnapshotVersion(t *testing.T) {
+	cfg := Config{RateGranularity: "1m", BucketLayout: BucketLayout{Duration: time.Minute}}
+	filename := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := SaveSnapshot(filename, cfg, snapshotSide(t, cfg.BucketLayout)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot map[string]any
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	snapshot["version"] = snapshotVersion - 1
+	if data, err = json.Marshal(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := LoadSnapshot(filename); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("LoadSnapshot of an older version: %v, want a version error", err)
+	}
+}
@@ -21,8 +21,17 @@ type StreamInfo struct {
 	FirstTimestamp time.Time
 	LastTimestamp  time.Time
 	MsgCount       uint64
+	NumDeleted     int // interior deleted messages according to the stream state
+	// MaxMsgsPerSubject is the per-subject limit when reaching it removes older messages (0 = none)
+	MaxMsgsPerSubject int64
+	// SubjectCounts holds stored messages per subject, only loaded for streams with a
+	// per-subject limit and not too many subjects (nil otherwise)
+	SubjectCounts map[string]uint64
 }
 
+// maxSubjectCountsLoad is the most subjects for which per-subject counts are loaded from the stream state
+const maxSubjectCountsLoad = 100000
+
 // ConnectNATS establishes a connection to NATS using the specified context
 func ConnectNATS(contextName string) (*nats.Conn, jetstream.JetStream, error) {
 	nc, _, err := natscontext.Connect(contextName)
@@ -61,6 +70,23 @@ func GetLimitsStreams(ctx context.Context, js jetstream.JetStream, streamFilters
 			MsgCount:       info.State.Msgs,
 			FirstTimestamp: info.State.FirstTime,
 			LastTimestamp:  info.State.LastTime,
+			NumDeleted:     info.State.NumDeleted,
+		}
+
+		// Reaching the per-subject limit removes the oldest message of the subject, unless
+		// the stream is configured to reject new messages instead
+		perSubjectDiscardNew := info.Config.Discard == jetstream.DiscardNew && info.Config.DiscardNewPerSubject
+		if info.Config.MaxMsgsPerSubject > 0 && !perSubjectDiscardNew {
+			si.MaxMsgsPerSubject = info.Config.MaxMsgsPerSubject
+			if info.State.NumSubjects <= maxSubjectCountsLoad {
+				full, err := stream.Info(ctx, jetstream.WithSubjectFilter(">"))
+				if err != nil {
+					// Gap classification falls back to the fetched messages
+					fmt.Printf("Warning: failed to get subjects of stream %s: %v\n", si.Name, err)
+				} else {
+					si.SubjectCounts = full.State.Subjects
+				}
+			}
 		}
 
 		streamInfos = append(streamInfos, si)
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket that paces consumption to a fixed rate per second.
+// Consumption is recorded after the fact (the size of a batch is only known once it
+// has been received), so the bucket may go into debt; wait blocks until it is repaid.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // units per second (0 = unlimited)
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter for the given rate per second (nil if rate <= 0)
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  rate, // allow up to one second worth of burst
+		tokens: rate,
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last call, must be called with the lock held
+func (r *rateLimiter) refill() {
+	now := time.Now()
+	r.tokens = min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+}
+
+// wait blocks until the bucket is out of debt, returning how long it waited
+func (r *rateLimiter) wait(ctx context.Context) (time.Duration, error) {
+	if r == nil {
+		return 0, nil
+	}
+	var waited time.Duration
+	for {
+		r.mu.Lock()
+		r.refill()
+		deficit := -r.tokens
+		r.mu.Unlock()
+
+		if deficit <= 0 {
+			return waited, nil
+		}
+
+		delay := time.Duration(deficit / r.rate * float64(time.Second))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			waited += delay
+		case <-ctx.Done():
+			timer.Stop()
+			return waited, ctx.Err()
+		}
+	}
+}
+
+// consume records n units as used
+func (r *rateLimiter) consume(n float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.refill()
+	r.tokens -= n
+	r.mu.Unlock()
+}
+
+// FetchLoad summarizes the load the tool itself generated on the servers while fetching
+type FetchLoad struct {
+	Requests      int           // batch requests sent
+	Errors        int           // batch requests that failed
+	Messages      int           // messages received
+	Bytes         int64         // payload bytes received
+	RequestTime   time.Duration // cumulative time spent in batch requests
+	MaxLatency    time.Duration // slowest batch request
+	ThrottledTime time.Duration // cumulative time requests were held back by the rate limits
+	WallTime      time.Duration // elapsed time from the first to the last request
+	MinBatchSize  int           // smallest batch size used
+	MaxBatchSize  int           // largest batch size used
+	BatchShrinks  int           // times the adaptive batch size was reduced
+}
+
+// ThrottleOptions configures client-side pacing of batch requests
+type ThrottleOptions struct {
+	MaxMsgRate    float64       // messages per second (0 = unlimited)
+	MaxByteRate   float64       // bytes per second (0 = unlimited)
+	Adaptive      bool          // adapt the batch size to the observed request latency
+	TargetLatency time.Duration // batch latency above which the batch size is reduced
+	MinBatchSize  int           // lower bound for the adaptive batch size
+	MaxBatchSize  int           // upper bound (and starting point) for the batch size
+}
+
+// FetchThrottle paces batch requests and adapts their size so that fetching stays
+// friendly to the servers. It is shared by all concurrent fetchers and records
+// the load they generate.
+type FetchThrottle struct {
+	opts     ThrottleOptions
+	msgRate  *rateLimiter
+	byteRate *rateLimiter
+
+	mu        sync.Mutex
+	batchSize int
+	firstReq  time.Time
+	lastReq   time.Time
+	load      FetchLoad
+}
+
+// NewFetchThrottle creates a throttle from the given options
+func NewFetchThrottle(opts ThrottleOptions) *FetchThrottle {
+	if opts.MinBatchSize <= 0 {
+		opts.MinBatchSize = 1
+	}
+	if opts.MinBatchSize > opts.MaxBatchSize {
+		opts.MinBatchSize = opts.MaxBatchSize
+	}
+	return &FetchThrottle{
+		opts:      opts,
+		msgRate:   newRateLimiter(opts.MaxMsgRate),
+		byteRate:  newRateLimiter(opts.MaxByteRate),
+		batchSize: opts.MaxBatchSize,
+	}
+}
+
+// wait blocks until the rate limits allow another request
+func (t *FetchThrottle) wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	waitedMsgs, err := t.msgRate.wait(ctx)
+	if err != nil {
+		return err
+	}
+	waitedBytes, err := t.byteRate.wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.load.ThrottledTime += waitedMsgs + waitedBytes
+	t.mu.Unlock()
+	return nil
+}
+
+// BatchSize returns the batch size to use for the next request, capped at limit and at
+// one second worth of messages when the message rate is limited, so a single batch does
+// not burst past the limit
+func (t *FetchThrottle) BatchSize(limit int) int {
+	if t == nil {
+		return limit
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	size := min(t.batchSize, limit)
+	if t.opts.MaxMsgRate > 0 {
+		size = min(size, max(int(t.opts.MaxMsgRate), 1))
+	}
+	return size
+}
+
+// MaxBytes returns the payload bytes a single request may return, one second worth of
+// bytes when the byte rate is limited (0 = unlimited). The server always returns at least
+// one message.
+func (t *FetchThrottle) MaxBytes() int {
+	if t == nil || t.opts.MaxByteRate <= 0 {
+		return 0
+	}
+	return max(int(t.opts.MaxByteRate), 1)
+}
+
+// record accounts for a completed batch request and adapts the batch size
+func (t *FetchThrottle) record(start time.Time, batchSize, msgs int, bytes int64, failed bool) {
+	if t == nil {
+		return
+	}
+	latency := t.account(start, msgs, bytes, failed)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.load.MinBatchSize == 0 || batchSize < t.load.MinBatchSize {
+		t.load.MinBatchSize = batchSize
+	}
+	t.load.MaxBatchSize = max(t.load.MaxBatchSize, batchSize)
+
+	if !t.opts.Adaptive {
+		return
+	}
+
+	// Multiplicative decrease on errors or slow requests, gentle increase when requests are fast
+	switch {
+	case failed || (t.opts.TargetLatency > 0 && latency > t.opts.TargetLatency):
+		if t.batchSize > t.opts.MinBatchSize {
+			t.batchSize = max(t.opts.MinBatchSize, t.batchSize/2)
+			t.load.BatchShrinks++
+		}
+	case t.opts.TargetLatency <= 0 || latency < t.opts.TargetLatency/2:
+		t.batchSize = min(t.opts.MaxBatchSize, t.batchSize+max(t.batchSize/4, 1))
+	}
+}
+
+// probe accounts for a single message lookup such as finding the start sequence of a time
+// range. It counts towards the rate limits and the load, but not the batch sizes, and does
+// not adapt the batch size of the data fetch.
+func (t *FetchThrottle) probe(start time.Time, msgs int, bytes int64, failed bool) {
+	if t == nil {
+		return
+	}
+	t.account(start, msgs, bytes, failed)
+}
+
+// account consumes the rate limits for a completed request and adds it to the load,
+// returning its latency
+func (t *FetchThrottle) account(start time.Time, msgs int, bytes int64, failed bool) time.Duration {
+	t.msgRate.consume(float64(msgs))
+	t.byteRate.consume(float64(bytes))
+
+	end := time.Now()
+	latency := end.Sub(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.load.Requests == 0 || start.Before(t.firstReq) {
+		t.firstReq = start
+	}
+	if end.After(t.lastReq) {
+		t.lastReq = end
+	}
+	t.load.WallTime = t.lastReq.Sub(t.firstReq)
+
+	t.load.Requests++
+	t.load.Messages += msgs
+	t.load.Bytes += bytes
+	t.load.RequestTime += latency
+	t.load.MaxLatency = max(t.load.MaxLatency, latency)
+	if failed {
+		t.load.Errors++
+	}
+	return latency
+}
+
+// Load returns a snapshot of the load generated so far
+func (t *FetchThrottle) Load() FetchLoad {
+	if t == nil {
+		return FetchLoad{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.load
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// timestampLayouts are the absolute timestamp formats, tried in order
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// dateLayout is the layout of a plain date, which as the end of a range includes the whole day
+const dateLayout = "2006-01-02"
+
+// epochMillisFrom is the smallest epoch value read as milliseconds, in seconds it would be
+// after the year 5000
+const epochMillisFrom = 1e11
+
+// epochMinDigits is the fewest digits of an epoch timestamp, shorter numbers such as a
+// year are before 1973 as epoch seconds
+const epochMinDigits = 9
+
+// parseTimestamp parses an absolute or relative time expression:
+//   - RFC3339, 2006-01-02 15:04:05 or a shorter form of it
+//   - unix epoch seconds or milliseconds of at least 9 digits, e.g. 1760000000 or 1760000000000
+//   - now, now-2h or now+30m, durations may use d and w for days and weeks
+//   - today, yesterday, monday or last monday, optionally followed by a time such as 09:00
+//
+// An IANA timezone name may follow, e.g. "2026-10-01 09:00 Europe/Amsterdam", otherwise
+// timestamps without a UTC offset are taken to be in loc.
+func parseTimestamp(s string, loc *time.Location) (time.Time, error) {
+	return parseTimestampAt(s, loc, time.Now())
+}
+
+// parseTimestampAt parses a time expression with relative expressions based on now
+func parseTimestampAt(s string, loc *time.Location, now time.Time) (time.Time, error) {
+	expr := strings.TrimSpace(s)
+	if fields := strings.Fields(expr); len(fields) > 1 {
+		if tz, ok := timezoneField(fields[len(fields)-1]); ok {
+			loc = tz
+			expr = strings.Join(fields[:len(fields)-1], " ")
+		}
+	}
+
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, expr, loc); err == nil {
+			return t, nil
+		}
+	}
+	if t, ok, err := parseEpoch(expr); ok {
+		return t, err
+	}
+	if t, ok, err := parseRelative(expr, now); ok {
+		return t, err
+	}
+	if t, ok, err := parseDayExpression(expr, loc, now); ok {
+		return t, err
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse timestamp %q (use RFC3339, 2006-01-02 15:04:05, epoch seconds or milliseconds, now-2h, yesterday or last monday 09:00)", s)
+}
+
+// parseTimeRangeAt parses a time window given as START..END or START,DURATION, with relative
+// expressions based on now. A plain date as the end includes that whole day, so
+// 2026-10-01..2026-10-07 covers seven days.
+func parseTimeRangeAt(s string, loc *time.Location, now time.Time) (start, end time.Time, err error) {
+	if from, to, ok := strings.Cut(s, ".."); ok {
+		if start, err = parseTimestampAt(from, loc, now); err != nil {
+			return start, end, err
+		}
+		if end, err = parseTimestampAt(to, loc, now); err != nil {
+			return start, end, err
+		}
+		if day, err := time.ParseInLocation(dateLayout, strings.TrimSpace(to), loc); err == nil {
+			end = day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+	} else if from, length, ok := cutLast(s, ","); ok {
+		if start, err = parseTimestampAt(from, loc, now); err != nil {
+			return start, end, err
+		}
+		d, err := parseDuration(strings.TrimSpace(length))
+		if err != nil {
+			return start, end, fmt.Errorf("invalid window length %q: %w", length, err)
+		}
+		end = start.Add(d)
+	} else {
+		return start, end, fmt.Errorf("invalid time window %q (use START..END or START,DURATION)", s)
+	}
+
+	if !end.After(start) {
+		return start, end, fmt.Errorf("the time window %q must end after it starts", s)
+	}
+	return start, end, nil
+}
+
+// timezoneField returns the location named by the last field of an expression, fields
+// without letters such as times of day are never timezones
+func timezoneField(field string) (*time.Location, bool) {
+	if !strings.ContainsFunc(field, unicode.IsLetter) {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(field)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// parseEpoch parses unix epoch seconds, possibly fractional, or milliseconds. Numbers with
+// fewer digits than an epoch, such as a year, are an error.
+func parseEpoch(s string) (time.Time, bool, error) {
+	if s == "" || strings.Trim(s, "0123456789.") != "" {
+		return time.Time{}, false, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, false, nil
+	}
+	if whole, _, _ := strings.Cut(s, "."); len(whole) < epochMinDigits {
+		return time.Time{}, true, fmt.Errorf("invalid timestamp %q, epoch seconds or milliseconds need at least %d digits (use RFC3339, 2006-01-02, epoch seconds such as 1760000000, now-2h or yesterday)", s, epochMinDigits)
+	}
+	if v >= epochMillisFrom {
+		return time.UnixMilli(int64(v)), true, nil
+	}
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// parseRelative parses now, optionally followed by a duration to add or subtract
+func parseRelative(s string, now time.Time) (time.Time, bool, error) {
+	rest, ok := strings.CutPrefix(strings.ToLower(s), "now")
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return now, true, nil
+	}
+	if rest[0] != '-' && rest[0] != '+' {
+		return time.Time{}, false, nil
+	}
+	d, err := parseDuration(strings.TrimSpace(rest[1:]))
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("invalid relative time %q: %w", s, err)
+	}
+	if rest[0] == '-' {
+		d = -d
+	}
+	return now.Add(d), true, nil
+}
+
+// parseDayExpression parses today, yesterday, a weekday or last followed by a weekday, with
+// an optional time of day. A weekday is the most recent one, today included; last skips today.
+func parseDayExpression(s string, loc *time.Location, now time.Time) (time.Time, bool, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return time.Time{}, false, nil
+	}
+
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	var day time.Time
+	switch {
+	case fields[0] == "today":
+		day = today
+	case fields[0] == "yesterday":
+		day = today.AddDate(0, 0, -1)
+	case fields[0] == "last" && len(fields) > 1:
+		wd, ok := parseWeekday(fields[1])
+		if !ok {
+			return time.Time{}, false, nil
+		}
+		back := (int(today.Weekday()) - int(wd) + 7) % 7
+		if back == 0 {
+			back = 7
+		}
+		day = today.AddDate(0, 0, -back)
+		fields = fields[1:]
+	default:
+		wd, ok := parseWeekday(fields[0])
+		if !ok {
+			return time.Time{}, false, nil
+		}
+		day = today.AddDate(0, 0, -((int(today.Weekday()) - int(wd) + 7) % 7))
+	}
+
+	switch len(fields) {
+	case 1:
+		return day, true, nil
+	case 2:
+		for _, layout := range []string{"15:04:05", "15:04"} {
+			if t, err := time.Parse(layout, fields[1]); err == nil {
+				return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), true, nil
+			}
+		}
+		return time.Time{}, true, fmt.Errorf("invalid time of day %q in %q (use 15:04 or 15:04:05)", fields[1], s)
+	}
+	return time.Time{}, true, fmt.Errorf("unexpected %q after the day in %q", strings.Join(fields[2:], " "), s)
+}
+
+// parseWeekday parses a weekday name, full or abbreviated to three letters
+func parseWeekday(s string) (time.Weekday, bool) {
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if s == name || s == name[:3] {
+			return wd, true
+		}
+	}
+	return 0, false
+}
+
+// parseDuration parses a duration that may also use d for days and w for weeks, e.g. 7d or 1w2d12h
+func parseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for {
+		i := strings.IndexAny(rest, "dw")
+		if i <= 0 {
+			break
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			break
+		}
+		unit := 24 * time.Hour
+		if rest[i] == 'w' {
+			unit *= 7
+		}
+		total += time.Duration(n) * unit
+		rest = rest[i+1:]
+	}
+	if rest == "" && rest != s {
+		return total, nil
+	}
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (use e.g. 30m, 2h or 7d)", s)
+	}
+	return total + d, nil
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// timespecNow is the base of the relative expressions in the tests, a Sunday
+var timespecNow = time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC)
+
+func TestParseTimestampAt(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"2026-10-01T09:00:00+02:00", time.UTC, time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC)},
+		{"2026-10-01 09:00:00", time.UTC, time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)},
+		{"2026-10-01T09:00:00", time.UTC, time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)},
+		{"2026-10-01 09:00", amsterdam, time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC)},
+		{"2026-10-01", time.UTC, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"2026-10-01 09:00 Europe/Amsterdam", time.UTC, time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC)},
+		{"1760000000", time.UTC, time.Unix(1760000000, 0)},
+		{"1760000000.5", time.UTC, time.Unix(1760000000, 5e8)},
+		{"1760000000123", time.UTC, time.UnixMilli(1760000000123)},
+		{"now", time.UTC, timespecNow},
+		{"now-2h", time.UTC, timespecNow.Add(-2 * time.Hour)},
+		{"now+30m", time.UTC, timespecNow.Add(30 * time.Minute)},
+		{"now-7d", time.UTC, timespecNow.AddDate(0, 0, -7)},
+		{"now-1w2d", time.UTC, timespecNow.AddDate(0, 0, -9)},
+		{"today", time.UTC, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.UTC, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"yesterday 09:30", amsterdam, time.Date(2026, 10, 17, 7, 30, 0, 0, time.UTC)},
+		{"sunday", time.UTC, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"last sunday", time.UTC, time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC)},
+		{"monday", time.UTC, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{"last monday 09:00", time.UTC, time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC)},
+		{"last Mon 09:00:30", time.UTC, time.Date(2026, 10, 12, 9, 0, 30, 0, time.UTC)},
+		{"last monday 09:00 Europe/Amsterdam", time.UTC, time.Date(2026, 10, 12, 7, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimestampAt(tt.expr, tt.loc, timespecNow)
+		if err != nil {
+			t.Errorf("parseTimestampAt(%q): %v", tt.expr, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTimestampAt(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimestampAtErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"2026",
+		"20261001",
+		"12345.5",
+		"bogus",
+		"now*2h",
+		"now-2x",
+		"yesterday 25:00",
+		"last monday 09:00 extra",
+	} {
+		if got, err := parseTimestampAt(expr, time.UTC, timespecNow); err == nil {
+			t.Errorf("parseTimestampAt(%q) = %v, want an error", expr, got)
+		}
+	}
+}
+
+func TestParseTimeRangeAt(t *testing.T) {
+	tests := []struct {
+		expr       string
+		start, end time.Time
+	}{
+		{"2026-10-01..2026-10-07", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 8, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)},
+		{"2026-10-01 09:00..2026-10-01 17:00", time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 17, 0, 0, 0, time.UTC)},
+		{"now-2h..now", timespecNow.Add(-2 * time.Hour), timespecNow},
+		{"yesterday..today", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"2026-10-01 09:00,2h", time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 11, 0, 0, 0, time.UTC)},
+		{"last monday,1w", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"1760000000..1760003600", time.Unix(1760000000, 0), time.Unix(1760003600, 0)},
+	}
+
+	for _, tt := range tests {
+		start, end, err := parseTimeRangeAt(tt.expr, time.UTC, timespecNow)
+		if err != nil {
+			t.Errorf("parseTimeRangeAt(%q): %v", tt.expr, err)
+			continue
+		}
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("parseTimeRangeAt(%q) = %v..%v, want %v..%v", tt.expr, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseTimeRangeAtErrors(t *testing.T) {
+	for _, expr := range []string{
+		"2026-10-01",
+		"now..now-1h",
+		"2026-10-02..2026-10-01",
+		"2026-10-01,bogus",
+		"2026..now",
+	} {
+		if _, _, err := parseTimeRangeAt(expr, time.UTC, timespecNow); err == nil {
+			t.Errorf("parseTimeRangeAt(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestTimezoneField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string // location name, empty if not a timezone
+	}{
+		{"Europe/Amsterdam", "Europe/Amsterdam"},
+		{"America/Argentina/Buenos_Aires", "America/Argentina/Buenos_Aires"},
+		{"UTC", "UTC"},
+		{"15:04", ""},
+		{"2026-10-18", ""},
+		{"+02:00", ""},
+		{"[_]", ""},
+		{"Mars/Olympus", ""},
+	}
+
+	for _, tt := range tests {
+		loc, ok := timezoneField(tt.field)
+		if ok != (tt.want != "") || ok && loc.String() != tt.want {
+			t.Errorf("timezoneField(%q) = %v, %v, want %q", tt.field, loc, ok, tt.want)
+		}
+	}
+}
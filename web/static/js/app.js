@@ -7,6 +7,7 @@
     let currentStream = '';
     let rateChart = null;
     let throughputChart = null;
+    let sizeClassChart = null;
     let summaryData = null;
     let histogramData = null;
     let fullTimeRange = { min: null, max: null };  // Original time range for reset
@@ -19,6 +20,14 @@
     let showInterpolatedDeletes = true;            // Toggle for interpolated deletes series
     let useAverageDownsampling = false;            // Toggle for average vs max downsampling
     let useLogScale = false;                       // Toggle for logarithmic y-axis scale
+    let interpolationStrategy = '';                // Delete interpolation strategy ('' = server default)
+    let displayTimeZone = undefined;               // IANA timezone of the report (undefined = browser local)
+    let anomalies = [];                            // Anomalies of the current stream, drawn on the rate chart
+    let showAnomalies = true;                      // Toggle for anomaly markers
+    let forecastData = null;                       // Forecast of the current stream, null when not forecasting
+    let showForecast = true;                       // Toggle for the forecast extension of the charts
+    let advisoryEvents = [];                       // Advisories of the current stream, drawn on the rate chart
+    let showAdvisories = true;                     // Toggle for advisory markers
 
     // Transform value for log scale: apply log10, keep zero as zero
     function logTransform(v) {
@@ -33,6 +42,16 @@
     }
 
     // Formatters
+    // Escape text from the server, such as error descriptions, before putting it in HTML
+    function escapeHtml(text) {
+        return String(text)
+            .replace(/&/g, '&amp;')
+            .replace(/</g, '&lt;')
+            .replace(/>/g, '&gt;')
+            .replace(/"/g, '&quot;')
+            .replace(/'/g, '&#39;');
+    }
+
     function formatNumber(n) {
         if (n >= 1e9) return (n / 1e9).toFixed(2) + 'B';
         if (n >= 1e6) return (n / 1e6).toFixed(2) + 'M';
@@ -64,12 +83,13 @@
 
     function formatTimestamp(ts) {
         const d = new Date(ts);
-        return d.toLocaleString();
+        return d.toLocaleString(undefined, { timeZone: displayTimeZone });
     }
 
     function formatTimestampShort(ts) {
         const d = new Date(ts);
         return d.toLocaleString(undefined, {
+            timeZone: displayTimeZone,
             month: 'short',
             day: 'numeric',
             hour: '2-digit',
@@ -99,7 +119,8 @@
             const bucketText = formatBucketDuration(granularityNs);
             text = `(${durationText}, downsampled to 5000 buckets of duration ${bucketText})`;
         } else {
-            text = `(${durationText}, peaks preserved)`;
+            const bucketText = summaryData && summaryData.granularity ? `${summaryData.granularity} buckets, ` : '';
+            text = `(${durationText}, ${bucketText}peaks preserved)`;
         }
         document.getElementById('rate-bucket-size').textContent = text;
         document.getElementById('throughput-bucket-size').textContent = text;
@@ -290,6 +311,10 @@
                 url += (url.includes('?') ? '&' : '?') + 'downsample=avg';
             }
 
+            if (interpolationStrategy) {
+                url += (url.includes('?') ? '&' : '?') + `interpolation=${encodeURIComponent(interpolationStrategy)}`;
+            }
+
             const data = await fetchJSON(url, { signal: currentAbortController.signal });
 
             // Check if this response is still relevant (no newer request has started)
@@ -314,18 +339,12 @@
             try {
                 // Update rate chart data
                 if (rateChart) {
-                    const timestamps = data.buckets.map(b => new Date(b.start).getTime() / 1000);
-                    const storedRates = data.buckets.map(b => logTransform(b.rate));
-                    const totalRates = data.buckets.map(b => logTransform(b.seq_rate));
-                    const deletedRates = data.buckets.map(b => logTransform(b.seq_rate - b.rate));
-                    rateChart.setData([timestamps, storedRates, totalRates, deletedRates]);
+                    rateChart.setData(rateChartData(data));
                 }
 
                 // Update throughput chart data
                 if (throughputChart) {
-                    const timestamps = data.buckets.map(b => new Date(b.start).getTime() / 1000);
-                    const throughputs = data.buckets.map(b => logTransform(b.throughput));
-                    throughputChart.setData([timestamps, throughputs]);
+                    throughputChart.setData(throughputChartData(data));
                 }
 
                 // Update statistics from the API response
@@ -334,6 +353,7 @@
                     updateRateStats(data.stats);
                     updateThroughputStats(data.stats);
                 }
+                updateSizes(data);
 
                 // Update bucket size indicator
                 if (data.granularity_ns && data.stats) {
@@ -383,6 +403,17 @@
     // Toggle logarithmic scale and rebuild charts
     function toggleLogScale(enabled) {
         useLogScale = enabled;
+        rebuildCharts();
+    }
+
+    // Toggle the forecast extension and rebuild charts
+    function toggleForecast(show) {
+        showForecast = show;
+        rebuildCharts();
+    }
+
+    // Recreate both charts from the current data, keeping the zoom
+    function rebuildCharts() {
         if (histogramData) {
             // Prevent zoom handler from firing during chart rebuild
             isUpdatingData = true;
@@ -420,12 +451,246 @@
             deleted: '#ff6b6b',
             total: '#ffd93d',
             throughput: '#a78bfa',
+            spike: '#ff9f43',
+            drop: '#8395a7',
+            levelShift: '#54a0ff',
+            baseline: '#c8d6e5',
+            forecast: '#feca57',
+            advisories: {
+                'api-error': '#ee5253',
+                'max-deliver': '#ff9ff3',
+                'leader-elected': '#48dbfb',
+                'stream-created': '#1dd1a1',
+                'stream-deleted': '#c8d6e5'
+            },
             grid: 'rgba(255,255,255,0.1)',
             axis: 'rgba(255,255,255,0.5)',
             text: '#a0a0a0'
         };
     }
 
+    // Draw anomaly markers on the rate chart: shaded spans for spikes and drops,
+    // dashed vertical lines for level shifts
+    function drawAnomalyMarkers(u) {
+        if (!showAnomalies || anomalies.length === 0) return;
+
+        const colors = getChartColors();
+        const { ctx } = u;
+        const { left, top, width, height } = u.bbox;
+
+        ctx.save();
+        ctx.beginPath();
+        ctx.rect(left, top, width, height);
+        ctx.clip();
+
+        for (const a of anomalies) {
+            const x0 = u.valToPos(new Date(a.start).getTime() / 1000, 'x', true);
+            if (a.kind === 'level-shift') {
+                ctx.strokeStyle = colors.levelShift;
+                ctx.lineWidth = 2 * devicePixelRatio;
+                ctx.setLineDash([6 * devicePixelRatio, 4 * devicePixelRatio]);
+                ctx.beginPath();
+                ctx.moveTo(x0, top);
+                ctx.lineTo(x0, top + height);
+                ctx.stroke();
+                continue;
+            }
+            const x1 = u.valToPos(new Date(a.end).getTime() / 1000, 'x', true);
+            const color = a.kind === 'spike' ? colors.spike : colors.drop;
+            ctx.fillStyle = color + '40';
+            ctx.fillRect(x0, top, Math.max(x1 - x0, 2 * devicePixelRatio), height);
+            ctx.fillStyle = color;
+            ctx.fillRect(x0, top, Math.max(x1 - x0, 2 * devicePixelRatio), 4 * devicePixelRatio);
+        }
+
+        ctx.restore();
+    }
+
+    // Labels of the advisory kinds, in the order of their marker rows from the bottom up
+    const advisoryLabels = {
+        'api-error': 'API errors',
+        'max-deliver': 'Max deliveries exceeded',
+        'leader-elected': 'Leader elections',
+        'stream-created': 'Streams created',
+        'stream-deleted': 'Streams deleted'
+    };
+
+    // Draw advisory markers on the rate chart: a tick per advisory along the bottom, one row per kind
+    function drawAdvisoryMarkers(u) {
+        if (!showAdvisories || advisoryEvents.length === 0) return;
+
+        const colors = getChartColors();
+        const kinds = Object.keys(advisoryLabels);
+        const { ctx } = u;
+        const { left, top, width, height } = u.bbox;
+        const tick = 6 * devicePixelRatio;
+
+        ctx.save();
+        ctx.beginPath();
+        ctx.rect(left, top, width, height);
+        ctx.clip();
+        ctx.lineWidth = 2 * devicePixelRatio;
+
+        for (const e of advisoryEvents) {
+            const row = kinds.indexOf(e.kind);
+            if (row < 0) continue;
+            const x = u.valToPos(new Date(e.time).getTime() / 1000, 'x', true);
+            const y = top + height - row * tick;
+            ctx.strokeStyle = colors.advisories[e.kind];
+            ctx.beginPath();
+            ctx.moveTo(x, y);
+            ctx.lineTo(x, y - tick + devicePixelRatio);
+            ctx.stroke();
+        }
+
+        ctx.restore();
+    }
+
+    // Count the advisories of each kind in a bucket
+    function advisoriesAt(bucketStartMs, bucketEndMs) {
+        const counts = {};
+        for (const e of advisoryEvents) {
+            const t = new Date(e.time).getTime();
+            if (t >= bucketStartMs && t < bucketEndMs) {
+                counts[e.kind] = (counts[e.kind] || 0) + 1;
+            }
+        }
+        return counts;
+    }
+
+    // Load the advisories of a stream, the advisory control and section stay hidden without an advisory stream
+    async function loadAdvisories(stream) {
+        const control = document.getElementById('advisories-control');
+        const indicator = document.getElementById('advisory-count');
+        const section = document.getElementById('advisories-section');
+        let data = null;
+        try {
+            const url = stream ? `/api/advisories?stream=${encodeURIComponent(stream)}` : '/api/advisories';
+            data = await fetchJSON(url);
+        } catch (err) {
+            data = null;
+        }
+        advisoryEvents = data ? data.events : [];
+        if (control) control.style.display = data ? '' : 'none';
+        if (indicator) indicator.textContent = data ? `(${formatNumber(advisoryEvents.length + data.omitted)})` : '';
+        if (section) {
+            section.style.display = data ? 'block' : 'none';
+            if (data) renderAdvisories(document.getElementById('advisories-content'), data);
+        }
+        if (rateChart) {
+            rateChart.redraw(false);
+        }
+    }
+
+    function toggleAdvisories(show) {
+        showAdvisories = show;
+        if (rateChart) {
+            rateChart.redraw(false);
+        }
+    }
+
+    // Render the advisory totals, the ack latency histogram and the most frequent errors
+    function renderAdvisories(container, data) {
+        if (!container) return;
+        const colors = getChartColors();
+        const stat = (label, value) => `<tr><td>${label}</td><td>${value}</td></tr>`;
+
+        let html = '<table class="stats-table">';
+        for (const [kind, label] of Object.entries(advisoryLabels)) {
+            html += stat(`<span style="color:${colors.advisories[kind]}">${label}</span>`, formatNumber(data.totals[kind] || 0));
+        }
+        const lat = data.ack_latency;
+        html += stat('Ack samples', formatNumber(lat.count));
+        if (lat.count > 0) {
+            html += stat('Ack latency avg / P50 / P90 / P99 / max',
+                [lat.avg_ns, lat.p50_ns, lat.p90_ns, lat.p99_ns, lat.max_ns].map(formatIntervalNs).join(' / '));
+        }
+        html += '</table>';
+        if (data.omitted > 0) {
+            html += `<p class="chart-hint">${formatNumber(data.omitted)} later advisories not marked on the chart</p>`;
+        }
+
+        if (lat.count > 0) {
+            html += '<h3 class="correlation-heading">Ack latency</h3><div class="distribution-list">';
+            const maxCount = Math.max(...data.ack_bins.map(b => b.count), 0);
+            for (const bin of data.ack_bins) {
+                const barWidth = maxCount > 0 ? (bin.count / maxCount * 100) : 0;
+                html += `
+                    <div class="distribution-item">
+                        <div class="stream-name">${escapeHtml(bin.key)}</div>
+                        <div class="bar-container">
+                            <div class="bar" style="width: ${barWidth}%"></div>
+                        </div>
+                        <div class="stream-stats">
+                            <span class="msg-count">${formatNumber(bin.count)}</span> (${(bin.count / lat.count * 100).toFixed(1)}%)
+                        </div>
+                    </div>
+                `;
+            }
+            html += '</div>';
+        }
+
+        const counts = (title, items) => {
+            if (!items || items.length === 0) return '';
+            let table = `<h3 class="correlation-heading">${title}</h3><table class="compare-table"><tbody>`;
+            items.forEach(c => {
+                table += `<tr><td>${formatNumber(c.count)}</td><td>${escapeHtml(c.key)}</td></tr>`;
+            });
+            return table + '</tbody></table>';
+        };
+        html += counts('Most frequent API errors', data.top_errors);
+        html += counts('Consumers exceeding max deliveries', data.top_max_deliver);
+
+        container.innerHTML = html;
+    }
+
+    // Find the anomalies overlapping a bucket, level shifts match the bucket they start in
+    function anomaliesAt(bucketStartMs, bucketEndMs) {
+        return anomalies.filter(a => {
+            const start = new Date(a.start).getTime();
+            const end = a.kind === 'level-shift' ? start + 1 : new Date(a.end).getTime();
+            return start < bucketEndMs && end > bucketStartMs;
+        });
+    }
+
+    function describeAnomaly(a) {
+        switch (a.kind) {
+            case 'spike':
+                return `Spike to ${formatNumber(a.rate)} msg/s (baseline ${formatNumber(a.baseline)})`;
+            case 'drop':
+                return `Drop to zero (baseline ${formatNumber(a.baseline)} msg/s)`;
+            default:
+                return `Level shift from ${formatNumber(a.baseline)} to ${formatNumber(a.rate)} msg/s`;
+        }
+    }
+
+    async function loadAnomalies(stream) {
+        const indicator = document.getElementById('anomaly-count');
+        try {
+            const url = stream ? `/api/anomalies?stream=${encodeURIComponent(stream)}` : '/api/anomalies';
+            const data = await fetchJSON(url);
+            anomalies = data.anomalies || [];
+            if (indicator) {
+                indicator.textContent = `(${anomalies.length})`;
+                indicator.title = `Against a rolling ${data.window} bucket median, flagged beyond ${data.threshold} MADs`;
+            }
+        } catch (err) {
+            console.error('Failed to load anomalies:', err);
+            anomalies = [];
+            if (indicator) indicator.textContent = '';
+        }
+        if (rateChart) {
+            rateChart.redraw(false);
+        }
+    }
+
+    function toggleAnomalies(show) {
+        showAnomalies = show;
+        if (rateChart) {
+            rateChart.redraw(false);
+        }
+    }
+
     // Shared tooltip elements
     let rateTooltip = null;
     let throughputTooltip = null;
@@ -440,9 +705,43 @@
 
         const colors = getChartColors();
         const ts = rateChart.data[0][idx];
+
+        // Past the last bucket only the forecast has values
+        if (rateChart.data[1][idx] == null) {
+            const f = rateChart._forecastIdx;
+            rateTooltip.innerHTML = `
+                <div class="tooltip-time">${formatTimestampShort(ts * 1000)}</div>
+                <div class="tooltip-row"><span style="color:${colors.forecast}">Forecast:</span> ${formatNumber(logInverse(rateChart.data[f][idx]))} msg/s</div>
+                <div class="tooltip-row">95% interval: ${formatNumber(logInverse(rateChart.data[f + 1][idx]))} - ${formatNumber(logInverse(rateChart.data[f + 2][idx]))} msg/s</div>
+            `;
+            positionTooltip(rateTooltip, chartRect.left + cursorLeft, chartRect.top + cursorTop);
+            return;
+        }
+
         const stored = logInverse(rateChart.data[1][idx]);
         const total = logInverse(rateChart.data[2][idx]);
         const deleted = logInverse(rateChart.data[3][idx]);
+        const baselineHtml = rateChart._baselineIdx
+            ? `<div class="tooltip-row"><span style="color:${colors.baseline}">Baseline:</span> ${formatNumber(logInverse(rateChart.data[rateChart._baselineIdx][idx]))} msg/s</div>`
+            : '';
+
+        let anomalyHtml = '';
+        if (showAnomalies && histogramData && histogramData.buckets && histogramData.buckets[idx]) {
+            const bucket = histogramData.buckets[idx];
+            const colorOf = { 'spike': colors.spike, 'drop': colors.drop, 'level-shift': colors.levelShift };
+            anomalyHtml = anomaliesAt(new Date(bucket.start).getTime(), new Date(bucket.end).getTime())
+                .map(a => `<div class="tooltip-row"><span style="color:${colorOf[a.kind]}">${describeAnomaly(a)}</span></div>`)
+                .join('');
+        }
+
+        let advisoryHtml = '';
+        if (showAdvisories && advisoryEvents.length > 0 && histogramData && histogramData.buckets && histogramData.buckets[idx]) {
+            const bucket = histogramData.buckets[idx];
+            const counts = advisoriesAt(new Date(bucket.start).getTime(), new Date(bucket.end).getTime());
+            advisoryHtml = Object.entries(counts)
+                .map(([kind, n]) => `<div class="tooltip-row"><span style="color:${colors.advisories[kind]}">${advisoryLabels[kind]}:</span> ${formatNumber(n)}</div>`)
+                .join('');
+        }
 
         let streamsHtml = '';
         // Show per-stream activity when viewing combined (all streams)
@@ -450,7 +749,7 @@
             const bucket = histogramData.buckets[idx];
             const perStream = bucket.per_stream;
             if (perStream) {
-                const granularitySecs = histogramData.granularity_ns / 1e9;
+                const bucketSecs = (new Date(bucket.end) - new Date(bucket.start)) / 1000;
                 const streamEntries = Object.entries(perStream)
                     .filter(([_, data]) => data.seq_count > 0)
                     .sort((a, b) => b[1].seq_count - a[1].seq_count);
@@ -459,8 +758,8 @@
                     const maxToShow = 8;
                     for (let i = 0; i < Math.min(streamEntries.length, maxToShow); i++) {
                         const [name, data] = streamEntries[i];
-                        const storedRate = data.count / granularitySecs;
-                        streamsHtml += `<div class="tooltip-stream-row"><span class="tooltip-stream-name">${name}:</span> <span class="tooltip-stream-values"><span style="color:${colors.stored}">${formatNumber(storedRate)}</span></span></div>`;
+                        const storedRate = data.count / bucketSecs;
+                        streamsHtml += `<div class="tooltip-stream-row"><span class="tooltip-stream-name">${escapeHtml(name)}:</span> <span class="tooltip-stream-values"><span style="color:${colors.stored}">${formatNumber(storedRate)}</span></span></div>`;
                     }
                     if (streamEntries.length > maxToShow) {
                         streamsHtml += `<div class="tooltip-stream-more">+${streamEntries.length - maxToShow} more</div>`;
@@ -475,19 +774,24 @@
             <div class="tooltip-row"><span style="color:${colors.stored}">Stored:</span> ${formatNumber(stored)} msg/s</div>
             <div class="tooltip-row"><span style="color:${colors.total}">Stored + Deleted:</span> ${formatNumber(total)} msg/s</div>
             <div class="tooltip-row"><span style="color:${colors.deleted}">Deleted:</span> ${formatNumber(deleted)} msg/s</div>
+            ${baselineHtml}
+            ${anomalyHtml}
+            ${advisoryHtml}
             ${streamsHtml}
         `;
 
-        const left = chartRect.left + cursorLeft;
-        const top = chartRect.top + cursorTop;
+        positionTooltip(rateTooltip, chartRect.left + cursorLeft, chartRect.top + cursorTop);
+    }
 
-        rateTooltip.style.display = 'block';
-        rateTooltip.style.left = (left + 15) + 'px';
-        rateTooltip.style.top = (top - 10) + 'px';
+    // Show a tooltip next to the cursor, flipping it left at the window edge
+    function positionTooltip(tooltip, left, top) {
+        tooltip.style.display = 'block';
+        tooltip.style.left = (left + 15) + 'px';
+        tooltip.style.top = (top - 10) + 'px';
 
-        const tooltipRect = rateTooltip.getBoundingClientRect();
+        const tooltipRect = tooltip.getBoundingClientRect();
         if (tooltipRect.right > window.innerWidth) {
-            rateTooltip.style.left = (left - tooltipRect.width - 15) + 'px';
+            tooltip.style.left = (left - tooltipRect.width - 15) + 'px';
         }
     }
 
@@ -501,7 +805,23 @@
 
         const colors = getChartColors();
         const ts = throughputChart.data[0][idx];
+
+        // Past the last bucket only the forecast has values
+        if (throughputChart.data[1][idx] == null) {
+            const f = throughputChart._forecastIdx;
+            throughputTooltip.innerHTML = `
+                <div class="tooltip-time">${formatTimestampShort(ts * 1000)}</div>
+                <div class="tooltip-row"><span style="color:${colors.forecast}">Forecast:</span> ${formatBytes(logInverse(throughputChart.data[f][idx]))}/s</div>
+                <div class="tooltip-row">95% interval: ${formatBytes(logInverse(throughputChart.data[f + 1][idx]))}/s - ${formatBytes(logInverse(throughputChart.data[f + 2][idx]))}/s</div>
+            `;
+            positionTooltip(throughputTooltip, chartRect.left + cursorLeft, chartRect.top + cursorTop);
+            return;
+        }
+
         const tput = logInverse(throughputChart.data[1][idx]);
+        const baselineHtml = throughputChart._baselineIdx
+            ? `<div class="tooltip-row"><span style="color:${colors.baseline}">Baseline:</span> ${formatBytes(logInverse(throughputChart.data[throughputChart._baselineIdx][idx]))}/s</div>`
+            : '';
 
         let streamsHtml = '';
         // Show per-stream activity when viewing combined (all streams)
@@ -517,7 +837,7 @@
                     const maxToShow = 5;
                     for (let i = 0; i < Math.min(streamEntries.length, maxToShow); i++) {
                         const [name, data] = streamEntries[i];
-                        streamsHtml += `<div class="tooltip-stream-row">${name}: ${formatBytes(data.bytes)}</div>`;
+                        streamsHtml += `<div class="tooltip-stream-row">${escapeHtml(name)}: ${formatBytes(data.bytes)}</div>`;
                     }
                     if (streamEntries.length > maxToShow) {
                         streamsHtml += `<div class="tooltip-stream-more">+${streamEntries.length - maxToShow} more</div>`;
@@ -530,20 +850,11 @@
         throughputTooltip.innerHTML = `
             <div class="tooltip-time">${formatTimestampShort(ts * 1000)}</div>
             <div class="tooltip-row"><span style="color:${colors.throughput}">Throughput:</span> ${formatBytes(tput)}/s</div>
+            ${baselineHtml}
             ${streamsHtml}
         `;
 
-        const left = chartRect.left + cursorLeft;
-        const top = chartRect.top + cursorTop;
-
-        throughputTooltip.style.display = 'block';
-        throughputTooltip.style.left = (left + 15) + 'px';
-        throughputTooltip.style.top = (top - 10) + 'px';
-
-        const tooltipRect = throughputTooltip.getBoundingClientRect();
-        if (tooltipRect.right > window.innerWidth) {
-            throughputTooltip.style.left = (left - tooltipRect.width - 15) + 'px';
-        }
+        positionTooltip(throughputTooltip, chartRect.left + cursorLeft, chartRect.top + cursorTop);
     }
 
     function updateBothTooltips(idx) {
@@ -557,7 +868,7 @@
         if (rateChart && rateTooltip) {
             const rateRect = rateChart.over.getBoundingClientRect();
             const rateCursorLeft = rateChart.valToPos(rateChart.data[0][idx], 'x');
-            const rateCursorTop = rateChart.valToPos(rateChart.data[1][idx], 'y');
+            const rateCursorTop = rateChart.valToPos(rateChart.data[1][idx] ?? rateChart.data[rateChart._forecastIdx][idx], 'y');
             updateRateTooltip(idx, rateCursorLeft, rateCursorTop, rateRect);
         }
 
@@ -565,11 +876,132 @@
         if (throughputChart && throughputTooltip) {
             const tputRect = throughputChart.over.getBoundingClientRect();
             const tputCursorLeft = throughputChart.valToPos(throughputChart.data[0][idx], 'x');
-            const tputCursorTop = throughputChart.valToPos(throughputChart.data[1][idx], 'y');
+            const tputCursorTop = throughputChart.valToPos(throughputChart.data[1][idx] ?? throughputChart.data[throughputChart._forecastIdx][idx], 'y');
             updateThroughputTooltip(idx, tputCursorLeft, tputCursorTop, tputRect);
         }
     }
 
+    // Whether the histogram carries the baseline series of a comparison
+    function hasBaseline(data) {
+        return data.buckets.length > 0 && data.buckets[0].baseline_rate !== undefined;
+    }
+
+    // Dashed series overlaying the baseline of a comparison, shifted onto the current window
+    function baselineSeries(label, format) {
+        return {
+            label: label,
+            stroke: getChartColors().baseline,
+            width: 1.5,
+            dash: [6, 4],
+            points: { show: false },
+            value: (u, v) => v == null ? '-' : format(logInverse(v))
+        };
+    }
+
+    // Whether the charts are extended with the forecast
+    function hasForecast() {
+        return showForecast && forecastData !== null && forecastData.points.length > 0;
+    }
+
+    // Forecast points past the last bucket and within the zoomed range
+    function visibleForecastPoints(data) {
+        if (!hasForecast()) return [];
+        const lastStart = new Date(data.buckets[data.buckets.length - 1].start).getTime() / 1000;
+        return forecastData.points.filter(p => {
+            const start = new Date(p.start).getTime() / 1000;
+            return start > lastStart && (currentZoom.max === null || start <= currentZoom.max);
+        });
+    }
+
+    // Dashed forecast series with its interval bounds, the band between them is filled
+    function forecastSeries(format) {
+        const color = getChartColors().forecast;
+        const value = (u, v) => v == null ? '-' : format(logInverse(v));
+        return [
+            { label: 'Forecast', stroke: color, width: 2, dash: [8, 4], points: { show: false }, value },
+            { label: '95% Low', stroke: color + '80', width: 1, dash: [2, 4], points: { show: false }, value },
+            { label: '95% High', stroke: color + '80', width: 1, dash: [2, 4], points: { show: false }, value }
+        ];
+    }
+
+    // Append the forecast to chart data: its timestamps with gaps in the actual series, and
+    // forecast, low and high columns starting at the last actual value so the lines connect
+    function appendForecast(chartData, data, forecastCols, last) {
+        const points = visibleForecastPoints(data);
+        const n = data.buckets.length;
+        for (let i = 1; i < chartData.length; i++) {
+            chartData[i] = chartData[i].concat(new Array(points.length).fill(null));
+        }
+        chartData[0] = chartData[0].concat(points.map(p => new Date(p.start).getTime() / 1000));
+        forecastCols.forEach(field => {
+            const col = new Array(n).fill(null);
+            if (points.length > 0) col[n - 1] = logTransform(last);
+            chartData.push(col.concat(points.map(p => logTransform(p[field]))));
+        });
+    }
+
+    // Rate chart columns: stored, stored + deleted and deleted, then the baseline and
+    // forecast when shown
+    function rateChartData(data) {
+        const chartData = [
+            data.buckets.map(b => new Date(b.start).getTime() / 1000),
+            data.buckets.map(b => logTransform(b.rate)),
+            data.buckets.map(b => logTransform(b.seq_rate)),
+            data.buckets.map(b => logTransform(b.seq_rate - b.rate))
+        ];
+        if (hasBaseline(data)) {
+            chartData.push(data.buckets.map(b => logTransform(b.baseline_rate)));
+        }
+        if (hasForecast()) {
+            const last = data.buckets[data.buckets.length - 1].rate;
+            appendForecast(chartData, data, ['rate', 'rate_low', 'rate_high'], last);
+        }
+        return chartData;
+    }
+
+    // Throughput chart columns: throughput, then the baseline and forecast when shown
+    function throughputChartData(data) {
+        const chartData = [
+            data.buckets.map(b => new Date(b.start).getTime() / 1000),
+            data.buckets.map(b => logTransform(b.throughput))
+        ];
+        if (hasBaseline(data)) {
+            chartData.push(data.buckets.map(b => logTransform(b.baseline_throughput)));
+        }
+        if (hasForecast()) {
+            const last = data.buckets[data.buckets.length - 1].throughput;
+            appendForecast(chartData, data, ['throughput', 'throughput_low', 'throughput_high'], last);
+        }
+        return chartData;
+    }
+
+    // Record where the optional series start so tooltips can find them
+    function markOptionalSeries(chart, base, withBaseline) {
+        chart._baselineIdx = withBaseline ? base : null;
+        chart._forecastIdx = hasForecast() ? base + (withBaseline ? 1 : 0) : null;
+    }
+
+    // Fill between the forecast interval bounds
+    function forecastBands(base, withBaseline) {
+        if (!hasForecast()) return [];
+        const f = base + (withBaseline ? 1 : 0);
+        return [{ series: [f + 2, f + 1], fill: getChartColors().forecast + '20' }];
+    }
+
+    // Load the forecast of a stream, the forecast control stays hidden when not forecasting
+    async function loadForecast(stream) {
+        try {
+            const url = stream ? `/api/forecast?stream=${encodeURIComponent(stream)}` : '/api/forecast';
+            forecastData = await fetchJSON(url);
+        } catch (err) {
+            forecastData = null;
+        }
+        const control = document.getElementById('forecast-control');
+        if (control) {
+            control.style.display = forecastData ? '' : 'none';
+        }
+    }
+
     function createRateChart(container, data) {
         if (!data || !data.buckets || data.buckets.length === 0) {
             container.innerHTML = '<div class="error">No rate data available</div>';
@@ -577,10 +1009,7 @@
         }
 
         const colors = getChartColors();
-        const timestamps = data.buckets.map(b => new Date(b.start).getTime() / 1000);
-        const storedRates = data.buckets.map(b => logTransform(b.rate));
-        const totalRates = data.buckets.map(b => logTransform(b.seq_rate));
-        const deletedRates = data.buckets.map(b => logTransform(b.seq_rate - b.rate));
+        const withBaseline = hasBaseline(data);
 
         // Create shared tooltip element if not exists
         if (!rateTooltip) {
@@ -593,6 +1022,7 @@
             width: container.clientWidth,
             height: 280,
             title: '',
+            tzDate: ts => displayTimeZone ? uPlot.tzDate(new Date(ts * 1e3), displayTimeZone) : new Date(ts * 1e3),
             cursor: {
                 sync: {
                     key: 'traffic-sync',
@@ -666,8 +1096,11 @@
                     points: { show: false },
                     show: showInterpolatedDeletes,
                     value: (u, v) => v == null ? '-' : formatNumber(useLogScale ? Math.pow(10, v) : v) + ' msg/s'
-                }
+                },
+                ...(withBaseline ? [baselineSeries('Baseline Rate', v => formatNumber(v) + ' msg/s')] : []),
+                ...(hasForecast() ? forecastSeries(v => formatNumber(v) + ' msg/s') : [])
             ],
+            bands: forecastBands(4, withBaseline),
             legend: {
                 show: true,
                 live: true
@@ -698,11 +1131,13 @@
                         updateBothTooltips(idx);
                     }
                 ],
+                draw: [drawAnomalyMarkers, drawAdvisoryMarkers],
             }
         };
 
         container.innerHTML = '';
-        const chart = new uPlot(opts, [timestamps, storedRates, totalRates, deletedRates], container);
+        const chart = new uPlot(opts, rateChartData(data), container);
+        markOptionalSeries(chart, 4, withBaseline);
 
         // Double-click to go back to previous zoom level (only add once)
         if (!container._dblclickZoom) {
@@ -731,8 +1166,7 @@
         }
 
         const colors = getChartColors();
-        const timestamps = data.buckets.map(b => new Date(b.start).getTime() / 1000);
-        const throughputs = data.buckets.map(b => logTransform(b.throughput));
+        const withBaseline = hasBaseline(data);
 
         // Create shared tooltip element if not exists
         if (!throughputTooltip) {
@@ -745,6 +1179,7 @@
             width: container.clientWidth,
             height: 280,
             title: '',
+            tzDate: ts => displayTimeZone ? uPlot.tzDate(new Date(ts * 1e3), displayTimeZone) : new Date(ts * 1e3),
             cursor: {
                 sync: {
                     key: 'traffic-sync',
@@ -799,8 +1234,11 @@
                     width: 2,
                     points: { show: false },
                     value: (u, v) => v == null ? '-' : formatBytes(useLogScale ? Math.pow(10, v) : v) + '/s'
-                }
+                },
+                ...(withBaseline ? [baselineSeries('Baseline', v => formatBytes(v) + '/s')] : []),
+                ...(hasForecast() ? forecastSeries(v => formatBytes(v) + '/s') : [])
             ],
+            bands: forecastBands(2, withBaseline),
             legend: {
                 show: true,
                 live: true
@@ -835,7 +1273,8 @@
         };
 
         container.innerHTML = '';
-        const chart = new uPlot(opts, [timestamps, throughputs], container);
+        const chart = new uPlot(opts, throughputChartData(data), container);
+        markOptionalSeries(chart, 2, withBaseline);
 
         // Double-click to go back to previous zoom level (only add once)
         if (!container._dblclickZoom) {
@@ -916,7 +1355,7 @@
             const barWidth = maxMsg > 0 ? (stream.messages / maxMsg * 100) : 0;
             html += `
                 <div class="distribution-item">
-                    <div class="stream-name" title="${stream.name}">${stream.name}</div>
+                    <div class="stream-name" title="${escapeHtml(stream.name)}">${escapeHtml(stream.name)}</div>
                     <div class="bar-container">
                         <div class="bar" style="width: ${barWidth}%"></div>
                     </div>
@@ -930,10 +1369,363 @@
         container.innerHTML = html;
     }
 
+    // Render the day x hour heatmap of mean stored rates, with day and hour profiles on the edges
+    function renderSeasonality(container, data) {
+        if (!data || !data.heatmap) {
+            container.innerHTML = '<div class="no-data">Buckets are too long for an hour-of-day profile</div>';
+            return;
+        }
+
+        const maxRate = Math.max(...data.heatmap.flat(), ...data.hour_of_day.map(s => s.mean_rate), 0);
+        const cell = (rate, buckets, title) => {
+            if (!buckets) {
+                return '<td class="heatmap-cell empty" title="No data">-</td>';
+            }
+            const alpha = maxRate > 0 ? (0.08 + 0.92 * rate / maxRate).toFixed(2) : 0;
+            return `<td class="heatmap-cell" style="background-color: rgba(78, 205, 196, ${alpha})" title="${title}"></td>`;
+        };
+        const slotTitle = (slot) => `${slot.label}: mean ${formatNumber(slot.mean_rate)}, P50 ${formatNumber(slot.p50_rate)}, P99 ${formatNumber(slot.p99_rate)} msg/s`;
+
+        let html = '<table class="heatmap"><thead><tr><th></th>';
+        for (let h = 0; h < 24; h++) {
+            html += `<th>${String(h).padStart(2, '0')}</th>`;
+        }
+        html += '<th class="heatmap-profile">Mean</th><th class="heatmap-profile">P99</th></tr></thead><tbody>';
+
+        data.days.forEach((day, d) => {
+            html += `<tr><th>${day.slice(0, 3)}</th>`;
+            for (let h = 0; h < 24; h++) {
+                const rate = data.heatmap[d][h];
+                const buckets = data.heatmap_buckets[d][h];
+                html += cell(rate, buckets, `${day} ${String(h).padStart(2, '0')}:00: ${formatNumber(rate)} msg/s mean (${formatNumber(buckets)} buckets)`);
+            }
+            const slot = data.day_of_week[d];
+            html += `<td class="heatmap-profile" title="${slotTitle(slot)}">${slot.buckets ? formatNumber(slot.mean_rate) : '-'}</td>`;
+            html += `<td class="heatmap-profile" title="${slotTitle(slot)}">${slot.buckets ? formatNumber(slot.p99_rate) : '-'}</td></tr>`;
+        });
+
+        // Hour-of-day profile across all days
+        html += '<tr class="heatmap-profile-row"><th>All</th>';
+        data.hour_of_day.forEach(slot => {
+            html += cell(slot.mean_rate, slot.buckets, `All days ${slotTitle(slot)}`);
+        });
+        html += '<td></td><td></td></tr></tbody></table>';
+
+        container.innerHTML = html;
+    }
+
+    async function loadSeasonality(stream) {
+        const container = document.getElementById('seasonality-heatmap');
+        if (!container) return;
+        try {
+            const url = stream ? `/api/seasonality?stream=${encodeURIComponent(stream)}` : '/api/seasonality';
+            renderSeasonality(container, await fetchJSON(url));
+            document.getElementById('seasonality-timezone').textContent =
+                `(${displayTimeZone || Intl.DateTimeFormat().resolvedOptions().timeZone})`;
+        } catch (err) {
+            console.error('Failed to load seasonality:', err);
+            container.innerHTML = '<div class="error">Failed to load seasonality data</div>';
+        }
+    }
+
+    // Cell color of a correlation: teal for positive, red for negative, stronger when larger
+    function correlationColor(c) {
+        if (c === null) return 'transparent';
+        const alpha = (0.08 + 0.92 * Math.abs(c)).toFixed(2);
+        return c >= 0 ? `rgba(78, 205, 196, ${alpha})` : `rgba(255, 107, 107, ${alpha})`;
+    }
+
+    // Describe which stream of a pair leads at its strongest correlation
+    function describeLag(p) {
+        if (p.lag_ns > 0) return `${escapeHtml(p.b)} trails by ${formatBucketDuration(p.lag_ns)}`;
+        if (p.lag_ns < 0) return `${escapeHtml(p.b)} leads by ${formatBucketDuration(-p.lag_ns)}`;
+        return 'in step';
+    }
+
+    // Render the correlation matrix of the streams, their clusters and the most correlated pairs
+    function renderCorrelation(container, data) {
+        const fmt = c => c === null ? '-' : c.toFixed(2);
+
+        let html = '<table class="heatmap correlation-matrix"><thead><tr><th></th>';
+        data.streams.forEach((name, j) => {
+            html += `<th title="${escapeHtml(name)}">${j + 1}</th>`;
+        });
+        html += '</tr></thead><tbody>';
+        data.streams.forEach((name, i) => {
+            html += `<tr><th>${i + 1} ${escapeHtml(name)}</th>`;
+            data.matrix[i].forEach((c, j) => {
+                html += `<td class="heatmap-cell" style="background-color: ${correlationColor(c)}" title="${escapeHtml(name)} / ${escapeHtml(data.streams[j])}: ${fmt(c)}">${fmt(c)}</td>`;
+            });
+            html += '</tr>';
+        });
+        html += '</tbody></table>';
+        if (data.omitted > 0) {
+            html += `<p class="chart-hint">${data.omitted} quieter streams left out</p>`;
+        }
+
+        html += `<h3 class="correlation-heading">Clusters (mean correlation ${data.threshold.toFixed(2)} or more)</h3>`;
+        if (data.clusters.length === 0) {
+            html += '<div class="no-data">No clusters of streams moving together</div>';
+        } else {
+            html += '<ol class="correlation-clusters">';
+            data.clusters.forEach(c => {
+                html += `<li>${c.streams.map(escapeHtml).join(', ')} <span class="bucket-size">(${c.mean_correlation.toFixed(2)})</span></li>`;
+            });
+            html += '</ol>';
+        }
+
+        if (data.pairs.length > 0) {
+            html += `<h3 class="correlation-heading">Most correlated pairs (lag up to ${formatBucketDuration(data.max_lag_ns)})</h3>`;
+            html += '<table class="compare-table"><thead><tr><th>Pair</th><th>Correlation</th><th>At Best Lag</th><th>Lag</th></tr></thead><tbody>';
+            data.pairs.slice(0, 10).forEach(p => {
+                html += `<tr><td>${escapeHtml(p.a)} &harr; ${escapeHtml(p.b)}</td><td>${fmt(p.correlation)}</td><td>${fmt(p.lag_correlation)}</td><td>${describeLag(p)}</td></tr>`;
+            });
+            html += '</tbody></table>';
+        }
+
+        container.innerHTML = html;
+    }
+
+    // Load the correlation of all streams, the section is only shown in the combined view
+    async function loadCorrelation(stream) {
+        const section = document.getElementById('correlation-section');
+        const container = document.getElementById('correlation-content');
+        if (!section || !container) return;
+        if (stream) {
+            section.style.display = 'none';
+            return;
+        }
+        try {
+            const data = await fetchJSON('/api/correlation');
+            renderCorrelation(container, data);
+            document.getElementById('correlation-step').textContent = `(${formatBucketDuration(data.step_ns)} steps)`;
+            section.style.display = 'block';
+        } catch (err) {
+            section.style.display = 'none';
+        }
+    }
+
+    // Render the log2 size histogram and the size class shares over time of the loaded buckets
+    function updateSizes(data) {
+        const histContainer = document.getElementById('size-histogram');
+        const chartContainer = document.getElementById('size-class-chart');
+        if (!histContainer || !chartContainer) return;
+
+        const bins = (data && data.sizes) || [];
+        const first = bins.findIndex(b => b.messages > 0);
+        if (first < 0) {
+            histContainer.innerHTML = '<div class="no-data">No messages</div>';
+            chartContainer.innerHTML = '';
+            if (sizeClassChart) {
+                sizeClassChart.destroy();
+                sizeClassChart = null;
+            }
+            return;
+        }
+
+        const shown = bins.slice(first);
+        const totalMsgs = shown.reduce((sum, b) => sum + b.messages, 0);
+        const totalBytes = shown.reduce((sum, b) => sum + b.bytes, 0);
+        const maxMsgs = Math.max(...shown.map(b => b.messages));
+        let html = '';
+        for (const bin of shown) {
+            const barWidth = maxMsgs > 0 ? (bin.messages / maxMsgs * 100) : 0;
+            html += `
+                <div class="distribution-item">
+                    <div class="stream-name">${bin.label}</div>
+                    <div class="bar-container">
+                        <div class="bar" style="width: ${barWidth}%"></div>
+                    </div>
+                    <div class="stream-stats">
+                        <span class="msg-count">${formatNumber(bin.messages)}</span> msgs (${(bin.messages / totalMsgs * 100).toFixed(1)}%) /
+                        ${formatBytes(bin.bytes)} (${totalBytes > 0 ? (bin.bytes / totalBytes * 100).toFixed(1) : '0.0'}%)
+                    </div>
+                </div>
+            `;
+        }
+        histContainer.innerHTML = html;
+
+        // Share of messages per size class in each bucket, empty buckets have no share
+        const colors = getChartColors();
+        const classColors = [colors.stored, colors.total, colors.deleted];
+        const timestamps = data.buckets.map(b => new Date(b.start).getTime() / 1000);
+        const series = data.size_classes.map((_, c) =>
+            data.buckets.map(b => b.count > 0 && b.size_class_msgs ? b.size_class_msgs[c] / b.count * 100 : null));
+
+        if (sizeClassChart) {
+            sizeClassChart.destroy();
+        }
+        const opts = {
+            width: chartContainer.clientWidth,
+            height: 200,
+            tzDate: ts => displayTimeZone ? uPlot.tzDate(new Date(ts * 1e3), displayTimeZone) : new Date(ts * 1e3),
+            cursor: { drag: { x: false, y: false } },
+            scales: {
+                x: { time: true },
+                y: { auto: false, range: [0, 100] }
+            },
+            axes: [
+                { stroke: colors.axis, grid: { stroke: colors.grid }, ticks: { stroke: colors.grid } },
+                { stroke: colors.axis, grid: { stroke: colors.grid }, ticks: { stroke: colors.grid }, size: 60, values: (u, vals) => vals.map(v => v + '%') }
+            ],
+            series: [
+                { value: (u, v) => v == null ? '-' : formatTimestampShort(v * 1000) },
+                ...data.size_classes.map((label, c) => ({
+                    label: label,
+                    stroke: classColors[c % classColors.length],
+                    width: 2,
+                    points: { show: false },
+                    spanGaps: false,
+                    value: (u, v) => v == null ? '-' : v.toFixed(1) + '%'
+                }))
+            ],
+            legend: { show: true, live: true }
+        };
+        chartContainer.innerHTML = '';
+        sizeClassChart = new uPlot(opts, [timestamps, ...series], chartContainer);
+
+        // Handle resize, the chart is recreated on every update so observe the container once
+        if (!chartContainer._resizeObserver) {
+            chartContainer._resizeObserver = new ResizeObserver(entries => {
+                for (let entry of entries) {
+                    if (sizeClassChart) {
+                        sizeClassChart.setSize({ width: entry.contentRect.width, height: 200 });
+                    }
+                }
+            });
+            chartContainer._resizeObserver.observe(chartContainer);
+        }
+    }
+
+    // Format a nanosecond interval with a unit suited to its size
+    function formatIntervalNs(ns) {
+        if (ns <= 0) return '0s';
+        if (ns < 1e6) return (ns / 1e3).toFixed(1) + 'µs';
+        if (ns < 1e9) return (ns / 1e6).toFixed(2) + 'ms';
+        return formatDuration(ns / 1e6);
+    }
+
+    // Render the inter-arrival statistics and the log-scale interval histogram
+    function renderInterArrival(statsContainer, histContainer, data) {
+        const burstiness = data.burstiness < -0.3 ? 'regular' : (data.burstiness <= 0.3 ? 'random' : 'bursty');
+        const batches = data.batches > 0
+            ? `${formatNumber(data.batches)} batches, ${formatNumber(data.batched_msgs)} msgs, largest ${formatNumber(data.max_batch)}`
+            : 'none';
+        const stat = (label, value) => `<tr><td>${label}</td><td>${value}</td></tr>`;
+        statsContainer.innerHTML = '<table class="stats-table">' +
+            stat('Mean / StdDev', `${formatIntervalNs(data.mean_ns)} / ${formatIntervalNs(data.stddev_ns)}`) +
+            stat('P50 / P90 / P99 / P99.9', [data.p50_ns, data.p90_ns, data.p99_ns, data.p999_ns].map(formatIntervalNs).join(' / ')) +
+            stat('Min / Max', `${formatIntervalNs(data.min_ns)} / ${formatIntervalNs(data.max_ns)}`) +
+            stat('CV / Burstiness', `${data.cv.toFixed(2)} / ${data.burstiness.toFixed(2)} (${burstiness})`) +
+            stat('Same-timestamp batches', batches) + '</table>';
+
+        // Leave out the empty bins beyond the shortest and longest intervals, keep the same-time bin
+        const bins = data.histogram;
+        const used = bins.map((b, i) => b.count > 0 && i > 0 ? i : -1).filter(i => i >= 0);
+        const shown = used.length ? [bins[0], ...bins.slice(used[0], used[used.length - 1] + 1)] : [bins[0]];
+        const maxCount = Math.max(...shown.map(b => b.count), 0);
+
+        let html = '';
+        for (const bin of shown) {
+            const barWidth = maxCount > 0 ? (bin.count / maxCount * 100) : 0;
+            const share = data.intervals > 0 ? (bin.count / data.intervals * 100).toFixed(1) : '0.0';
+            html += `
+                <div class="distribution-item">
+                    <div class="stream-name">${bin.label}</div>
+                    <div class="bar-container">
+                        <div class="bar" style="width: ${barWidth}%"></div>
+                    </div>
+                    <div class="stream-stats">
+                        <span class="msg-count">${formatNumber(bin.count)}</span> (${share}%)
+                    </div>
+                </div>
+            `;
+        }
+        histContainer.innerHTML = html;
+    }
+
+    // Format a statistic of the comparison in its unit
+    function formatStatValue(unit, v, signed) {
+        const sign = signed ? (v < 0 ? '-' : '+') : '';
+        const abs = signed ? Math.abs(v) : v;
+        switch (unit) {
+            case 'count': return sign + formatNumber(abs);
+            case 'rate': return sign + formatNumber(abs) + '/s';
+            case 'bytes': return sign + formatBytes(abs);
+            case 'throughput': return sign + formatBytes(abs) + '/s';
+            case 'duration': return sign + formatDuration(abs / 1e6);
+            case 'time': return signed ? sign + formatDuration(abs / 1e6) : (v ? formatTimestampShort(v / 1e6) : '-');
+        }
+        return sign + abs.toFixed(2);
+    }
+
+    function renderComparison(container, data) {
+        const side = (title, s) => `<div><strong>${title}:</strong> ${escapeHtml(s.label)}, ` +
+            `${formatTimestamp(new Date(s.window_start).getTime())} to ${formatTimestamp(new Date(s.window_end).getTime())} ` +
+            `(${formatNumber(s.messages)} msgs)</div>`;
+        const change = c => c == null ? '-' : (c >= 9 ? `${(c + 1).toFixed(0)}x` : `${c >= 0 ? '+' : ''}${(c * 100).toFixed(1)}%`);
+        const changeClass = c => c == null || c === 0 ? '' : (c > 0 ? 'delta-up' : 'delta-down');
+
+        let html = '<div class="compare-windows">' + side('Baseline', data.baseline) + side('Current', data.current) + '</div>';
+        html += '<table class="compare-table"><thead><tr><th>Statistic</th><th>Baseline</th><th>Current</th><th>Delta</th><th>Change</th></tr></thead><tbody>';
+        for (const d of data.stats) {
+            html += `<tr><td>${escapeHtml(d.name)}</td><td>${formatStatValue(d.unit, d.baseline)}</td><td>${formatStatValue(d.unit, d.current)}</td>` +
+                `<td>${formatStatValue(d.unit, d.delta, true)}</td><td class="${changeClass(d.change)}">${change(d.change)}</td></tr>`;
+        }
+        html += '</tbody></table>';
+
+        if (!currentStream && data.streams.length > 0) {
+            html += '<table class="compare-table"><thead><tr><th>Stream</th><th>Baseline Msgs</th><th>Current Msgs</th><th>Change</th><th>Baseline %</th><th>Current %</th></tr></thead><tbody>';
+            for (const d of data.streams) {
+                const c = d.base_messages > 0 ? (d.cur_messages - d.base_messages) / d.base_messages : null;
+                html += `<tr><td>${escapeHtml(d.name)}</td><td>${formatNumber(d.base_messages)}</td><td>${formatNumber(d.cur_messages)}</td>` +
+                    `<td class="${changeClass(c)}">${change(c)}</td><td>${d.base_share.toFixed(1)}%</td><td>${d.cur_share.toFixed(1)}%</td></tr>`;
+            }
+            html += '</tbody></table>';
+        }
+        container.innerHTML = html;
+    }
+
+    // Load the comparison with the baseline, the section stays hidden when not comparing
+    async function loadComparison(stream) {
+        const section = document.getElementById('compare-section');
+        const container = document.getElementById('compare-content');
+        if (!section || !container) return;
+        try {
+            const url = stream ? `/api/compare?stream=${encodeURIComponent(stream)}` : '/api/compare';
+            const data = await fetchJSON(url);
+            renderComparison(container, data);
+            section.style.display = 'block';
+        } catch (err) {
+            section.style.display = 'none';
+        }
+    }
+
+    async function loadInterArrival(stream) {
+        const statsContainer = document.getElementById('interarrival-stats');
+        const histContainer = document.getElementById('interarrival-histogram');
+        if (!statsContainer || !histContainer) return;
+        try {
+            const url = stream ? `/api/interarrival?stream=${encodeURIComponent(stream)}` : '/api/interarrival';
+            const data = await fetchJSON(url);
+            renderInterArrival(statsContainer, histContainer, data);
+            document.getElementById('interarrival-count').textContent = `(${formatNumber(data.intervals)} intervals)`;
+        } catch (err) {
+            console.error('Failed to load inter-arrival times:', err);
+            statsContainer.innerHTML = '';
+            histContainer.innerHTML = '<div class="no-data">No inter-arrival data available</div>';
+            document.getElementById('interarrival-count').textContent = '';
+        }
+    }
+
     // UI update functions
     function updateSummary(summary, streamName) {
         if (!summary) return;
 
+        updateFetchStatus(summary, streamName);
+        updateDeleteBreakdown(summary, streamName);
+        updateTimeWindow(summary);
+
         // If a specific stream is selected, find its data
         if (streamName && summary.streams) {
             const streamData = summary.streams.find(s => s.name === streamName);
@@ -974,6 +1766,62 @@
         }
     }
 
+    // Show the time window requested with --start, --end, --since or --window
+    function updateTimeWindow(summary) {
+        const item = document.getElementById('summary-window-item');
+        if (!summary.window_start && !summary.window_end) {
+            item.style.display = 'none';
+            return;
+        }
+        const start = summary.window_start ? formatTimestamp(summary.window_start) : 'first message';
+        const end = summary.window_end ? formatTimestamp(summary.window_end) : 'last message';
+        document.getElementById('summary-window').textContent = `${start} - ${end}`;
+        item.style.display = '';
+    }
+
+    // Show whether the fetched data is complete, for the selected stream or all streams
+    function updateFetchStatus(summary, streamName) {
+        const el = document.getElementById('summary-fetch');
+        if (!el) return;
+
+        const fetch = (summary.fetch || []).filter(f => !streamName || f.stream === streamName);
+        const partial = fetch.filter(f => !f.complete);
+        el.classList.toggle('partial', partial.length > 0);
+        if (fetch.length === 0) {
+            el.textContent = '-';
+            el.title = '';
+        } else if (partial.length === 0) {
+            el.textContent = 'Complete';
+            el.title = '';
+        } else {
+            const missing = partial.reduce((sum, f) => sum + f.missing, 0);
+            el.textContent = streamName
+                ? `Partial (${formatNumber(missing)} msgs missing)`
+                : `Partial (${partial.length} of ${fetch.length} streams)`;
+            el.title = partial.map(f => `${f.stream}: ${f.missing} missing${f.fatal ? ' - ' + f.fatal : ''}`).join('\n');
+        }
+    }
+
+    // Show deleted message volume by likely cause, for the selected stream or all streams
+    function updateDeleteBreakdown(summary, streamName) {
+        const el = document.getElementById('summary-deletes');
+        if (!el) return;
+
+        const deletes = (summary.deletes || []).filter(d => !streamName || d.stream === streamName);
+        const causes = [['purge', 'purge'], ['rollover', 'subject rollover'], ['sparse', 'sparse']];
+        const totals = {};
+        causes.forEach(([cause]) => {
+            totals[cause] = deletes.reduce((sum, d) => sum + ((d.by_cause[cause] || {}).messages || 0), 0);
+        });
+
+        const parts = causes.filter(([cause]) => totals[cause] > 0)
+            .map(([cause, label]) => `${formatNumber(totals[cause])} ${label}`);
+        el.textContent = parts.length > 0 ? parts.join(', ') : 'None';
+        el.title = summary.purge_gaps === 'exclude' && totals.purge > 0
+            ? 'Purge gaps are excluded from the stored + deleted rate'
+            : '';
+    }
+
     function updateSummaryFromStats(stats) {
         if (!stats) return;
         // Update throughput from histogram stats (more accurate than total_bytes/duration)
@@ -1067,6 +1915,15 @@
     async function loadSummary() {
         try {
             summaryData = await fetchJSON('/api/summary');
+            if (summaryData && summaryData.timezone) {
+                displayTimeZone = summaryData.timezone;
+            }
+
+            // Start with the strategy the report was built with
+            const interpolationSelect = document.getElementById('interpolation-select');
+            if (interpolationSelect && summaryData && summaryData.interpolation) {
+                interpolationSelect.value = summaryData.interpolation;
+            }
             updateSummary(summaryData, currentStream);
 
             // Create distribution list if we have stream data
@@ -1115,6 +1972,9 @@
             if (useAverageDownsampling) {
                 url += (url.includes('?') ? '&' : '?') + 'downsample=avg';
             }
+            if (interpolationStrategy) {
+                url += (url.includes('?') ? '&' : '?') + `interpolation=${encodeURIComponent(interpolationStrategy)}`;
+            }
             histogramData = await fetchJSON(url, { signal: currentAbortController.signal });
 
             // Check if this response is still relevant
@@ -1151,6 +2011,7 @@
                 updateThroughputStats(histogramData.stats);
                 updateSummaryFromStats(histogramData.stats);
             }
+            updateSizes(histogramData);
 
             // Update bucket size indicator
             if (histogramData && histogramData.granularity_ns && histogramData.stats) {
@@ -1234,7 +2095,14 @@
                 distSection.style.display = 'block';
             }
 
+            await loadAnomalies(currentStream);
+            await loadAdvisories(currentStream);
+            await loadForecast(currentStream);
             await loadHistogram(currentStream);
+            await loadSeasonality(currentStream);
+            await loadInterArrival(currentStream);
+            await loadComparison(currentStream);
+            await loadCorrelation(currentStream);
             hideLoadingOverlay();
         } catch (err) {
             // Ignore abort errors (happens when rapidly switching streams)
@@ -1277,6 +2145,39 @@
             });
         }
 
+        // Set up anomaly markers checkbox
+        const anomaliesCheckbox = document.getElementById('show-anomalies');
+        if (anomaliesCheckbox) {
+            anomaliesCheckbox.addEventListener('change', (e) => {
+                toggleAnomalies(e.target.checked);
+            });
+        }
+
+        // Set up advisory markers checkbox
+        const advisoriesCheckbox = document.getElementById('show-advisories');
+        if (advisoriesCheckbox) {
+            advisoriesCheckbox.addEventListener('change', (e) => {
+                toggleAdvisories(e.target.checked);
+            });
+        }
+
+        // Set up forecast checkbox
+        const forecastCheckbox = document.getElementById('show-forecast');
+        if (forecastCheckbox) {
+            forecastCheckbox.addEventListener('change', (e) => {
+                toggleForecast(e.target.checked);
+            });
+        }
+
+        // Set up delete interpolation strategy selector
+        const interpolationSelect = document.getElementById('interpolation-select');
+        if (interpolationSelect) {
+            interpolationSelect.addEventListener('change', async (e) => {
+                interpolationStrategy = e.target.value;
+                await refetchHistogramForZoom();
+            });
+        }
+
         // Set up chart mode radio buttons (allow deselection by clicking active one)
         const chartModeRadios = document.querySelectorAll('input[name="chart-mode"]');
         let activeChartMode = null;
@@ -1334,7 +2235,14 @@
 
             updateLoadingMessage('Loading histogram data...');
             // Load combined histogram
+            await loadAnomalies('');
+            await loadAdvisories('');
+            await loadForecast('');
             await loadHistogram('');
+            await loadSeasonality('');
+            await loadInterArrival('');
+            await loadComparison('');
+            await loadCorrelation('');
 
             hideLoadingOverlay();
         } catch (err) {